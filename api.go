@@ -1,6 +1,7 @@
 package bitcask
 
 import (
+	"context"
 	"fmt"
 
 	"go.mills.io/bitcask/v2/internal"
@@ -61,6 +62,12 @@ type Transaction interface {
 	Discard()
 	Commit() error
 
+	Len() int
+
+	Hash(Key) *Hash
+	List(Key) *List
+	SortedSet(Key) *SortedSet
+
 	ForEach(KeyFunc) error
 	Iterator(...IteratorOption) Iterator
 	Range(start Key, end Key, f KeyFunc) error
@@ -75,6 +82,15 @@ type Keys interface {
 	Put(Key, Value) error
 }
 
+// store is the subset of the database API used by the high-level data types
+// which is satisfied by both a DB and a Transaction
+type store interface {
+	Keys
+
+	Range(start Key, end Key, f KeyFunc) error
+	Scan(prefix Key, f KeyFunc) error
+}
+
 // Types is an interface for high-level data types
 type Types interface {
 	Hash(Key) *Hash
@@ -83,6 +99,18 @@ type Types interface {
 	Collection(name string) *Collection
 }
 
+// Saver is implemented by databases which can save a copy of themselves,
+// such as the databases opened with OpenInMemory
+type Saver interface {
+	SaveTo(path string) error
+}
+
+// Verifier is implemented by databases which can verify their datafiles and
+// index, such as the databases opened with Open
+type Verifier interface {
+	Verify(ctx context.Context, opts VerifyOptions) (Report, error)
+}
+
 // DB is an interface that describes the public facing API of a Bitcask database
 type DB interface {
 	Keys
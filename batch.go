@@ -3,10 +3,14 @@ package bitcask
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/cache"
 	"go.mills.io/bitcask/v2/internal/codec"
 	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/internal/data"
+	"go.mills.io/bitcask/v2/metrics"
 )
 
 type batchOptions struct {
@@ -87,48 +91,78 @@ func (b *bitcask) Batch(opts ...BatchOption) Batch {
 	return batch
 }
 
-func (b *bitcask) WriteBatch(batch Batch) error {
+func (b *bitcask) WriteBatch(batch Batch) (err error) {
+	var (
+		start = time.Now()
+		bytes int64
+	)
+
+	entries := batch.Entries()
+	defer func() {
+		b.observe(metrics.OpWriteBatch, start, bytes, len(entries), err)
+	}()
+
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	current, bytes, err := b.write(entries)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Syncing without the lock lets readers and writers proceed, datafiles
+	// rotated while writing were synced when closed
+	if b.config.SyncWrites {
+		return current.Sync()
+	}
+
+	return nil
+}
 
+// write appends the entries to the datafiles and publishes the keydir with
+// the entries written, the caller must hold the lock
+func (b *bitcask) write(entries []internal.Entry) (current data.Datafile, bytes int64, err error) {
 	if b.current.Readonly() {
-		return ErrDatabaseReadonly
+		return nil, 0, ErrDatabaseReadonly
 	}
 
 	b.metadata.IndexUpToDate = false
 
-	for _, entry := range batch.Entries() {
+	t := b.trie
+	defer func() {
+		b.trie = t
+		b.publish()
+	}()
+
+	for _, entry := range entries {
 		if err := b.maybeRotate(); err != nil {
-			return fmt.Errorf("error rotating active datafile: %w", err)
+			return nil, bytes, fmt.Errorf("error rotating active datafile: %w", err)
 		}
 
 		offset, n, err := b.current.Write(entry)
 		if err != nil {
-			return err
-		}
-
-		if b.config.SyncWrites {
-			if err := b.current.Sync(); err != nil {
-				return err
-			}
+			return nil, bytes, err
 		}
+		bytes += n
 
 		// in case of successful write, IndexUpToDate will be always be false
 		b.metadata.IndexUpToDate = false
 
 		if entry.Value != nil {
-			if oldItem, found := b.trie.Root().Get(entry.Key); found {
+			if oldItem, found := t.Get(entry.Key); found {
 				b.metadata.ReclaimableSpace += oldItem.Size
+				b.cache.Remove(cache.Key{Epoch: b.epoch, FileID: oldItem.FileID, Offset: oldItem.Offset})
 			}
 			item := internal.Item{FileID: b.current.FileID(), Offset: offset, Size: n}
-			b.trie, _, _ = b.trie.Insert(entry.Key, item)
+			b.addKey(entry.Key)
+			t = t.Insert(entry.Key, item)
 		} else {
-			if oldItem, found := b.trie.Root().Get(entry.Key); found {
+			if oldItem, found := t.Get(entry.Key); found {
 				b.metadata.ReclaimableSpace += oldItem.Size + codec.MetaInfoSize + int64(len(entry.Key))
+				b.cache.Remove(cache.Key{Epoch: b.epoch, FileID: oldItem.FileID, Offset: oldItem.Offset})
 			}
-			b.trie, _, _ = b.trie.Delete(entry.Key)
+			t = t.Delete(entry.Key)
 		}
 	}
 
-	return nil
+	return b.current, bytes, nil
 }
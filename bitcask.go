@@ -3,39 +3,97 @@
 package bitcask
 
 import (
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
+	"maps"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
 	"sync"
-
-	"github.com/gofrs/flock"
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
+	"sync/atomic"
+	"time"
 
 	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/bloom"
+	"go.mills.io/bitcask/v2/internal/cache"
+	"go.mills.io/bitcask/v2/internal/codec"
 	"go.mills.io/bitcask/v2/internal/config"
 	"go.mills.io/bitcask/v2/internal/data"
 	"go.mills.io/bitcask/v2/internal/index"
+	"go.mills.io/bitcask/v2/internal/keydir"
 	"go.mills.io/bitcask/v2/internal/metadata"
+	"go.mills.io/bitcask/v2/metrics"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 const lockfile = "lock"
 
 type bitcask struct {
+	// mu is held by writers, readers use the published state instead
 	mu        sync.RWMutex
-	flock     *flock.Flock
+	state     atomic.Pointer[state]
+	epoch     uint64
+	flock     vfs.Locker
+	fs        vfs.FS
 	config    *config.Config
 	options   []Option
 	path      string
 	current   data.Datafile
 	datafiles map[int]data.Datafile
-	trie      *iradix.Tree[internal.Item]
-	indexer   index.Indexer[internal.Item]
+	trie      keydir.Keydir
+	indexer   index.Indexer
+	cache     *cache.Cache
 	metadata  *metadata.MetaData
-	isMerging bool
+	isMerging atomic.Bool
+	stop      chan struct{}
+
+	// filters are the Bloom filters of the immutable datafiles and keys the
+	// key set of the active datafile, both nil if filters aren't enabled
+	filters map[int]*bloom.Filter
+	keys    keySet
+}
+
+// state is the keydir and datafiles used by readers, writers publish a new
+// state instead of changing it so readers never wait for writers
+type state struct {
+	// epoch changes when datafiles are merged and their ids are reused
+	epoch     uint64
+	trie      keydir.Keydir
+	current   data.Datafile
+	datafiles map[int]data.Datafile
+}
+
+// datafile returns the datafile of the state with the given id, if any
+func (s *state) datafile(id int) data.Datafile {
+	if id == s.current.FileID() {
+		return s.current
+	}
+	return s.datafiles[id]
+}
+
+// publish makes the keydir and datafiles visible to readers, the caller
+// must hold the lock
+func (b *bitcask) publish() {
+	b.state.Store(&state{
+		epoch:     b.epoch,
+		trie:      b.trie,
+		current:   b.current,
+		datafiles: b.datafiles,
+	})
+}
+
+// stale returns true if s was replaced by a state with other datafiles,
+// waiting for a rotation, merge or close in progress to finish
+func (b *bitcask) stale(s *state) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.state.Load().current != s.current
 }
 
 // Close closes the database and removes the lock. It is important to call
@@ -54,9 +112,32 @@ func (b *bitcask) Close() error {
 		b.mu.Unlock()
 	}()
 
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+
 	return b.close()
 }
 
+// flushEvery writes the buffered writes of the active datafile every
+// interval until the database is closed
+func (b *bitcask) flushEvery(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := b.state.Load().current.Flush(); err != nil {
+				b.config.Log().Warn("error flushing buffered writes", "path", b.path, "error", err)
+			}
+		}
+	}
+}
+
 func (b *bitcask) close() error {
 	if !b.current.Readonly() {
 		if err := b.saveIndexes(); err != nil {
@@ -67,6 +148,15 @@ func (b *bitcask) close() error {
 		if err := b.saveMetadata(); err != nil {
 			return err
 		}
+
+		// Written for datafiles which are immutable once reopened, such as
+		// merged datafiles, it is removed if the datafile is appended to
+		if b.keys != nil {
+			f := b.keys.filter(b.config.BloomFalsePositiveRate)
+			if err := b.writeFilter(b.current.FileID(), b.current.Size(), f); err != nil {
+				b.config.Log().Warn("error writing bloom filter", "path", b.path, "error", err)
+			}
+		}
 	}
 
 	for _, df := range b.datafiles {
@@ -80,46 +170,78 @@ func (b *bitcask) close() error {
 
 // Sync flushes all buffers to disk ensuring all data is written
 func (b *bitcask) Sync() error {
-	b.mu.RLock()
-	if b.current.Readonly() {
-		b.mu.RUnlock()
+	s := b.state.Load()
+	if s.current.Readonly() {
 		return nil
 	}
-	b.mu.RUnlock()
 
-	if err := b.saveMetadata(); err != nil {
+	// Concurrent saves write their own temporary file
+	b.mu.RLock()
+	err := b.saveMetadata()
+	b.mu.RUnlock()
+	if err != nil {
 		return err
 	}
 
-	return b.current.Sync()
+	return s.current.Sync()
 }
 
 // Readonly returns true if the database is currently opened in readonly mode, false otherwise
 func (b *bitcask) Readonly() bool {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	return b.state.Load().current.Readonly()
+}
 
-	return b.current.Readonly()
+// observe notifies the observer, if any, of an operation started at start
+func (b *bitcask) observe(op metrics.Op, start time.Time, bytes int64, keys int, err error) {
+	if b.config.Observer == nil {
+		return
+	}
+	b.config.Observer.Observe(metrics.Event{
+		Op:       op,
+		Duration: time.Since(start),
+		Bytes:    bytes,
+		Keys:     keys,
+		Err:      err,
+	})
 }
 
 // Get fetches value for a key
 func (b *bitcask) Get(key Key) (Value, error) {
-	return b.Transaction().Get(key)
+	start := time.Now()
+
+	var value Value
+	e, err := b.read(key)
+	if err == nil {
+		value = e.Value
+	}
+	switch {
+	case err == nil:
+		b.observe(metrics.OpGet, start, int64(len(value)), 1, nil)
+	case errors.Is(err, ErrKeyNotFound):
+		b.observe(metrics.OpGet, start, 0, 0, nil)
+	default:
+		b.observe(metrics.OpGet, start, 0, 0, err)
+	}
+
+	return value, err
 }
 
 // Has returns true if the key exists in the database, false otherwise.
 func (b *bitcask) Has(key Key) bool {
-	return b.Transaction().Has(key)
+	_, found := b.state.Load().trie.Get(key)
+	return found
 }
 
 // Put stores the key and value in the database.
-func (b *bitcask) Put(key Key, value Value) error {
-	b.mu.RLock()
-	if b.current.Readonly() {
-		b.mu.RUnlock()
+func (b *bitcask) Put(key Key, value Value) (err error) {
+	start := time.Now()
+	defer func() {
+		b.observe(metrics.OpPut, start, int64(len(key)+len(value)), 1, err)
+	}()
+
+	if b.Readonly() {
 		return ErrDatabaseReadonly
 	}
-	b.mu.RUnlock()
 
 	tx := b.Transaction()
 	defer tx.Discard()
@@ -132,7 +254,12 @@ func (b *bitcask) Put(key Key, value Value) error {
 }
 
 // Delete deletes the named key.
-func (b *bitcask) Delete(key Key) error {
+func (b *bitcask) Delete(key Key) (err error) {
+	start := time.Now()
+	defer func() {
+		b.observe(metrics.OpDelete, start, int64(len(key)), 1, err)
+	}()
+
 	tx := b.Transaction()
 	defer tx.Discard()
 
@@ -160,10 +287,7 @@ func (b *bitcask) Range(start, end Key, f KeyFunc) (err error) {
 
 // Len returns the total number of keys in the database
 func (b *bitcask) Len() int {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-
-	return b.trie.Len()
+	return b.state.Load().trie.Len()
 }
 
 // ForEach iterates over all keys in the database calling the function `f` for
@@ -173,43 +297,77 @@ func (b *bitcask) ForEach(f KeyFunc) (err error) {
 	return b.Transaction().ForEach(f)
 }
 
+// read reads the latest entry of key through the value cache
 func (b *bitcask) read(key []byte) (internal.Entry, error) {
-	var df data.Datafile
+	for {
+		s := b.state.Load()
 
-	b.mu.RLock()
-	item, found := b.trie.Root().Get(key)
-	b.mu.RUnlock()
+		item, found := s.trie.Get(key)
+		if !found {
+			return internal.Entry{}, ErrKeyNotFound
+		}
 
-	if !found {
-		return internal.Entry{}, ErrKeyNotFound
+		// The hashed keydir is shared by all states, the key may have been
+		// written to a datafile of a newer state
+		df := s.datafile(item.FileID)
+		if df == nil {
+			if b.stale(s) {
+				continue
+			}
+			return internal.Entry{}, fmt.Errorf("datafile %d not found", item.FileID)
+		}
+
+		e, err := b.readItem(s.epoch, df, key, item)
+
+		// The datafiles of a stale state may have been closed meanwhile
+		if err != nil && b.stale(s) {
+			continue
+		}
+		return e, err
 	}
+}
 
-	if item.FileID == b.current.FileID() {
-		df = b.current
-	} else {
-		df = b.datafiles[item.FileID]
+// readItem reads the entry of key at item in df of the given epoch through
+// the value cache
+func (b *bitcask) readItem(epoch uint64, df data.Datafile, key []byte, item internal.Item) (internal.Entry, error) {
+	location := cache.Key{Epoch: epoch, FileID: item.FileID, Offset: item.Offset}
+	if value, ok := b.cache.Get(location); ok {
+		return internal.Entry{Key: key, Value: value}, nil
 	}
 
-	e, err := df.ReadAt(item.Offset, item.Size)
+	e, err := readEntry(df, item)
 	if err != nil {
 		return internal.Entry{}, err
 	}
 
-	checksum := crc32.ChecksumIEEE(e.Value)
-	if checksum != e.Checksum {
-		return internal.Entry{}, ErrChecksumFailed
-	}
+	b.cache.Add(location, e.Value)
+	return e, nil
+}
 
+// readEntry reads the entry at item in df
+func readEntry(df data.Datafile, item internal.Item) (internal.Entry, error) {
+	e, err := df.ReadAt(item.Offset, item.Size)
+	if err != nil {
+		if errors.Is(err, codec.ErrChecksumFailed) {
+			return internal.Entry{}, ErrChecksumFailed
+		}
+		return internal.Entry{}, err
+	}
 	return e, nil
 }
 
-func (b *bitcask) maybeRotate() error {
+func (b *bitcask) maybeRotate() (err error) {
 	size := b.current.Size()
 	if size < int64(b.config.MaxDatafileSize) {
 		return nil
 	}
 
-	err := b.current.Close()
+	start := time.Now()
+	defer func() {
+		b.observe(metrics.OpRotate, start, size, 0, err)
+	}()
+
+	err = b.current.Close()
 	if err != nil {
 		return err
 	}
@@ -217,28 +375,26 @@ func (b *bitcask) maybeRotate() error {
 	id := b.current.FileID()
 
 	df, err := data.NewOnDiskDatafile(
-		b.path, id, true,
+		b.fs, b.path, id, true,
 		b.config.MaxKeySize,
 		b.config.MaxValueSize,
 		b.config.FileMode,
+		b.datafileOptions()...,
 	)
 	if err != nil {
 		return err
 	}
 
-	b.datafiles[id] = df
+	b.addDatafile(df)
+	b.rotateFilter(id)
 
 	id = b.current.FileID() + 1
-	current, err := data.NewOnDiskDatafile(
-		b.path, id, false,
-		b.config.MaxKeySize,
-		b.config.MaxValueSize,
-		b.config.FileMode,
-	)
+	current, err := b.openCurrent(id, false)
 	if err != nil {
 		return err
 	}
 	b.current = current
+	b.publish()
 
 	return nil
 }
@@ -251,28 +407,33 @@ func (b *bitcask) closeCurrentFile() error {
 
 	id := b.current.FileID()
 	df, err := data.NewOnDiskDatafile(
-		b.path, id, true,
+		b.fs, b.path, id, true,
 		b.config.MaxKeySize,
 		b.config.MaxValueSize,
 		b.config.FileMode,
+		b.datafileOptions()...,
 	)
 	if err != nil {
 		return err
 	}
 
-	b.datafiles[id] = df
+	b.addDatafile(df)
+	b.rotateFilter(id)
 	return nil
 }
 
+// addDatafile adds a datafile to a copy of the datafiles as readers may use
+// the datafiles of a published state
+func (b *bitcask) addDatafile(df data.Datafile) {
+	datafiles := maps.Clone(b.datafiles)
+	datafiles[df.FileID()] = df
+	b.datafiles = datafiles
+}
+
 // openNewWriteableFile opens new datafile for writing data
 func (b *bitcask) openNewWriteableFile() error {
 	id := b.current.FileID() + 1
-	current, err := data.NewOnDiskDatafile(
-		b.path, id, false,
-		b.config.MaxKeySize,
-		b.config.MaxValueSize,
-		b.config.FileMode,
-	)
+	current, err := b.openCurrent(id, false)
 	if err != nil {
 		return err
 	}
@@ -280,16 +441,57 @@ func (b *bitcask) openNewWriteableFile() error {
 	return nil
 }
 
+// openCurrent opens the active datafile with the given id, buffering writes
+// if configured
+func (b *bitcask) openCurrent(id int, readonly bool) (data.Datafile, error) {
+	if !readonly && b.config.WriteBufferSize > 0 {
+		return data.NewBufferedDatafile(
+			b.fs, b.path, id,
+			b.config.MaxKeySize,
+			b.config.MaxValueSize,
+			b.config.FileMode,
+			b.config.WriteBufferSize,
+			b.datafileOptions()...,
+		)
+	}
+	return data.NewOnDiskDatafile(
+		b.fs, b.path, id, readonly,
+		b.config.MaxKeySize,
+		b.config.MaxValueSize,
+		b.config.FileMode,
+		b.datafileOptions()...,
+	)
+}
+
+// datafileOptions returns the filesystem hints enabled for datafiles
+func (b *bitcask) datafileOptions() []data.Option {
+	var opts []data.Option
+	if b.config.Preallocate {
+		opts = append(opts, data.WithPreallocate(int64(b.config.MaxDatafileSize)))
+	}
+	if b.config.Datasync {
+		opts = append(opts, data.WithDatasync())
+	}
+	if b.config.Fadvise {
+		opts = append(opts, data.WithReadHints())
+	}
+	return opts
+}
+
 // reopen reloads a bitcask object with index and datafiles
 // caller of this method should take care of locking
 func (b *bitcask) reopen(readonly bool) error {
 	datafiles, lastID, err := loadDatafiles(
-		b.path,
+		b.fs, b.path,
 		b.config.MaxKeySize,
 		b.config.MaxValueSize,
 		b.config.FileMode,
+		b.datafileOptions()...,
 	)
 	if err != nil {
+		if errors.Is(err, codec.ErrUnsupportedVersion) {
+			return fmt.Errorf("%w: %s", ErrInvalidVersion, err)
+		}
 		return err
 	}
 	t, err := loadIndexes(b, datafiles, lastID)
@@ -297,12 +499,13 @@ func (b *bitcask) reopen(readonly bool) error {
 		return err
 	}
 
-	current, err := data.NewOnDiskDatafile(
-		b.path, lastID, readonly,
-		b.config.MaxKeySize,
-		b.config.MaxValueSize,
-		b.config.FileMode,
-	)
+	// Never append to a datafile written in an older format
+	if df, ok := datafiles[lastID]; ok && !readonly && df.Version() != codec.CurrentVersion {
+		b.config.Log().Info("active datafile has an older format, starting a new datafile", "datafile", df.Name())
+		lastID++
+	}
+
+	current, err := b.openCurrent(lastID, readonly)
 	if err != nil {
 		return err
 	}
@@ -310,6 +513,23 @@ func (b *bitcask) reopen(readonly bool) error {
 	b.trie = t
 	b.current = current
 	b.datafiles = datafiles
+	if err := b.loadFilters(readonly); err != nil {
+		return err
+	}
+
+	// Merged datafiles reuse the ids of the datafiles they replace
+	b.epoch++
+	b.cache.Purge()
+	b.publish()
+
+	// The index on disk is stale as soon as anything is written, so it
+	// must not be trusted if the database isn't closed cleanly
+	if !readonly && b.metadata.IndexUpToDate {
+		b.metadata.IndexUpToDate = false
+		if err := b.saveMetadata(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -317,28 +537,35 @@ func (b *bitcask) reopen(readonly bool) error {
 // Merge merges all datafiles in the database. Old keys are squashed
 // and deleted keys removes. Duplicate key/value pairs are also removed.
 // Call this function periodically to reclaim disk space.
-func (b *bitcask) Merge() error {
-	b.mu.Lock()
+func (b *bitcask) Merge() (err error) {
+	var (
+		start = time.Now()
+		bytes int64
+		keys  int
+	)
+	defer func() {
+		b.observe(metrics.OpMerge, start, bytes, keys, err)
+	}()
 
-	if b.current.Readonly() {
-		b.mu.Unlock()
+	if b.Readonly() {
 		return ErrDatabaseReadonly
 	}
 
-	if b.isMerging {
-		b.mu.Unlock()
+	if !b.isMerging.CompareAndSwap(false, true) {
 		return ErrMergeInProgress
 	}
 
-	b.isMerging = true
-	b.mu.Unlock()
+	log := b.config.Log()
 	defer func() {
-		b.isMerging = false
+		if err != nil {
+			log.Error("merge failed", "path", b.path, "error", err)
+		}
 	}()
+	defer b.isMerging.Store(false)
 	b.mu.Lock()
-	err := b.closeCurrentFile()
+	err = b.closeCurrentFile()
 	if err != nil {
-		b.mu.RUnlock()
+		b.mu.Unlock()
 		return err
 	}
 	filesToMerge := make([]int, 0, len(b.datafiles))
@@ -347,18 +574,30 @@ func (b *bitcask) Merge() error {
 	}
 	err = b.openNewWriteableFile()
 	if err != nil {
-		b.mu.RUnlock()
+		b.mu.Unlock()
 		return err
 	}
+	b.publish()
+	snapshot := b.state.Load()
 	b.mu.Unlock()
 	sort.Ints(filesToMerge)
 
+	log.Info("merging datafiles", "path", b.path, "datafiles", len(filesToMerge))
+
+	// The keydir is walked in key order so the datafiles are read in no
+	// particular order, prefetching them avoids a disk seek for most reads
+	for _, id := range filesToMerge {
+		if err := snapshot.datafiles[id].Prefetch(); err != nil {
+			log.Warn("error prefetching datafile to merge", "datafile", id, "error", err)
+		}
+	}
+
 	// Temporary merged database path
-	temp, err := os.MkdirTemp(b.path, "merge")
+	temp, err := b.fs.MkdirTemp(b.path, "merge")
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(temp)
+	defer b.fs.RemoveAll(temp)
 
 	// Create a merged database
 	mdb, err := Open(temp, withConfig(b.config))
@@ -369,19 +608,23 @@ func (b *bitcask) Merge() error {
 	// Rewrite all key/value pairs into merged database
 	// Doing this automatically strips deleted keys and
 	// old key/value pairs
-	b.trie.Root().Walk(func(key []byte, item internal.Item) bool {
+	snapshot.trie.Walk(func(key []byte, item internal.Item) bool {
 		// if key was updated after start of merge operation, nothing to do
 		if item.FileID > filesToMerge[len(filesToMerge)-1] {
 			return false
 		}
-		e, err := b.read(key)
+		e, err := readEntry(snapshot.datafile(item.FileID), item)
 		if err != nil {
+			log.Warn("error reading key to merge", "key", key, "error", err)
 			return true
 		}
 
 		if err := mdb.Put(key, e.Value); err != nil {
+			log.Warn("error writing merged key", "key", key, "error", err)
 			return true
 		}
+		bytes += int64(len(key) + len(e.Value))
+		keys++
 
 		return false
 	})
@@ -398,7 +641,7 @@ func (b *bitcask) Merge() error {
 	}
 
 	// Remove data files
-	files, err := os.ReadDir(b.path)
+	files, err := b.fs.ReadDir(b.path)
 	if err != nil {
 		return err
 	}
@@ -406,22 +649,26 @@ func (b *bitcask) Merge() error {
 		if file.IsDir() || file.Name() == lockfile {
 			continue
 		}
-		ids, err := internal.ParseIds([]string{file.Name()})
+		name := file.Name()
+		if ext := filepath.Ext(name); ext == bloomExt {
+			name = strings.TrimSuffix(name, ext) + ".data"
+		}
+		ids, err := internal.ParseIds([]string{name})
 		if err != nil {
 			return err
 		}
-		// if datafile was created after start of merge, skip
+		// if datafile, or its filter, was created after start of merge, skip
 		if len(ids) > 0 && ids[0] > filesToMerge[len(filesToMerge)-1] {
 			continue
 		}
-		err = os.RemoveAll(path.Join(b.path, file.Name()))
+		err = b.fs.RemoveAll(path.Join(b.path, file.Name()))
 		if err != nil {
 			return err
 		}
 	}
 
 	// Rename all merged data files
-	files, err = os.ReadDir(mdb.Path())
+	files, err = b.fs.ReadDir(mdb.Path())
 	if err != nil {
 		return err
 	}
@@ -430,7 +677,7 @@ func (b *bitcask) Merge() error {
 		if file.Name() == lockfile {
 			continue
 		}
-		err := os.Rename(
+		err := b.fs.Rename(
 			path.Join([]string{mdb.Path(), file.Name()}...),
 			path.Join([]string{b.path, file.Name()}...),
 		)
@@ -440,8 +687,17 @@ func (b *bitcask) Merge() error {
 	}
 	b.metadata.ReclaimableSpace = 0
 
+	// All datafiles and the index have been rewritten in the current format
+	b.metadata.Version = FormatVersion
+
 	// And finally reopen the database
-	return b.reopen(false)
+	if err = b.reopen(false); err != nil {
+		return err
+	}
+
+	log.Info("merged datafiles", "path", b.path, "keys", keys, "bytes", bytes, "duration", time.Since(start))
+
+	return nil
 }
 
 // Open opens the database at the given path with optional options.
@@ -454,9 +710,11 @@ func Open(path string, options ...Option) (DB, error) {
 		meta *metadata.MetaData
 	)
 
+	fs := fileSystem(options)
+
 	configPath := filepath.Join(path, "config.json")
-	if internal.Exists(configPath) {
-		cfg, err = config.Load(configPath)
+	if internal.Exists(fs, configPath) {
+		cfg, err = config.Load(fs, configPath)
 		if err != nil {
 			return nil, &ErrBadConfig{err}
 		}
@@ -470,24 +728,49 @@ func Open(path string, options ...Option) (DB, error) {
 		}
 	}
 
-	if err := os.MkdirAll(path, cfg.DirMode); err != nil {
+	if err := fs.MkdirAll(path, cfg.DirMode); err != nil {
 		return nil, err
 	}
 
-	meta, err = loadMetadata(path)
+	meta, err = loadMetadata(fs, path)
 	if err != nil {
 		return nil, &ErrBadMetadata{err}
 	}
+	if meta.Version > FormatVersion {
+		return nil, fmt.Errorf("%w: database format version %d is newer than %d", ErrInvalidVersion, meta.Version, FormatVersion)
+	}
+
+	indexer, err := index.NewIndexerWithFormat(fs, index.Format(cfg.IndexFormat))
+	if err != nil {
+		return nil, &ErrBadConfig{err}
+	}
+
+	kd, err := keydir.New(keydir.Mode(cfg.Keydir))
+	if err != nil {
+		return nil, ErrInvalidKeydir
+	}
+	if (cfg.Keydir == KeydirPacked || cfg.Keydir == KeydirHashed) && uint64(cfg.MaxKeySize)+cfg.MaxValueSize+codec.MetaInfoSize > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: the %s keydir requires entries smaller than 4GiB", ErrInvalidKeydir, cfg.Keydir)
+	}
+
+	lock, err := fs.Lock(filepath.Join(path, lockfile))
+	if err != nil {
+		return nil, err
+	}
 
 	db := &bitcask{
-		flock:    flock.New(filepath.Join(path, lockfile)),
+		flock:    lock,
+		fs:       fs,
 		config:   cfg,
 		options:  options,
 		path:     path,
-		trie:     iradix.New[internal.Item](),
-		indexer:  index.NewIndexer(),
+		trie:     kd,
+		indexer:  indexer,
 		metadata: meta,
 	}
+	if cfg.CacheSize > 0 {
+		db.cache = cache.New(cfg.CacheSize)
+	}
 
 	ok, err := db.flock.TryLock()
 	if err != nil {
@@ -505,19 +788,44 @@ func Open(path string, options ...Option) (DB, error) {
 		return db, nil
 	}
 
+	// Release the lock if the database can't be opened
+	opened := false
+	defer func() {
+		if !opened {
+			db.flock.Unlock()
+		}
+	}()
+
+	// Files being written atomically when crashing are left behind
+	if err := vfs.RemoveTemp(fs, path); err != nil {
+		return nil, err
+	}
+
 	if err := cfg.Save(configPath); err != nil {
 		return nil, err
 	}
 
 	if cfg.AutoRecovery {
-		if err := data.CheckAndRecover(path, cfg); err != nil {
-			return nil, fmt.Errorf("recovering database: %s", err)
+		start := time.Now()
+		err := data.CheckAndRecover(path, cfg)
+		db.observe(metrics.OpRecover, start, 0, 0, err)
+		if errors.Is(err, codec.ErrUnsupportedVersion) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recovering database: %w", err)
 		}
 	}
 	if err := db.reopen(false); err != nil {
 		return nil, err
 	}
 
+	if cfg.WriteBufferSize > 0 && cfg.WriteBufferInterval > 0 {
+		db.stop = make(chan struct{})
+		go db.flushEvery(cfg.WriteBufferInterval, db.stop)
+	}
+
+	opened = true
 	return db, nil
 }
 
@@ -527,26 +835,29 @@ func (b *bitcask) Path() string { return b.path }
 // Backup copies db directory to given path
 // it creates path if it does not exist
 func (b *bitcask) Backup(path string) error {
-	if !internal.Exists(path) {
-		if err := os.MkdirAll(path, b.config.DirMode); err != nil {
+	if err := b.state.Load().current.Flush(); err != nil {
+		return err
+	}
+	if !internal.Exists(b.fs, path) {
+		if err := b.fs.MkdirAll(path, b.config.DirMode); err != nil {
 			return err
 		}
 	}
-	return internal.Copy(b.path, path, []string{lockfile})
+	return internal.Copy(b.fs, b.path, b.fs, path, []string{lockfile})
 }
 
 // saveIndex saves index currently in memory to disk
 func (b *bitcask) saveIndexes() error {
-	return b.indexer.Save(b.trie, filepath.Join(b.path, "index"))
+	return b.indexer.Save(b.trie, filepath.Join(b.path, "index"), b.config.FileMode)
 }
 
 // saveMetadata saves metadata into disk
 func (b *bitcask) saveMetadata() error {
-	return b.metadata.Save(filepath.Join(b.path, "meta.json"), b.config.FileMode)
+	return b.metadata.Save(b.fs, filepath.Join(b.path, "meta.json"), b.config.FileMode)
 }
 
-func loadDatafiles(path string, maxKeySize uint32, maxValueSize uint64, fileModeBeforeUmask os.FileMode) (datafiles map[int]data.Datafile, lastID int, err error) {
-	fns, err := internal.GetDatafiles(path)
+func loadDatafiles(fs vfs.FS, path string, maxKeySize uint32, maxValueSize uint64, fileModeBeforeUmask os.FileMode, opts ...data.Option) (datafiles map[int]data.Datafile, lastID int, err error) {
+	fns, err := internal.GetDatafiles(fs, path)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -559,10 +870,11 @@ func loadDatafiles(path string, maxKeySize uint32, maxValueSize uint64, fileMode
 	datafiles = make(map[int]data.Datafile, len(ids))
 	for _, id := range ids {
 		datafiles[id], err = data.NewOnDiskDatafile(
-			path, id, true,
+			fs, path, id, true,
 			maxKeySize,
 			maxValueSize,
 			fileModeBeforeUmask,
+			opts...,
 		)
 		if err != nil {
 			return
@@ -590,59 +902,164 @@ func getSortedDatafiles(datafiles map[int]data.Datafile) []data.Datafile {
 
 // loadIndexes loads index from disk to memory. If index is not available or partially available (last bitcask process crashed)
 // then it iterates over last datafile and construct index
-func loadIndexes(b *bitcask, dataFiles map[int]data.Datafile, lastID int) (*iradix.Tree[internal.Item], error) {
-	t, err := b.indexer.Load(filepath.Join(b.path, "index"), b.config.MaxKeySize)
+func loadIndexes(b *bitcask, dataFiles map[int]data.Datafile, lastID int) (keydir.Keydir, error) {
+	log := b.config.Log()
+
+	t, err := b.indexer.Load(filepath.Join(b.path, "index"), b.config.MaxKeySize, b.newKeydir())
 	if err != nil {
-		return loadIndexFromDatafiles(dataFiles)
+		if errors.Is(err, index.ErrUnsupportedVersion) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, err)
+		}
+		if os.IsNotExist(err) {
+			log.Debug("no index found, rebuilding index from datafiles", "path", b.path)
+		} else {
+			log.Warn("error loading index, rebuilding index from datafiles", "path", b.path, "error", err)
+		}
+		return b.rebuildIndex(dataFiles)
 	}
 	if !b.metadata.IndexUpToDate {
-		return loadIndexFromDatafiles(dataFiles)
+		log.Info("index is not up to date, rebuilding index from datafiles", "path", b.path)
+		return b.rebuildIndex(dataFiles)
 	}
 	return t, err
 }
 
-func loadIndexFromDatafiles(dataFiles map[int]data.Datafile) (t *iradix.Tree[internal.Item], err error) {
-	t = iradix.New[internal.Item]()
+// rebuildIndex rebuilds the index from the datafiles
+func (b *bitcask) rebuildIndex(dataFiles map[int]data.Datafile) (keydir.Keydir, error) {
+	start := time.Now()
+	t, err := loadIndexFromDatafiles(b.newKeydir(), dataFiles, b.config.RebuildProgress)
+	if err != nil {
+		return nil, err
+	}
+	b.config.Log().Info("rebuilt index from datafiles", "path", b.path, "datafiles", len(dataFiles), "keys", t.Len(), "duration", time.Since(start))
+	return t, nil
+}
+
+// indexEntry is the key of an entry read from a datafile with its item
+type indexEntry struct {
+	key       []byte
+	item      internal.Item
+	tombstone bool
+}
 
+// datafileIndex is the result of reading the keys of a datafile
+type datafileIndex struct {
+	entries []indexEntry
+	err     error
+}
+
+// loadIndexFromDatafiles loads the keys of the datafiles into t. The keys of
+// several datafiles are read in parallel and applied in file id order so the
+// latest entry of a key wins, progress, if any, is called after each
+// datafile.
+func loadIndexFromDatafiles(t keydir.Keydir, dataFiles map[int]data.Datafile, progress func(done, total int)) (keydir.Keydir, error) {
 	sortedDatafiles := getSortedDatafiles(dataFiles)
-	for _, df := range sortedDatafiles {
-		t, err = loadIndexFromDatafile(t, df)
-		if err != nil {
-			return t, err
+	workers := min(runtime.GOMAXPROCS(0), len(sortedDatafiles))
+
+	// At most 2*workers datafiles are read ahead of the one being applied
+	results := make([]chan datafileIndex, len(sortedDatafiles))
+	for i := range results {
+		results[i] = make(chan datafileIndex, 1)
+	}
+	slots := make(chan struct{}, 2*workers)
+	jobs := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(jobs)
+		for i := range sortedDatafiles {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
 		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				entries, err := readDatafileIndex(sortedDatafiles[i])
+				results[i] <- datafileIndex{entries, err}
+			}
+		}()
 	}
 
-	return
+	return keydir.Load(t, func(w keydir.Writer) error {
+		for i := range sortedDatafiles {
+			result := <-results[i]
+			<-slots
+			if result.err != nil {
+				return result.err
+			}
+
+			for _, e := range result.entries {
+				if e.tombstone {
+					w.Delete(e.key)
+				} else {
+					w.Insert(e.key, e.item)
+				}
+			}
+
+			if progress != nil {
+				progress(i+1, len(sortedDatafiles))
+			}
+		}
+		return nil
+	})
 }
 
-func loadIndexFromDatafile(t *iradix.Tree[internal.Item], df data.Datafile) (*iradix.Tree[internal.Item], error) {
-	var offset int64
+// readDatafileIndex reads the keys of the entries of a datafile in order
+func readDatafileIndex(df data.Datafile) ([]indexEntry, error) {
+	var entries []indexEntry
+
+	offset := codec.DataOffset(df.Version())
 	for {
-		e, n, err := df.Read()
+		key, size, n, err := df.ReadKey()
 		if err != nil {
 			if err == io.EOF {
-				break
+				return entries, nil
 			}
-			return t, err
+			return nil, err
 		}
 
 		// Tombstone value  (deleted key)
-		if len(e.Value) == 0 {
-			t, _, _ = t.Delete(e.Key)
-			offset += n
-			continue
-		}
-		item := internal.Item{FileID: df.FileID(), Offset: offset, Size: n}
-		t, _, _ = t.Insert(e.Key, item)
+		entries = append(entries, indexEntry{
+			key:       key,
+			item:      internal.Item{FileID: df.FileID(), Offset: offset, Size: n},
+			tombstone: size == 0,
+		})
 		offset += n
 	}
-	return t, nil
 }
 
-func loadMetadata(path string) (*metadata.MetaData, error) {
-	if !internal.Exists(filepath.Join(path, "meta.json")) {
+// newKeydir returns an empty keydir of the configured mode
+func (b *bitcask) newKeydir() keydir.Keydir {
+	// The mode is validated when the database is opened
+	kd, _ := keydir.New(keydir.Mode(b.config.Keydir))
+	return kd
+}
+
+func loadMetadata(fs vfs.FS, path string) (*metadata.MetaData, error) {
+	if !internal.Exists(fs, filepath.Join(path, "meta.json")) {
 		meta := new(metadata.MetaData)
+
+		// New databases are created in the current format
+		dfs, err := internal.GetDatafiles(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(dfs) == 0 {
+			meta.Version = FormatVersion
+		}
+
 		return meta, nil
 	}
-	return metadata.Load(filepath.Join(path, "meta.json"))
+	return metadata.Load(fs, filepath.Join(path, "meta.json"))
 }
@@ -2,9 +2,11 @@ package bitcask
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -12,11 +14,17 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/codec"
 	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/internal/data"
+	"go.mills.io/bitcask/v2/metrics"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 type sortByteArrays [][]byte
@@ -221,19 +229,19 @@ func TestMetadata(t *testing.T) {
 		assert.NoError(t, db.Put(Key("hello"), Value("world")))
 		stats, err := db.Stats()
 		require.NoError(t, err)
-		assert.Equal(t, int64(26), stats.Reclaimable)
+		assert.Equal(t, int64(30), stats.Reclaimable)
 	})
 	t.Run("ReclaimableAfterDelete", func(t *testing.T) {
 		assert.NoError(t, db.Delete([]byte("hello")))
 		stats, err := db.Stats()
 		require.NoError(t, err)
-		assert.Equal(t, int64(73), stats.Reclaimable)
+		assert.Equal(t, int64(85), stats.Reclaimable)
 	})
 	t.Run("ReclaimableAfterNonExistingDelete", func(t *testing.T) {
 		assert.NoError(t, db.Delete([]byte("hello1")))
 		stats, err := db.Stats()
 		require.NoError(t, err)
-		assert.Equal(t, int64(73), stats.Reclaimable)
+		assert.Equal(t, int64(85), stats.Reclaimable)
 	})
 	t.Run("ReclaimableAfterMerge", func(t *testing.T) {
 		assert.NoError(t, db.Merge())
@@ -829,6 +837,29 @@ func TestFileFileModeBeforeUmask(t *testing.T) {
 			})
 			assert.NoError(t, err)
 		})
+
+		t.Run("Index FileModeBeforeUmask is set via options", func(t *testing.T) {
+			testDir := t.TempDir()
+			testMode := os.FileMode(0640)
+
+			db, err := Open(testDir, WithFileMode(testMode))
+			require.NoError(t, err)
+			require.NoError(t, db.Put([]byte("foo"), []byte("bar")))
+			require.NoError(t, db.Close())
+
+			// infer umask from a file created with allPerms
+			aFilePath := filepath.Join(t.TempDir(), "temp")
+			f, err := os.OpenFile(aFilePath, os.O_CREATE, os.ModePerm)
+			require.NoError(t, err)
+			f.Close()
+			fileStat, err := os.Stat(aFilePath)
+			require.NoError(t, err)
+			umask := os.ModePerm ^ (fileStat.Mode() & os.ModePerm)
+
+			info, err := os.Stat(filepath.Join(testDir, "index"))
+			require.NoError(t, err)
+			assert.Equal(t, testMode&^umask, info.Mode()&os.ModePerm)
+		})
 	})
 }
 
@@ -895,7 +926,7 @@ func TestMerge(t *testing.T) {
 
 	t.Run("Setup", func(t *testing.T) {
 		t.Run("Open", func(t *testing.T) {
-			db, err = Open(testDir, WithMaxDatafileSize(32))
+			db, err = Open(testDir, WithMaxDatafileSize(40))
 			assert.NoError(t, err)
 		})
 
@@ -946,6 +977,430 @@ func TestMerge(t *testing.T) {
 	})
 }
 
+func TestObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	var (
+		mu     sync.Mutex
+		events []metrics.Event
+	)
+	observer := metrics.ObserverFunc(func(e metrics.Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	last := func(op metrics.Op) (metrics.Event, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		var (
+			event metrics.Event
+			n     int
+		)
+		for _, e := range events {
+			if e.Op == op {
+				event = e
+				n++
+			}
+		}
+		return event, n
+	}
+
+	db, err := Open(testDir, WithMaxDatafileSize(64), WithObserver(observer))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, n := last(metrics.OpRecover)
+	assert.Equal(1, n)
+
+	t.Run("Put", func(t *testing.T) {
+		assert.NoError(db.Put([]byte("foo"), []byte("bar")))
+		e, n := last(metrics.OpPut)
+		assert.Equal(1, n)
+		assert.Equal(int64(6), e.Bytes)
+		assert.Equal(1, e.Keys)
+		assert.NoError(e.Err)
+
+		e, n = last(metrics.OpWriteBatch)
+		assert.Equal(1, n)
+		assert.Equal(1, e.Keys)
+		assert.True(e.Bytes > 6)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		_, err := db.Get([]byte("foo"))
+		assert.NoError(err)
+		e, _ := last(metrics.OpGet)
+		assert.Equal(int64(3), e.Bytes)
+		assert.Equal(1, e.Keys)
+
+		_, err = db.Get([]byte("missing"))
+		assert.ErrorIs(err, ErrKeyNotFound)
+		e, n := last(metrics.OpGet)
+		assert.Equal(2, n)
+		assert.Equal(0, e.Keys)
+		assert.NoError(e.Err)
+	})
+
+	t.Run("PutError", func(t *testing.T) {
+		assert.ErrorIs(db.Put(nil, []byte("bar")), ErrEmptyKey)
+		e, _ := last(metrics.OpPut)
+		assert.ErrorIs(e.Err, ErrEmptyKey)
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.NoError(db.Put([]byte("foo"), []byte("bar")))
+		}
+		e, n := last(metrics.OpRotate)
+		assert.True(n > 0)
+		assert.True(e.Bytes >= 64)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.NoError(db.Put([]byte("bar"), []byte("baz")))
+		assert.NoError(db.Delete([]byte("bar")))
+		e, n := last(metrics.OpDelete)
+		assert.Equal(1, n)
+		assert.Equal(int64(3), e.Bytes)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		mu.Lock()
+		events = nil
+		mu.Unlock()
+
+		assert.NoError(db.Merge())
+		e, n := last(metrics.OpMerge)
+		assert.Equal(1, n)
+		assert.Equal(1, e.Keys)
+		assert.Equal(int64(6), e.Bytes)
+		assert.True(e.Duration > 0)
+
+		// the temporary database used to merge is not observed
+		_, n = last(metrics.OpPut)
+		assert.Equal(0, n)
+	})
+}
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	db, err := Open(testDir, WithLogger(logger))
+	require.NoError(t, err)
+	assert.Contains(buf.String(), "no index found")
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("foo%d", i)), []byte("bar")))
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		buf.Reset()
+		assert.NoError(db.Range([]byte("foo1"), []byte("foo3"), func(key Key) error { return nil }))
+		assert.Empty(buf.String())
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		buf.Reset()
+		assert.NoError(db.Merge())
+		assert.Contains(buf.String(), "msg=\"merging datafiles\"")
+		assert.Contains(buf.String(), "msg=\"merged datafiles\"")
+		assert.Contains(buf.String(), "keys=10")
+	})
+
+	require.NoError(t, db.Close())
+
+	t.Run("IndexRebuild", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(testDir, "index"), []byte("garbage"), 0600))
+
+		buf.Reset()
+		db, err := Open(testDir, WithLogger(logger))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Contains(buf.String(), "level=WARN msg=\"error loading index")
+		assert.Equal(10, db.Len())
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		require.NoError(t, db.Put([]byte("foo"), []byte("bar")))
+		require.NoError(t, db.Close())
+
+		// Corrupt the last inserted key
+		dfs, err := filepath.Glob(filepath.Join(testDir, "*.data"))
+		require.NoError(t, err)
+		sort.Strings(dfs)
+		fi, err := os.Stat(dfs[len(dfs)-1])
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(dfs[len(dfs)-1], fi.Size()-1))
+
+		buf.Reset()
+		db, err = Open(testDir, WithLogger(logger), WithAutoRecovery(true))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Contains(buf.String(), "level=WARN msg=\"recovered corrupted datafile")
+	})
+}
+
+func TestLegacyDatafile(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	writeLegacyDatafile(t, testDir, 0, "foo", "bar", "hello", "world")
+
+	db, err := Open(testDir)
+	require.NoError(t, err)
+
+	value, err := db.Get([]byte("foo"))
+	assert.NoError(err)
+	assert.Equal(Value("bar"), value)
+
+	// New entries are not appended to the legacy datafile
+	assert.NoError(db.Put([]byte("foo"), []byte("baz")))
+	data, err := os.ReadFile(filepath.Join(testDir, "000000001.data"))
+	require.NoError(t, err)
+	assert.True(bytes.HasPrefix(data, []byte("BCDF")))
+
+	report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+	assert.NoError(err)
+	assert.True(report.OK(), "%v", report.Problems)
+	require.NoError(t, db.Close())
+
+	db, err = Open(testDir)
+	require.NoError(t, err)
+	defer db.Close()
+
+	value, err = db.Get([]byte("foo"))
+	assert.NoError(err)
+	assert.Equal(Value("baz"), value)
+	value, err = db.Get([]byte("hello"))
+	assert.NoError(err)
+	assert.Equal(Value("world"), value)
+}
+
+func TestChecksumCoversKey(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	db, err := Open(testDir)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("foo"), []byte("bar")))
+	require.NoError(t, db.Close())
+
+	// Corrupt the key of the entry, the index still points to it
+	fn := filepath.Join(testDir, "000000000.data")
+	data, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	i := bytes.Index(data, []byte("foo"))
+	require.True(t, i > 0)
+	data[i] = 'g'
+	require.NoError(t, os.WriteFile(fn, data, 0600))
+
+	db, err = Open(testDir, WithAutoRecovery(false))
+	require.NoError(t, err)
+
+	_, err = db.Get([]byte("foo"))
+	assert.ErrorIs(t, err, ErrChecksumFailed)
+	require.NoError(t, db.Close())
+
+	// Recovery discards the corrupted entry
+	db, err = Open(testDir, WithAutoRecovery(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Get([]byte("foo"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, 0, db.Len())
+}
+
+func TestRecovery(t *testing.T) {
+	setup := func(t *testing.T) string {
+		testDir := t.TempDir()
+
+		db, err := Open(testDir, WithMaxDatafileSize(128))
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, db.Put([]byte(fmt.Sprintf("foo%d", i)), []byte("bar")))
+		}
+		require.NoError(t, db.Close())
+
+		return testDir
+	}
+
+	// corrupt flips the value of the given key in the given datafile
+	corrupt := func(t *testing.T, fn string, key string) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		i := bytes.Index(data, []byte(key))
+		require.True(t, i > 0)
+		data[i+len(key)] ^= 0xff
+		require.NoError(t, os.WriteFile(fn, data, 0600))
+	}
+
+	t.Run("Resync", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir := setup(t)
+		dfs, err := internal.GetDatafiles(vfs.OS, testDir)
+		require.NoError(t, err)
+		last := dfs[len(dfs)-1]
+
+		raw, err := os.ReadFile(last)
+		require.NoError(t, err)
+		keys := bytes.Count(raw, []byte("foo"))
+		require.True(t, keys > 2)
+
+		// Corrupt the first entry of the last datafile, the following
+		// entries must survive the recovery
+		first := string(raw[codec.HeaderSize+codec.PrefixSize(codec.CurrentVersion) : codec.HeaderSize+codec.PrefixSize(codec.CurrentVersion)+4])
+		corrupt(t, last, first)
+
+		db, err := Open(testDir, WithAutoRecovery(true))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(9, db.Len())
+		_, err = db.Get([]byte(first))
+		assert.ErrorIs(err, ErrKeyNotFound)
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("foo%d", i)
+			if key == first {
+				continue
+			}
+			val, err := db.Get([]byte(key))
+			assert.NoError(err)
+			assert.Equal(Value("bar"), val)
+		}
+
+		quarantined, err := filepath.Glob(filepath.Join(testDir, data.QuarantineDir, "*"))
+		require.NoError(t, err)
+		assert.Equal([]string{filepath.Join(testDir, data.QuarantineDir, filepath.Base(last)+".8")}, quarantined)
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.True(report.OK(), "%v", report.Problems)
+	})
+
+	t.Run("Large", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// Datafiles are scanned through a window much smaller than this one
+		testDir := t.TempDir()
+		value := bytes.Repeat([]byte("v"), 4096)
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, db.Put([]byte(fmt.Sprintf("key%03d", i)), value))
+		}
+		require.NoError(t, db.Close())
+
+		// Corrupt the sizes of an entry in the middle of the datafile
+		fn := filepath.Join(testDir, "000000000.data")
+		raw, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		i := bytes.Index(raw, []byte("key050"))
+		require.True(t, i > 0)
+		copy(raw[i-codec.PrefixSize(codec.CurrentVersion):], "corrupted")
+		require.NoError(t, os.WriteFile(fn, raw, 0600))
+
+		db, err = Open(testDir, WithAutoRecovery(true))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(99, db.Len())
+		assert.False(db.Has([]byte("key050")))
+		for i := 0; i < 100; i++ {
+			if i == 50 {
+				continue
+			}
+			val, err := db.Get([]byte(fmt.Sprintf("key%03d", i)))
+			assert.NoError(err)
+			assert.Equal(Value(value), val)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir := setup(t)
+		fn := filepath.Join(testDir, "000000000.data")
+		corrupt(t, fn, "foo1")
+		before, err := os.ReadFile(fn)
+		require.NoError(t, err)
+
+		cfg, err := config.Load(vfs.OS, filepath.Join(testDir, "config.json"))
+		require.NoError(t, err)
+
+		// Only the last datafile is checked by default
+		report, err := data.Recover(testDir, cfg, data.RecoverOptions{})
+		require.NoError(t, err)
+		assert.Empty(report.Regions)
+
+		report, err = data.Recover(testDir, cfg, data.RecoverOptions{All: true, DryRun: true})
+		require.NoError(t, err)
+		assert.True(report.Datafiles > 1)
+		assert.Equal([]data.LostKey{{Key: "foo1", Datafile: "000000000.data", Offset: int64(codec.HeaderSize + codec.MetaInfoSize + 7)}}, report.LostKeys)
+		if assert.Len(report.Regions, 1) {
+			assert.Equal(int64(codec.MetaInfoSize+7), report.Regions[0].Size)
+			assert.Empty(report.Regions[0].Quarantine)
+		}
+		after, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		assert.Equal(before, after)
+
+		report, err = data.Recover(testDir, cfg, data.RecoverOptions{All: true})
+		require.NoError(t, err)
+		assert.Equal([]string{"000000000.data"}, report.Recovered)
+		offset := int64(codec.HeaderSize + codec.MetaInfoSize + 7)
+		assert.Equal(filepath.Join(data.QuarantineDir, fmt.Sprintf("000000000.data.%d", offset)), report.Regions[0].Quarantine)
+		assert.NoFileExists(filepath.Join(testDir, "index"))
+
+		quarantined, err := os.ReadFile(filepath.Join(testDir, report.Regions[0].Quarantine))
+		require.NoError(t, err)
+		assert.Equal(before[offset:offset+report.Regions[0].Size], quarantined)
+
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(9, db.Len())
+		assert.False(db.Has([]byte("foo1")))
+	})
+
+	t.Run("Superseded", func(t *testing.T) {
+		testDir := setup(t)
+		corrupt(t, filepath.Join(testDir, "000000000.data"), "foo1")
+
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		require.NoError(t, db.Put([]byte("foo1"), []byte("baz")))
+		require.NoError(t, db.Close())
+
+		cfg, err := config.Load(vfs.OS, filepath.Join(testDir, "config.json"))
+		require.NoError(t, err)
+
+		// The key has a newer valid entry so isn't lost
+		report, err := data.Recover(testDir, cfg, data.RecoverOptions{All: true})
+		require.NoError(t, err)
+		assert.Len(t, report.Regions, 1)
+		assert.Empty(t, report.LostKeys)
+	})
+}
+
 func TestPutEdgeCases(t *testing.T) {
 	t.Run("EmptyValue", func(t *testing.T) {
 		testDir, err := os.MkdirTemp("", "bitcask")
@@ -1424,6 +1879,9 @@ func BenchmarkPut(b *testing.B) {
 		"Sync": {
 			WithSyncWrites(true),
 		},
+		"Buffered": {
+			WithWriteBuffer(1<<16, 100*time.Millisecond),
+		},
 	}
 
 	for name, options := range variants {
@@ -1509,3 +1967,426 @@ func BenchmarkScan(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkParallelGetPut measures Get while a writer keeps writing, run
+// it with -cpu to compare the number of readers
+func BenchmarkParallelGetPut(b *testing.B) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	variants := map[string][]Option{
+		"NoSync": {
+			WithSyncWrites(false),
+		},
+		"Sync": {
+			WithSyncWrites(true),
+		},
+	}
+
+	for name, options := range variants {
+		b.Run(name, func(b *testing.B) {
+			testDir, err := os.MkdirTemp(currentDir, "bitcask_bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(testDir)
+
+			db, err := Open(testDir, options...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			value := []byte(strings.Repeat(" ", 128))
+			for i := 0; i < 1000; i++ {
+				if err := db.Put([]byte(fmt.Sprintf("key%d", i)), value); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			done := make(chan struct{})
+			writer := make(chan error)
+			go func() {
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						writer <- nil
+						return
+					default:
+					}
+					if err := db.Put([]byte(fmt.Sprintf("key%d", i%1000)), value); err != nil {
+						writer <- err
+						return
+					}
+				}
+			}()
+
+			b.SetBytes(int64(len(value)))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := db.Get([]byte(fmt.Sprintf("key%d", i%1000))); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+			b.StopTimer()
+
+			close(done)
+			if err := <-writer; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	db, err := Open(testDir, WithMaxDatafileSize(256), WithSyncWrites(true), WithCacheSize(1<<10))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value("bar")))
+	}
+
+	// Readers must see every key while datafiles are rotated and merged
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				val, err := db.Get(Key(fmt.Sprintf("foo%d", i%10)))
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, Value("bar"), val)
+				assert.Equal(t, 10, db.Len())
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i%10)), Value("bar")))
+		if i%25 == 0 {
+			require.NoError(t, db.Merge())
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestConcurrentSyncClose(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	db, err := Open(testDir)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value("bar")))
+	}
+
+	// Syncs and Close save the metadata concurrently
+	var wg sync.WaitGroup
+	for s := 0; s < 4; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.NoError(t, db.Sync())
+			}
+		}()
+	}
+	require.NoError(t, db.Close())
+	wg.Wait()
+
+	tmps, err := filepath.Glob(filepath.Join(testDir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmps)
+
+	db, err = Open(testDir)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 10, db.Len())
+}
+
+func TestRebuildIndex(t *testing.T) {
+	for _, mode := range []string{KeydirRadix, KeydirHashed} {
+		t.Run(mode, func(t *testing.T) {
+			testDir, err := os.MkdirTemp("", "bitcask")
+			require.NoError(t, err)
+			defer os.RemoveAll(testDir)
+
+			db, err := Open(testDir, WithKeydir(mode), WithMaxDatafileSize(256))
+			require.NoError(t, err)
+
+			// Keys are overwritten and deleted across datafiles
+			expected := make(map[string]string)
+			for i := 0; i < 300; i++ {
+				key := fmt.Sprintf("foo%d", i%50)
+				if i%7 == 0 {
+					require.NoError(t, db.Delete(Key(key)))
+					delete(expected, key)
+					continue
+				}
+				value := fmt.Sprintf("bar%d", i)
+				require.NoError(t, db.Put(Key(key), Value(value)))
+				expected[key] = value
+			}
+			require.NoError(t, db.Close())
+			require.NoError(t, os.Remove(filepath.Join(testDir, "index")))
+
+			var progress []int
+			total := 0
+			db, err = Open(testDir, WithKeydir(mode), WithRebuildProgress(func(done, n int) {
+				progress = append(progress, done)
+				total = n
+			}))
+			require.NoError(t, err)
+			defer db.Close()
+
+			assert.Greater(t, total, 1)
+			require.Len(t, progress, total)
+			for i, done := range progress {
+				assert.Equal(t, i+1, done)
+			}
+
+			assert.Equal(t, len(expected), db.Len())
+			for key, value := range expected {
+				val, err := db.Get(Key(key))
+				require.NoError(t, err)
+				assert.Equal(t, Value(value), val)
+			}
+		})
+	}
+}
+
+// adviceFS records the advice given for the files of the wrapped FS
+type adviceFS struct {
+	vfs.FS
+
+	mu      sync.Mutex
+	advised map[string][]vfs.Advice
+}
+
+func (fs *adviceFS) Advise(f vfs.File, advice vfs.Advice) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name := filepath.Base(f.Name())
+	fs.advised[name] = append(fs.advised[name], advice)
+	return vfs.Advise(fs.FS, f, advice)
+}
+
+func (fs *adviceFS) advice(name string) []vfs.Advice {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.advised[name]
+}
+
+func TestFileHints(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	fs := &adviceFS{FS: vfs.OS, advised: make(map[string][]vfs.Advice)}
+	opts := []Option{
+		WithFS(fs),
+		WithMaxDatafileSize(1 << 10),
+		WithPreallocate(true),
+		WithDatasync(true),
+		WithFadvise(true),
+		WithSyncWrites(true),
+	}
+
+	db, err := Open(testDir, opts...)
+	require.NoError(t, err)
+
+	value := Value(strings.Repeat("x", 100))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), value))
+	}
+
+	// The preallocated active datafile keeps the size of the entries written
+	fns, err := filepath.Glob(filepath.Join(testDir, "*.data"))
+	require.NoError(t, err)
+	require.Greater(t, len(fns), 1)
+	stat, err := os.Stat(fns[len(fns)-1])
+	require.NoError(t, err)
+	assert.Less(t, stat.Size(), int64(1<<10))
+	require.NoError(t, db.Close())
+
+	db, err = Open(testDir, opts...)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		val, err := db.Get(Key(fmt.Sprintf("foo%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, value, val)
+	}
+
+	// Readonly datafiles are read sequentially to rebuild the index
+	for _, fn := range fns {
+		assert.Contains(t, fs.advice(filepath.Base(fn)), vfs.AdviceSequential)
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		require.NoError(t, db.Put(Key("bar"), Value("baz")))
+		require.NoError(t, db.Merge())
+
+		val, err := db.Get(Key("bar"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("baz"), val)
+
+		// The datafiles merged are prefetched
+		for _, fn := range fns {
+			assert.Contains(t, fs.advice(filepath.Base(fn)), vfs.AdviceWillNeed)
+		}
+	})
+}
+
+func TestWriteBuffer(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	datafileSize := func(id int) int64 {
+		stat, err := os.Stat(filepath.Join(testDir, fmt.Sprintf("%09d.data", id)))
+		require.NoError(t, err)
+		return stat.Size()
+	}
+
+	db, err := Open(testDir, WithWriteBuffer(1<<10, 0))
+	require.NoError(t, err)
+
+	size := datafileSize(0)
+	require.NoError(t, db.Put(Key("foo"), Value("bar")))
+	assert.Equal(t, size, datafileSize(0))
+
+	t.Run("Get", func(t *testing.T) {
+		val, err := db.Get(Key("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("bar"), val)
+
+		// Transactions read the active datafile reopened readonly
+		val, err = db.Transaction().Get(Key("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("bar"), val)
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		value := Value(strings.Repeat("x", 600))
+		require.NoError(t, db.Put(Key("big1"), value))
+		require.NoError(t, db.Put(Key("big2"), value))
+		assert.Greater(t, datafileSize(0), size)
+
+		val, err := db.Get(Key("big1"))
+		require.NoError(t, err)
+		assert.Equal(t, value, val)
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		require.NoError(t, db.Put(Key("hello"), Value("world")))
+		size := datafileSize(0)
+		require.NoError(t, db.Sync())
+		assert.Greater(t, datafileSize(0), size)
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		require.NoError(t, db.Put(Key("foo"), Value("baz")))
+		require.NoError(t, db.Close())
+
+		db, err = Open(testDir, WithWriteBuffer(1<<10, 10*time.Millisecond), WithMaxDatafileSize(1<<11))
+		require.NoError(t, err)
+
+		val, err := db.Get(Key("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("baz"), val)
+	})
+
+	t.Run("Interval", func(t *testing.T) {
+		id := db.(*bitcask).state.Load().current.FileID()
+		size := datafileSize(id)
+		require.NoError(t, db.Put(Key("foo"), Value("qux")))
+		assert.Eventually(t, func() bool {
+			return datafileSize(id) > size
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value(strings.Repeat("x", 100))))
+		}
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		require.NoError(t, err)
+		assert.True(t, report.OK(), report.Problems)
+
+		for i := 0; i < 50; i++ {
+			val, err := db.Get(Key(fmt.Sprintf("foo%d", i)))
+			require.NoError(t, err)
+			assert.Equal(t, Value(strings.Repeat("x", 100)), val)
+		}
+	})
+
+	require.NoError(t, db.Close())
+}
+
+func TestIndexFormat(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	indexMagic := func() string {
+		data, err := os.ReadFile(filepath.Join(testDir, "index"))
+		require.NoError(t, err)
+		return string(data[:4])
+	}
+
+	db, err := Open(testDir, WithIndexFormat(IndexFormatBlock))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value("bar")))
+	}
+	require.NoError(t, db.Close())
+	assert.Equal(t, "BCIB", indexMagic())
+
+	t.Run("Persisted", func(t *testing.T) {
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		assert.Equal(t, 10, db.Len())
+		require.NoError(t, db.Close())
+		assert.Equal(t, "BCIB", indexMagic())
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		db, err := Open(testDir, WithIndexFormat(IndexFormatStream))
+		require.NoError(t, err)
+		assert.Equal(t, 10, db.Len())
+		require.NoError(t, db.Close())
+		assert.Equal(t, "BCIX", indexMagic())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := Open(testDir, WithIndexFormat("foo"))
+		assert.ErrorIs(t, err, ErrInvalidIndexFormat)
+	})
+}
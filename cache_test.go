@@ -0,0 +1,75 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	db, err := Open(testDir, WithCacheSize(1<<20), WithMaxDatafileSize(128))
+	require.NoError(t, err)
+	defer db.Close()
+
+	get := func(key string) Value {
+		val, err := db.Get(Key(key))
+		require.NoError(t, err)
+		return val
+	}
+
+	require.NoError(t, db.Put(Key("foo"), Value("bar")))
+	assert.Equal(t, Value("bar"), get("foo"))
+	assert.Equal(t, Value("bar"), get("foo"))
+
+	stats, err := db.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.CacheHits)
+	assert.Equal(t, uint64(1), stats.CacheMisses)
+
+	t.Run("Copy", func(t *testing.T) {
+		val := get("foo")
+		val[0] = 'x'
+		assert.Equal(t, Value("bar"), get("foo"))
+	})
+
+	t.Run("WriteBatch", func(t *testing.T) {
+		batch := db.Batch()
+		_, err := batch.Put(Key("foo"), Value("baz"))
+		require.NoError(t, err)
+		require.NoError(t, db.WriteBatch(batch))
+		assert.Equal(t, Value("baz"), get("foo"))
+
+		require.NoError(t, db.Delete(Key("foo")))
+		_, err = db.Get(Key("foo"))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		require.NoError(t, db.Put(Key("hello"), Value("world")))
+		tx := db.Transaction()
+		require.NoError(t, db.Put(Key("hello"), Value("bitcask")))
+		assert.Equal(t, Value("bitcask"), get("hello"))
+
+		// The transaction still reads the value of its snapshot
+		val, err := tx.Get(Key("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("world"), val)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, db.Put(Key("foo"), Value{byte('a' + i)}))
+			assert.Equal(t, Value{byte('a' + i)}, get("foo"))
+		}
+		require.NoError(t, db.Merge())
+
+		assert.Equal(t, Value("j"), get("foo"))
+		assert.Equal(t, Value("bitcask"), get("hello"))
+	})
+}
@@ -0,0 +1,351 @@
+// Package client implements a client for bitcaskd, the Bitcask server, which
+// provides the same Keys interface as an embedded database so code can use
+// either a local bitcask.DB or a remote server.
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"go.mills.io/bitcask/v2"
+)
+
+// ErrClientClosed is the error returned when using a closed client
+var ErrClientClosed = errors.New("error: client closed")
+
+// errors returned by the server that are mapped back to the database errors
+var knownErrors = []error{
+	bitcask.ErrKeyNotFound,
+	bitcask.ErrKeyTooLarge,
+	bitcask.ErrEmptyKey,
+	bitcask.ErrValueTooLarge,
+	bitcask.ErrChecksumFailed,
+	bitcask.ErrDatabaseReadonly,
+	bitcask.ErrMergeInProgress,
+	bitcask.ErrUnordered,
+}
+
+// Client is a client for a bitcaskd server. It is safe for concurrent use and
+// maintains a pool of connections to the server.
+type Client struct {
+	addr string
+	cfg  *config
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+var _ bitcask.Keys = (*Client)(nil)
+
+// New returns a new client connected to the server at addr
+func New(addr string, options ...Option) (*Client, error) {
+	cfg := defaultConfig()
+	for _, opt := range options {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Client{addr: addr, cfg: cfg}
+
+	// Connect eagerly so an unreachable server or bad credentials are
+	// reported here rather than on first use.
+	cn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.put(cn)
+
+	return c, nil
+}
+
+func (c *Client) dial() (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.dialTimeout}
+
+	var (
+		nc  net.Conn
+		err error
+	)
+	if c.cfg.tlsConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, c.cfg.network, c.addr, c.cfg.tlsConfig)
+	} else {
+		nc, err = dialer.Dial(c.cfg.network, c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cn := newConn(nc)
+
+	if c.cfg.password != "" {
+		args := [][]byte{[]byte("AUTH")}
+		if c.cfg.user != "" {
+			args = append(args, []byte(c.cfg.user))
+		}
+		args = append(args, []byte(c.cfg.password))
+
+		cn.setDeadline(c.cfg.dialTimeout)
+		cn.writeCommand(args...)
+		err := cn.flush()
+		if err == nil {
+			var reply interface{}
+			if reply, err = cn.readReply(); err == nil {
+				if e, ok := reply.(ServerError); ok {
+					err = e
+				}
+			}
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// get returns an idle connection from the pool or a new connection
+func (c *Client) get() (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dial()
+}
+
+// put returns a connection to the pool, or closes it if it can't be reused
+// or the pool is full.
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cn.broken || c.closed || len(c.idle) >= c.cfg.poolSize {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// do sends one or more commands in a single round trip and returns their
+// replies.
+func (c *Client) do(cmds ...[][]byte) ([]interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.put(cn)
+
+	cn.setDeadline(c.cfg.timeout)
+	for _, args := range cmds {
+		cn.writeCommand(args...)
+	}
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		if replies[i], err = cn.readReply(); err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// call sends a single command and returns its reply or the error replied
+func (c *Client) call(args ...[]byte) (interface{}, error) {
+	replies, err := c.do(args)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(ServerError); ok {
+		return nil, serverError(e)
+	}
+	return replies[0], nil
+}
+
+// serverError maps an error replied by the server to the database error it
+// was caused by if known.
+func serverError(e ServerError) error {
+	msg := strings.TrimPrefix(string(e), "ERR ")
+	for _, err := range knownErrors {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return e
+}
+
+// Close closes all idle connections, connections in use are closed when
+// returned to the pool.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	var err error
+	for _, cn := range c.idle {
+		if e := cn.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.idle = nil
+
+	return err
+}
+
+// Has returns true if the key exists in the database, false otherwise.
+func (c *Client) Has(key bitcask.Key) bool {
+	reply, err := c.call([]byte("EXISTS"), key)
+	if err != nil {
+		return false
+	}
+	n, _ := reply.(int64)
+	return n > 0
+}
+
+// Get fetches value for a key
+func (c *Client) Get(key bitcask.Key) (bitcask.Value, error) {
+	reply, err := c.call([]byte("GET"), key)
+	if err != nil {
+		return nil, err
+	}
+	return getValue(reply)
+}
+
+func getValue(reply interface{}) (bitcask.Value, error) {
+	if value, ok := reply.([]byte); ok {
+		return value, nil
+	}
+	return nil, bitcask.ErrKeyNotFound
+}
+
+// Put stores the key and value in the database.
+func (c *Client) Put(key bitcask.Key, value bitcask.Value) error {
+	_, err := c.call([]byte("SET"), key, value)
+	return err
+}
+
+// Delete deletes the named key.
+func (c *Client) Delete(key bitcask.Key) error {
+	_, err := c.call([]byte("DEL"), key)
+	return err
+}
+
+// Scan performs a prefix scan of keys matching the given prefix and calling
+// the function `f` with the keys found. If the function returns an error
+// no further keys are processed and the first error is returned.
+func (c *Client) Scan(prefix bitcask.Key, f bitcask.KeyFunc) error {
+	reply, err := c.call([]byte("KEYS"), append(escapeGlob(prefix), '*'))
+	if err != nil {
+		return err
+	}
+
+	keys, _ := reply.([]interface{})
+	for _, key := range keys {
+		if key, ok := key.([]byte); ok {
+			if err := f(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// escapeGlob escapes the glob characters in s so it matches literally
+func escapeGlob(s []byte) []byte {
+	escaped := make([]byte, 0, len(s))
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, c)
+	}
+	return escaped
+}
+
+// Result is the result of a command sent in a Pipeline
+type Result struct {
+	// Value is the value fetched by Get, or nil for other commands
+	Value bitcask.Value
+
+	// Err is the error returned by the command, if any
+	Err error
+}
+
+// Pipeline queues commands to send them to the server in a single round
+// trip. Commands are not applied atomically.
+type Pipeline struct {
+	c    *Client
+	cmds [][][]byte
+}
+
+// Pipeline returns a new pipeline of commands to send to the server
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Get queues fetching the value of a key
+func (p *Pipeline) Get(key bitcask.Key) {
+	p.cmds = append(p.cmds, [][]byte{[]byte("GET"), key})
+}
+
+// Put queues storing the key and value
+func (p *Pipeline) Put(key bitcask.Key, value bitcask.Value) {
+	p.cmds = append(p.cmds, [][]byte{[]byte("SET"), key, value})
+}
+
+// Delete queues deleting the named key
+func (p *Pipeline) Delete(key bitcask.Key) {
+	p.cmds = append(p.cmds, [][]byte{[]byte("DEL"), key})
+}
+
+// Len returns the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec sends the queued commands to the server and returns their results in
+// the order they were queued. The pipeline is empty afterwards.
+func (p *Pipeline) Exec() ([]Result, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	replies, err := p.c.do(cmds...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(replies))
+	for i, reply := range replies {
+		if e, ok := reply.(ServerError); ok {
+			results[i].Err = serverError(e)
+			continue
+		}
+		if strings.EqualFold(string(cmds[i][0]), "GET") {
+			results[i].Value, results[i].Err = getValue(reply)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2"
+)
+
+func TestReadReply(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go server.Write([]byte("+OK\r\n-ERR oops\r\n:42\r\n$3\r\nfoo\r\n$-1\r\n*2\r\n$1\r\na\r\n*-1\r\n"))
+
+	cn := newConn(client)
+	for _, expected := range []interface{}{
+		"OK",
+		ServerError("ERR oops"),
+		int64(42),
+		[]byte("foo"),
+		nil,
+		[]interface{}{[]byte("a"), nil},
+	} {
+		reply, err := cn.readReply()
+		require.NoError(t, err)
+		assert.Equal(t, expected, reply)
+	}
+	assert.False(t, cn.broken)
+
+	go server.Write([]byte("?\r\n"))
+	_, err := cn.readReply()
+	assert.Error(t, err)
+	assert.True(t, cn.broken)
+}
+
+func TestServerError(t *testing.T) {
+	assert.Equal(t, bitcask.ErrKeyTooLarge, serverError(ServerError("ERR "+bitcask.ErrKeyTooLarge.Error())))
+	assert.Equal(t, bitcask.ErrUnordered, serverError(ServerError("ERR "+bitcask.ErrUnordered.Error())))
+	assert.Equal(t, ServerError("WRONGPASS nope"), serverError(ServerError("WRONGPASS nope")))
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, []byte(`foo`), escapeGlob([]byte(`foo`)))
+	assert.Equal(t, []byte(`a\*b\?c\[d\]e\\`), escapeGlob([]byte(`a*b?c[d]e\`)))
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultPoolSize is the default maximum number of idle connections
+	DefaultPoolSize = 10
+
+	// DefaultDialTimeout is the default timeout for connecting to the server
+	DefaultDialTimeout = 5 * time.Second
+
+	// DefaultTimeout is the default timeout for a round trip to the server
+	DefaultTimeout = 5 * time.Second
+)
+
+// config is the configuration of a Client
+type config struct {
+	network     string
+	user        string
+	password    string
+	tlsConfig   *tls.Config
+	poolSize    int
+	dialTimeout time.Duration
+	timeout     time.Duration
+}
+
+func defaultConfig() *config {
+	return &config{
+		network:     "tcp",
+		poolSize:    DefaultPoolSize,
+		dialTimeout: DefaultDialTimeout,
+		timeout:     DefaultTimeout,
+	}
+}
+
+// Option is a function that takes a config struct and modifies it
+type Option func(*config) error
+
+// WithNetwork sets the network of the server address, e.g: "unix" to connect
+// to a Unix socket. The default is "tcp".
+func WithNetwork(network string) Option {
+	return func(cfg *config) error {
+		cfg.network = network
+		return nil
+	}
+}
+
+// WithPassword authenticates connections as the default user
+func WithPassword(password string) Option {
+	return WithUser("", password)
+}
+
+// WithUser authenticates connections as the given user
+func WithUser(user, password string) Option {
+	return func(cfg *config) error {
+		cfg.user = user
+		cfg.password = password
+		return nil
+	}
+}
+
+// WithTLS connects to the server over TLS using the given configuration
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *config) error {
+		cfg.tlsConfig = tlsConfig
+		return nil
+	}
+}
+
+// WithPoolSize sets the maximum number of idle connections kept open for
+// reuse. Connections in use are not limited.
+func WithPoolSize(size int) Option {
+	return func(cfg *config) error {
+		if size < 0 {
+			return errors.New("error: pool size must not be negative")
+		}
+		cfg.poolSize = size
+		return nil
+	}
+}
+
+// WithDialTimeout sets the timeout for connecting (and authenticating) to the
+// server, zero means no timeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(cfg *config) error {
+		cfg.dialTimeout = timeout
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for a round trip to the server, i.e: sending a
+// command (or pipeline) and reading its reply, zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *config) error {
+		cfg.timeout = timeout
+		return nil
+	}
+}
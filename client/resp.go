@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ServerError is an error reply returned by the server
+type ServerError string
+
+func (e ServerError) Error() string { return string(e) }
+
+// conn is a connection to the server speaking RESP
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+	wr *bufio.Writer
+
+	// broken is set when the connection is in an unknown state (e.g: after
+	// a network error or timeout) and must not be reused
+	broken bool
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{Conn: nc, rd: bufio.NewReader(nc), wr: bufio.NewWriter(nc)}
+}
+
+// writeCommand buffers a command, call flush to send buffered commands
+func (c *conn) writeCommand(args ...[]byte) {
+	c.wr.WriteString("*")
+	c.wr.WriteString(strconv.Itoa(len(args)))
+	c.wr.WriteString("\r\n")
+	for _, arg := range args {
+		c.wr.WriteString("$")
+		c.wr.WriteString(strconv.Itoa(len(arg)))
+		c.wr.WriteString("\r\n")
+		c.wr.Write(arg)
+		c.wr.WriteString("\r\n")
+	}
+}
+
+func (c *conn) flush() error {
+	if err := c.wr.Flush(); err != nil {
+		c.broken = true
+		return err
+	}
+	return nil
+}
+
+// setDeadline sets the deadline of the next round trip, zero means none
+func (c *conn) setDeadline(timeout time.Duration) {
+	if timeout > 0 {
+		c.SetDeadline(time.Now().Add(timeout))
+	} else {
+		c.SetDeadline(time.Time{})
+	}
+}
+
+// readReply reads a reply which is one of: string (simple string),
+// ServerError, int64, []byte (bulk string), nil or []interface{} (array).
+func (c *conn) readReply() (interface{}, error) {
+	reply, err := c.parseReply()
+	if err != nil {
+		c.broken = true
+	}
+	return reply, err
+}
+
+func (c *conn) parseReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("error: empty reply from server")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return ServerError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.parseReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("error: unexpected reply %q from server", line)
+	}
+}
+
+func (c *conn) readLine() ([]byte, error) {
+	line, err := c.rd.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("error: malformed reply %q from server", line)
+	}
+	return line[:len(line)-2], nil
+}
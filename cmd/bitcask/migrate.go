@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"go.mills.io/bitcask/v2"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrates the Database to the current format",
+	Long: `This upgrades a Database created by an older version of bitcask to the
+current on-disk format by rewriting all Datafiles and the index. The Database
+is backed up first (to --backup, by default <path>.backup) which must not
+exist. The Database must not be in use by another process.`,
+	Args: cobra.ExactArgs(0),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("backup", cmd.Flags().Lookup("backup"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString("path")
+		backup := viper.GetString("backup")
+		if backup == "" {
+			backup = path + ".backup"
+		}
+
+		os.Exit(migrate(path, backup))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringP("backup", "b", "", "Path to back up the Database to before migrating it")
+}
+
+func migrate(path, backup string) int {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	if err := bitcask.Migrate(path, backup, bitcask.WithLogger(logger)); err != nil {
+		log.WithError(err).Error("error migrating database")
+		return 1
+	}
+
+	return 0
+}
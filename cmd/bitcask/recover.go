@@ -1,28 +1,37 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/gofrs/flock"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.mills.io/bitcask/v2"
-	"go.mills.io/bitcask/v2/internal"
-	"go.mills.io/bitcask/v2/internal/codec"
 	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/internal/data"
 	"go.mills.io/bitcask/v2/internal/index"
+	"go.mills.io/bitcask/v2/internal/keydir"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 var recoveryCmd = &cobra.Command{
 	Use:     "recover",
 	Aliases: []string{"recovery"},
-	Short:   "Analyzes and recovers the index file for corruption scenarios",
-	Long: `This analyze files to detect different forms of persistence corruption in 
-persisted files. It also allows to recover the files to the latest point of integrity.
-Recovered files have the .recovered extension`,
+	Short:   "Analyzes and recovers the Database for corruption scenarios",
+	Long: `This analyzes every Datafile and the index to detect different forms of
+persistence corruption and recovers them in place.
+
+Corrupted Datafiles are resynchronized at the next valid entry after each
+corrupted region so no valid entries are lost. The corrupted byte ranges are
+moved to the quarantine/ subdirectory of the Database and the keys whose latest
+value was lost are reported. A corrupted index is deleted to be rebuilt from
+the Datafiles on the next open.
+
+The recovery is reported as JSON. The Database must not be in use.`,
 	Args: cobra.ExactArgs(0),
 	PreRun: func(cmd *cobra.Command, args []string) {
 		viper.BindPFlag("dry-run", cmd.Flags().Lookup("dry-run"))
@@ -39,98 +48,80 @@ func init() {
 	recoveryCmd.Flags().BoolP("dry-run", "n", false, "Will only check files health without applying recovery if unhealthy")
 }
 
+type recoveryReport struct {
+	*data.Report
+	CorruptedIndex bool `json:"corrupted_index"`
+}
+
 func recover(path string, dryRun bool) int {
-	maxKeySize := bitcask.DefaultMaxKeySize
-	maxValueSize := bitcask.DefaultMaxValueSize
-	if cfg, err := config.Load(filepath.Join(path, "config.json")); err == nil {
-		maxKeySize = cfg.MaxKeySize
-		maxValueSize = cfg.MaxValueSize
+	cfg := &config.Config{
+		MaxKeySize:   bitcask.DefaultMaxKeySize,
+		MaxValueSize: bitcask.DefaultMaxValueSize,
+		DirMode:      bitcask.DefaultDirMode,
+		FileMode:     bitcask.DefaultFileMode,
+	}
+	if c, err := config.Load(vfs.OS, filepath.Join(path, "config.json")); err == nil {
+		cfg = c
 	}
 
-	if err := recoverIndex(filepath.Join(path, "index"), maxKeySize, dryRun); err != nil {
-		log.WithError(err).Info("recovering index file")
+	lock := flock.New(filepath.Join(path, "lock"))
+	ok, err := lock.TryLock()
+	if err != nil {
+		log.WithError(err).Error("error locking database")
+		return 1
+	}
+	if !ok {
+		log.WithError(bitcask.ErrDatabaseLocked).Error("error locking database")
 		return 1
 	}
+	defer lock.Unlock()
 
-	datafiles, err := internal.GetDatafiles(path)
+	corruptedIndex, err := recoverIndex(filepath.Join(path, "index"), cfg.MaxKeySize, dryRun)
 	if err != nil {
-		log.WithError(err).Info("coudn't list existing datafiles")
+		log.WithError(err).Error("error recovering index")
 		return 1
 	}
-	for _, file := range datafiles {
-		if err := recoverDatafile(file, maxKeySize, maxValueSize, dryRun); err != nil {
-			log.WithError(err).Info("recovering data file")
-			return 1
-		}
+
+	report, err := data.Recover(path, cfg, data.RecoverOptions{All: true, DryRun: dryRun})
+	if err != nil {
+		log.WithError(err).Error("error recovering datafiles")
+		return 1
 	}
 
+	out, err := json.MarshalIndent(recoveryReport{Report: report, CorruptedIndex: corruptedIndex}, "", "  ")
+	if err != nil {
+		log.WithError(err).Error("error marshalling report")
+		return 1
+	}
+
+	fmt.Println(string(out))
+
 	return 0
 }
 
-func recoverIndex(path string, maxKeySize uint32, dryRun bool) error {
-	t, err := index.NewIndexer().Load(path, maxKeySize)
-	if err != nil && !index.IsIndexCorruption(err) {
-		log.WithError(err).Info("opening the index file")
-	}
-	if err == nil {
+// recoverIndex deletes the index at path if it is corrupted, it is rebuilt
+// from the datafiles when the database is next opened
+func recoverIndex(path string, maxKeySize uint32, dryRun bool) (bool, error) {
+	kd, _ := keydir.New(keydir.ModeRadix)
+	_, err := index.NewIndexer().Load(path, maxKeySize, kd)
+	if err == nil || os.IsNotExist(err) {
 		log.Debug("index file is not corrupted")
-		return nil
+		return false, nil
+	}
+	if !index.IsIndexCorruption(err) {
+		return false, fmt.Errorf("opening the index file: %w", err)
 	}
 	log.Debugf("index file is corrupted: %v", err)
 
 	if dryRun {
-		log.Debug("dry-run mode, not writing to a file")
-		return nil
+		log.Debug("dry-run mode, not deleting the index")
+		return true, nil
 	}
 
-	// Leverage that t has the partially read tree even on corrupted files
-	err = index.NewIndexer().Save(t, "index.recovered")
-	if err != nil {
-		return fmt.Errorf("writing the recovered index file: %w", err)
+	if err := os.Remove(path); err != nil {
+		return true, fmt.Errorf("deleting the corrupted index file: %w", err)
 	}
-	log.Debug("the index was recovered in the index.recovered new file")
-
-	return nil
-}
+	log.Debug("deleted the corrupted index, it will be rebuilt from the datafiles")
 
-func recoverDatafile(path string, maxKeySize uint32, maxValueSize uint64, dryRun bool) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("opening the datafile: %w", err)
-	}
-	defer f.Close()
-	_, file := filepath.Split(path)
-	fr, err := os.OpenFile(fmt.Sprintf("%s.recovered", file), os.O_CREATE|os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("creating the recovered datafile: %w", err)
-	}
-	defer fr.Close()
-
-	dec := codec.NewDecoder(f, maxKeySize, maxValueSize)
-	enc := codec.NewEncoder(fr)
-	e := internal.Entry{}
-	for {
-		_, err = dec.Decode(&e)
-		if err == io.EOF {
-			break
-		}
-		if codec.IsCorruptedData(err) {
-			log.Debugf("%s is corrupted, a best-effort recovery was done", file)
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("unexpected error while reading datafile: %w", err)
-		}
-		if dryRun {
-			continue
-		}
-		if _, err := enc.Encode(e); err != nil {
-			return fmt.Errorf("writing to recovered datafile: %w", err)
-		}
-	}
-	if err := os.Remove(fr.Name()); err != nil {
-		return fmt.Errorf("can't remove temporal recovered datafile: %w", err)
-	}
-	log.Debugf("%s is not corrupted", file)
-	return nil
+	return true, nil
 }
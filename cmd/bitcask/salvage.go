@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"go.mills.io/bitcask/v2"
+)
+
+var salvageCmd = &cobra.Command{
+	Use:   "salvage <src> <dst>",
+	Short: "Rebuilds a Database from the Datafiles of a damaged one",
+	Long: `This rebuilds a clean Database at dst from the Datafiles of the Database at src
+even if its index, meta.json and config.json are missing or unreadable. Every
+Datafile is scanned tolerating corruption, the latest valid value of each key
+is kept and the maximum key and value sizes are inferred from the data.
+
+What was recovered and what was lost is reported as JSON. The exit status is 0
+if nothing was lost, 2 if corrupted data was skipped or keys were lost and 1 if
+the Database could not be salvaged. The src Database is left untouched and dst
+must not exist or be empty.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(salvage(args[0], args[1]))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(salvageCmd)
+}
+
+func salvage(src, dst string) int {
+	report, err := bitcask.Salvage(src, dst)
+	if err != nil {
+		log.WithError(err).Error("error salvaging database")
+		return 1
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.WithError(err).Error("error marshalling report")
+		return 1
+	}
+
+	fmt.Println(string(data))
+
+	if !report.OK() {
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"go.mills.io/bitcask/v2"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:     "verify",
+	Aliases: []string{"check", "fsck"},
+	Short:   "Verifies the integrity of the Database",
+	Long: `This verifies the checksum of every entry in every Datafile and that the
+index is consistent with the Datafiles, and reports any problems found as JSON.
+
+The exit status is 0 if no problems were found, 2 if problems were found and
+1 if the Database could not be verified. A Database in use by another process
+is verified in readonly mode, use --rate to limit the impact on it.`,
+	Args: cobra.ExactArgs(0),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("rate", cmd.Flags().Lookup("rate"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString("path")
+		rate := viper.GetInt64("rate")
+
+		os.Exit(verify(path, rate))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().Int64P("rate", "r", 0, "Limit reading Datafiles to this many bytes per second (0 is unlimited)")
+}
+
+func verify(path string, rate int64) int {
+	db, err := bitcask.Open(path, bitcask.WithAutoReadonly(true))
+	if err != nil {
+		log.WithError(err).Error("error opening database")
+		return 1
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	verifier, ok := db.(bitcask.Verifier)
+	if !ok {
+		log.Error("database does not support verification")
+		return 1
+	}
+
+	report, err := verifier.Verify(ctx, bitcask.VerifyOptions{BytesPerSecond: rate})
+	if err != nil {
+		log.WithError(err).Error("error verifying database")
+		return 1
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.WithError(err).Error("error marshalling report")
+		return 1
+	}
+
+	fmt.Println(string(data))
+
+	if !report.OK() {
+		return 2
+	}
+	return 0
+}
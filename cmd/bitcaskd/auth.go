@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
+	"go.mills.io/bitcask/v2/internal"
+)
+
+// defaultUser is the user clients authenticate as with AUTH <password>
+const defaultUser = "default"
+
+// withRequirePass requires clients to authenticate as the default user with
+// the given password before running any commands.
+func withRequirePass(password string) option {
+	return func(s *server) error {
+		if password != "" {
+			s.users[defaultUser] = password
+		}
+		return nil
+	}
+}
+
+// withUsers adds users, given as <name>:<password>, that clients can
+// authenticate as with AUTH <name> <password>.
+func withUsers(users []string) option {
+	return func(s *server) error {
+		for _, user := range users {
+			name, password, ok := strings.Cut(user, ":")
+			if !ok || name == "" || password == "" {
+				return fmt.Errorf("invalid user %q, expected <name>:<password>", user)
+			}
+			s.users[name] = password
+		}
+		return nil
+	}
+}
+
+// authRequired returns true if the client must authenticate before running
+// commands other than those flagged "no-auth".
+func (s *server) authRequired(cl *client) bool {
+	return len(s.users) > 0 && cl.user == ""
+}
+
+// authenticate checks the password of the given user, comparing passwords in
+// constant time.
+func (s *server) authenticate(user, password []byte) bool {
+	expected, ok := s.users[string(user)]
+	return ok && subtle.ConstantTimeCompare([]byte(expected), password) == 1
+}
+
+func (s *server) handleAuth(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args) > 3 {
+		conn.WriteError("ERR syntax error")
+		return
+	}
+
+	user, password := []byte(defaultUser), cmd.Args[1]
+	if len(cmd.Args) == 3 {
+		user, password = cmd.Args[1], cmd.Args[2]
+	} else if len(s.users) == 0 {
+		conn.WriteError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+
+	if !s.authenticate(user, password) {
+		conn.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+
+	clientOf(conn).user = string(user)
+	conn.WriteString("OK")
+}
+
+// handleHello implements HELLO [protover [AUTH username password] [SETNAME
+// clientname]]. Only RESP2 is supported so the reply is a flat array of
+// field/value pairs.
+func (s *server) handleHello(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+
+	if len(cmd.Args) > 1 {
+		proto, err := strconv.Atoi(string(cmd.Args[1]))
+		if err != nil {
+			conn.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 {
+			conn.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+	}
+
+	var (
+		user, password []byte
+		name           string
+		setName        bool
+	)
+	for i := 2; i < len(cmd.Args); i++ {
+		switch strings.ToLower(string(cmd.Args[i])) {
+		case "auth":
+			if i+2 >= len(cmd.Args) {
+				conn.WriteError("ERR Syntax error in HELLO option 'auth'")
+				return
+			}
+			user, password = cmd.Args[i+1], cmd.Args[i+2]
+			i += 2
+		case "setname":
+			if i+1 >= len(cmd.Args) {
+				conn.WriteError("ERR Syntax error in HELLO option 'setname'")
+				return
+			}
+			name, setName = string(cmd.Args[i+1]), true
+			i++
+		default:
+			conn.WriteError("ERR Syntax error in HELLO option '" + string(cmd.Args[i]) + "'")
+			return
+		}
+	}
+
+	if user != nil {
+		if !s.authenticate(user, password) {
+			conn.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+			return
+		}
+		cl.user = string(user)
+	}
+
+	if s.authRequired(cl) {
+		conn.WriteError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	if setName {
+		cl.name = name
+	}
+
+	conn.WriteArray(14)
+	conn.WriteBulkString("server")
+	conn.WriteBulkString("bitcaskd")
+	conn.WriteBulkString("version")
+	conn.WriteBulkString(internal.Version)
+	conn.WriteBulkString("proto")
+	conn.WriteInt(2)
+	conn.WriteBulkString("id")
+	conn.WriteInt64(cl.id)
+	conn.WriteBulkString("mode")
+	conn.WriteBulkString("standalone")
+	conn.WriteBulkString("role")
+	conn.WriteBulkString("master")
+	conn.WriteBulkString("modules")
+	conn.WriteArray(0)
+}
+
+func (s *server) handleACL(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	switch strings.ToLower(string(cmd.Args[1])) {
+	case "whoami":
+		user := clientOf(conn).user
+		if user == "" {
+			user = defaultUser
+		}
+		conn.WriteBulkString(user)
+	case "users":
+		users := make([]string, 0, len(s.users))
+		for name := range s.users {
+			users = append(users, name)
+		}
+		if len(users) == 0 {
+			users = append(users, defaultUser)
+		}
+		sort.Strings(users)
+
+		conn.WriteArray(len(users))
+		for _, name := range users {
+			conn.WriteBulkString(name)
+		}
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try ACL HELP.")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2"
+	remote "go.mills.io/bitcask/v2/client"
+)
+
+func TestClient(t *testing.T) {
+	s, _ := startTestServer(t)
+
+	c, err := remote.New(s.bind, remote.WithPoolSize(2))
+	require.NoError(t, err)
+	defer c.Close()
+
+	t.Run("Keys", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// The client can be used in place of an embedded database
+		var keys bitcask.Keys = c
+
+		assert.NoError(keys.Put(bitcask.Key("foo"), bitcask.Value("bar")))
+		assert.True(keys.Has(bitcask.Key("foo")))
+
+		value, err := keys.Get(bitcask.Key("foo"))
+		assert.NoError(err)
+		assert.Equal(bitcask.Value("bar"), value)
+
+		assert.NoError(keys.Delete(bitcask.Key("foo")))
+		assert.False(keys.Has(bitcask.Key("foo")))
+
+		_, err = keys.Get(bitcask.Key("foo"))
+		assert.ErrorIs(err, bitcask.ErrKeyNotFound)
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, key := range []string{"a*1", "a*2", "ab", "b"} {
+			require.NoError(t, c.Put(bitcask.Key(key), bitcask.Value("x")))
+		}
+
+		var keys []string
+		assert.NoError(c.Scan(bitcask.Key("a*"), func(key bitcask.Key) error {
+			keys = append(keys, string(key))
+			return nil
+		}))
+		assert.Equal([]string{"a*1", "a*2"}, keys)
+
+		errStop := errors.New("stop")
+		n := 0
+		assert.Equal(errStop, c.Scan(bitcask.Key("a"), func(key bitcask.Key) error {
+			n++
+			return errStop
+		}))
+		assert.Equal(1, n)
+	})
+
+	t.Run("Pipeline", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := c.Pipeline()
+		p.Put(bitcask.Key("p1"), bitcask.Value("1"))
+		p.Put(bitcask.Key("p2"), bitcask.Value("2"))
+		p.Get(bitcask.Key("p1"))
+		p.Delete(bitcask.Key("p2"))
+		p.Get(bitcask.Key("p2"))
+		assert.Equal(5, p.Len())
+
+		results, err := p.Exec()
+		assert.NoError(err)
+		assert.Equal([]remote.Result{
+			{},
+			{},
+			{Value: bitcask.Value("1")},
+			{},
+			{Err: bitcask.ErrKeyNotFound},
+		}, results)
+		assert.Equal(0, p.Len())
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			go func(i int) {
+				key := bitcask.Key{'c', byte('0' + i)}
+				if err := c.Put(key, bitcask.Value(key)); err != nil {
+					errs <- err
+					return
+				}
+				_, err := c.Get(key)
+				errs <- err
+			}(i)
+		}
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, <-errs)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		c, err := remote.New(s.bind)
+		require.NoError(t, err)
+		require.NoError(t, c.Close())
+
+		_, err = c.Get(bitcask.Key("foo"))
+		assert.ErrorIs(t, err, remote.ErrClientClosed)
+	})
+}
+
+func TestClientAuth(t *testing.T) {
+	s, _ := startTestServer(t, withUsers([]string{"alice:secret"}))
+
+	// Unauthenticated clients connect but can't run commands
+	c, err := remote.New(s.bind)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Error(t, c.Put(bitcask.Key("foo"), bitcask.Value("bar")))
+
+	_, err = remote.New(s.bind, remote.WithUser("alice", "wrong"))
+	assert.Error(t, err)
+
+	c, err = remote.New(s.bind, remote.WithUser("alice", "secret"))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.NoError(t, c.Put(bitcask.Key("foo"), bitcask.Value("bar")))
+}
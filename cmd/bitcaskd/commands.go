@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
+)
+
+// command describes a Redis command supported by the server. The arity,
+// flags and key positions follow the same conventions as the Redis COMMAND
+// reply: a positive arity is an exact argument count (including the command
+// name) and a negative arity is a minimum argument count.
+type command struct {
+	name  string
+	arity int
+	flags []string
+	first int
+	last  int
+	step  int
+	fn    func(s *server, tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn)
+}
+
+// validArity returns true if the number of arguments in cmd satisfies the
+// arity of the command.
+func (c *command) validArity(cmd redcon.Command) bool {
+	if c.arity < 0 {
+		return len(cmd.Args) >= -c.arity
+	}
+	return len(cmd.Args) == c.arity
+}
+
+// hasFlag returns true if the command has the given flag. Commands flagged
+// "no-multi" are executed immediately even inside a MULTI block.
+func (c *command) hasFlag(flag string) bool {
+	for _, f := range c.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the key arguments of cmd according to the key positions of
+// the command.
+func (c *command) keys(cmd redcon.Command) [][]byte {
+	if c.first == 0 {
+		return nil
+	}
+
+	last := c.last
+	if last < 0 {
+		last += len(cmd.Args)
+	}
+
+	var keys [][]byte
+	for i := c.first; i <= last && i < len(cmd.Args); i += c.step {
+		keys = append(keys, cmd.Args[i])
+	}
+	return keys
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = make(map[string]*command)
+
+	register := func(cmds ...*command) {
+		for _, cmd := range cmds {
+			commands[cmd.name] = cmd
+		}
+	}
+
+	register(
+		// Connection
+		&command{"ping", -1, []string{"fast"}, 0, 0, 0, (*server).handlePing},
+		&command{"quit", 1, []string{"fast", "no-multi", "no-auth"}, 0, 0, 0, (*server).handleQuit},
+		&command{"auth", -2, []string{"fast", "no-auth"}, 0, 0, 0, (*server).handleAuth},
+		&command{"hello", -1, []string{"fast", "no-auth"}, 0, 0, 0, (*server).handleHello},
+		&command{"acl", -2, []string{}, 0, 0, 0, (*server).handleACL},
+		&command{"select", 2, []string{"fast"}, 0, 0, 0, (*server).handleSelect},
+		&command{"client", -2, []string{"fast"}, 0, 0, 0, (*server).handleClient},
+		&command{"command", -1, []string{"fast"}, 0, 0, 0, (*server).handleCommand},
+
+		// Transactions
+		&command{"multi", 1, []string{"fast", "no-multi"}, 0, 0, 0, (*server).handleMulti},
+		&command{"exec", 1, []string{"no-multi"}, 0, 0, 0, (*server).handleExec},
+		&command{"discard", 1, []string{"fast", "no-multi"}, 0, 0, 0, (*server).handleDiscard},
+		&command{"watch", -2, []string{"fast", "no-multi"}, 1, -1, 1, (*server).handleWatch},
+		&command{"unwatch", 1, []string{"fast"}, 0, 0, 0, (*server).handleUnwatch},
+
+		// Pub/Sub
+		&command{"subscribe", -2, []string{"pubsub", "no-multi"}, 0, 0, 0, (*server).handleSubscribe},
+		&command{"psubscribe", -2, []string{"pubsub", "no-multi"}, 0, 0, 0, (*server).handleSubscribe},
+		&command{"unsubscribe", -1, []string{"pubsub"}, 0, 0, 0, (*server).handleUnsubscribe},
+		&command{"punsubscribe", -1, []string{"pubsub"}, 0, 0, 0, (*server).handleUnsubscribe},
+		&command{"publish", 3, []string{"pubsub", "fast"}, 0, 0, 0, (*server).handlePublish},
+
+		// Server
+		&command{"info", -1, []string{"fast"}, 0, 0, 0, (*server).handleInfo},
+		&command{"dbsize", 1, []string{"readonly", "fast"}, 0, 0, 0, (*server).handleDBSize},
+		&command{"flushdb", -1, []string{"write"}, 0, 0, 0, (*server).handleFlushDB},
+
+		// Keys
+		&command{"keys", 2, []string{"readonly"}, 0, 0, 0, (*server).handleKeys},
+		&command{"exists", -2, []string{"readonly", "fast"}, 1, -1, 1, (*server).handleExists},
+		&command{"del", -2, []string{"write"}, 1, -1, 1, (*server).handleDel},
+		&command{"ttl", 2, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleTTL},
+		&command{"pttl", 2, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleTTL},
+
+		// Strings
+		&command{"get", 2, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleGet},
+		&command{"set", -3, []string{"write"}, 1, 1, 1, (*server).handleSet},
+		&command{"mget", -2, []string{"readonly", "fast"}, 1, -1, 1, (*server).handleMGet},
+		&command{"mset", -3, []string{"write"}, 1, -1, 2, (*server).handleMSet},
+		&command{"strlen", 2, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleStrlen},
+		&command{"append", 3, []string{"write"}, 1, 1, 1, (*server).handleAppend},
+
+		// Hashes
+		&command{"hset", -4, []string{"write"}, 1, 1, 1, (*server).handleHSet},
+		&command{"hget", 3, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleHGet},
+		&command{"hmget", -3, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleHMGet},
+		&command{"hgetall", 2, []string{"readonly"}, 1, 1, 1, (*server).handleHGetAll},
+		&command{"hdel", -3, []string{"write", "fast"}, 1, 1, 1, (*server).handleHDel},
+
+		// Lists
+		&command{"rpush", -3, []string{"write"}, 1, 1, 1, (*server).handleRPush},
+		&command{"rpop", 2, []string{"write", "fast"}, 1, 1, 1, (*server).handleRPop},
+		&command{"llen", 2, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleLLen},
+		&command{"lindex", 3, []string{"readonly"}, 1, 1, 1, (*server).handleLIndex},
+		&command{"lrange", 4, []string{"readonly"}, 1, 1, 1, (*server).handleLRange},
+
+		// Sorted Sets
+		&command{"zadd", -4, []string{"write"}, 1, 1, 1, (*server).handleZAdd},
+		&command{"zscore", 3, []string{"readonly", "fast"}, 1, 1, 1, (*server).handleZScore},
+		&command{"zrem", -3, []string{"write", "fast"}, 1, 1, 1, (*server).handleZRem},
+		&command{"zrangebyscore", -4, []string{"readonly"}, 1, 1, 1, (*server).handleZRangeByScore},
+	)
+}
+
+// lookupCommand returns the command registered under the (case insensitive)
+// name given as the first argument of cmd, or nil if there is none.
+func lookupCommand(cmd redcon.Command) *command {
+	return commands[strings.ToLower(string(cmd.Args[0]))]
+}
+
+func writeCommandInfo(conn redcon.Conn, c *command) {
+	conn.WriteArray(6)
+	conn.WriteBulkString(c.name)
+	conn.WriteInt(c.arity)
+	conn.WriteArray(len(c.flags))
+	for _, flag := range c.flags {
+		conn.WriteString(flag)
+	}
+	conn.WriteInt(c.first)
+	conn.WriteInt(c.last)
+	conn.WriteInt(c.step)
+}
+
+func (s *server) handleCommand(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args) == 1 {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		conn.WriteArray(len(names))
+		for _, name := range names {
+			writeCommandInfo(conn, commands[name])
+		}
+		return
+	}
+
+	switch strings.ToLower(string(cmd.Args[1])) {
+	case "count":
+		conn.WriteInt(len(commands))
+	case "info":
+		conn.WriteArray(len(cmd.Args) - 2)
+		for _, name := range cmd.Args[2:] {
+			if c, ok := commands[strings.ToLower(string(name))]; ok {
+				writeCommandInfo(conn, c)
+			} else {
+				conn.WriteNull()
+			}
+		}
+	case "docs":
+		// We don't ship any command documentation, but clients such as
+		// redis-cli ask for it on connect and expect an empty reply.
+		conn.WriteArray(0)
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try COMMAND HELP.")
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.mills.io/bitcask/v2"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var (
+	errPreconditionFailed = errors.New("precondition failed")
+	errEmptyValue         = errors.New("empty values are not supported")
+	errStopScan           = errors.New("stop scan")
+	errBackupsDisabled    = errors.New("backups are disabled, start bitcaskd with --backup-dir")
+)
+
+// withHTTP serves the HTTP/JSON gateway on the given address
+func withHTTP(addr string) option {
+	return func(s *server) error {
+		s.httpBind = addr
+		return nil
+	}
+}
+
+// withBackupDir enables POST /backup which backs up the database under dir,
+// backups are disabled if dir is empty
+func withBackupDir(dir string) option {
+	return func(s *server) error {
+		s.backupDir = dir
+		return nil
+	}
+}
+
+// batchOp is a single operation of a POST /batch request
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type batchRequest struct {
+	Ops []batchOp `json:"ops"`
+}
+
+type keysResponse struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"`
+}
+
+type statsResponse struct {
+	Datafiles   int   `json:"datafiles"`
+	Keys        int   `json:"keys"`
+	Size        int64 `json:"size"`
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+type backupRequest struct {
+	Path string `json:"path"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// httpHandler returns the handler of the HTTP/JSON gateway
+func (s *server) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", s.handleHTTPKeys)
+	mux.HandleFunc("/keys/", s.handleHTTPKey)
+	mux.HandleFunc("/batch", s.handleHTTPBatch)
+	mux.HandleFunc("/stats", s.handleHTTPStats)
+	mux.HandleFunc("/merge", s.handleHTTPMerge)
+	mux.HandleFunc("/backup", s.handleHTTPBackup)
+	mux.Handle("/metrics", s.metrics)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.users) > 0 {
+			user, password, ok := r.BasicAuth()
+			if !ok || !s.authenticate([]byte(user), []byte(password)) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="bitcaskd"`)
+				writeHTTPError(w, http.StatusUnauthorized, errors.New("authentication required"))
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// httpStatus maps errors returned by the database to HTTP status codes
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bitcask.ErrEmptyKey), errors.Is(err, bitcask.ErrKeyTooLarge), errors.Is(err, errEmptyValue):
+		return http.StatusBadRequest
+	case errors.Is(err, bitcask.ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, bitcask.ErrDatabaseReadonly):
+		return http.StatusForbidden
+	case errors.Is(err, bitcask.ErrMergeInProgress):
+		return http.StatusConflict
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// allowMethods writes a 405 response and returns false if the request method
+// is not one of methods.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// etag returns the entity tag of a value which is the CRC-32 (IEEE) of the
+// value, it is computed from the value alone so equal values share a tag
+func etag(value []byte) string {
+	return fmt.Sprintf(`"%08x"`, crc32.ChecksumIEEE(value))
+}
+
+// matchETag returns true if tag matches any of the entity tags in an
+// If-Match or If-None-Match header. Weak tags compare equal to strong tags.
+func matchETag(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of a
+// write request against the current value of the key (nil if missing).
+func checkPreconditions(r *http.Request, value []byte, exists bool) error {
+	if header := r.Header.Get("If-Match"); header != "" {
+		if !exists || !matchETag(header, etag(value)) {
+			return errPreconditionFailed
+		}
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if exists && matchETag(header, etag(value)) {
+			return errPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// update applies fn to a new transaction and commits it. Like RESP write
+// commands, keys passed to modified invalidate WATCHes and produce keyspace
+// events once the transaction is committed.
+func (s *server) update(fn func(tx bitcask.Transaction, modified func(class int, event string, key []byte)) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.db.Transaction()
+	defer tx.Discard()
+
+	var (
+		keys          [][]byte
+		notifications []notification
+	)
+	modified := func(class int, event string, key []byte) {
+		keys = append(keys, key)
+		if s.notifying(class) {
+			notifications = append(notifications, notification{event, string(key)})
+		}
+	}
+
+	if err := fn(tx, modified); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.touchKeys(keys...)
+	for _, n := range notifications {
+		s.publishNotification(n)
+	}
+
+	return nil
+}
+
+// handleHTTPKey implements GET, HEAD, PUT and DELETE /keys/{key}
+func (s *server) handleHTTPKey(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete) {
+		return
+	}
+
+	key := []byte(strings.TrimPrefix(r.URL.Path, "/keys/"))
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		value, err := s.db.Get(key)
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+
+		tag := etag(value)
+		w.Header().Set("ETag", tag)
+		if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(value)
+		}
+	case http.MethodPut:
+		body := r.Body
+		if s.maxValueSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, int64(s.maxValueSize))
+		}
+		value, err := io.ReadAll(body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeHTTPError(w, http.StatusRequestEntityTooLarge, bitcask.ErrValueTooLarge)
+				return
+			}
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(value) == 0 {
+			writeHTTPError(w, http.StatusBadRequest, errEmptyValue)
+			return
+		}
+
+		created := false
+		err = s.update(func(tx bitcask.Transaction, modified func(int, string, []byte)) error {
+			current, err := tx.Get(key)
+			if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+				return err
+			}
+			created = err != nil
+			if err := checkPreconditions(r, current, !created); err != nil {
+				return err
+			}
+			if err := tx.Put(key, value); err != nil {
+				return err
+			}
+			modified(notifyString, "set", key)
+			return nil
+		})
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(value))
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		err := s.update(func(tx bitcask.Transaction, modified func(int, string, []byte)) error {
+			current, err := tx.Get(key)
+			if err != nil {
+				return err
+			}
+			if err := checkPreconditions(r, current, true); err != nil {
+				return err
+			}
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+			modified(notifyGeneric, "del", key)
+			return nil
+		})
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleHTTPKeys implements GET /keys?prefix=<prefix>&after=<key>&limit=<n>
+// which lists keys in order. If there are more keys the response includes
+// the key to pass as after to fetch the next page.
+func (s *server) handleHTTPKeys(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := query.Get("after")
+
+	limit := defaultListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		if n > maxListLimit {
+			n = maxListLimit
+		}
+		limit = n
+	}
+
+	tx := s.db.Transaction()
+	defer tx.Discard()
+
+	resp := keysResponse{Keys: []string{}}
+	err := tx.Scan([]byte(prefix), func(key bitcask.Key) error {
+		if after != "" && string(key) <= after {
+			return nil
+		}
+		if len(resp.Keys) == limit {
+			resp.Next = resp.Keys[len(resp.Keys)-1]
+			return errStopScan
+		}
+		resp.Keys = append(resp.Keys, string(key))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleHTTPBatch implements POST /batch which atomically applies a list of
+// put and delete operations.
+func (s *server) handleHTTPBatch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, op := range req.Ops {
+		switch op.Op {
+		case "put":
+			if len(op.Value) == 0 {
+				writeHTTPError(w, http.StatusBadRequest, errEmptyValue)
+				return
+			}
+		case "delete":
+		default:
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid op %q", op.Op))
+			return
+		}
+	}
+
+	err := s.update(func(tx bitcask.Transaction, modified func(int, string, []byte)) error {
+		for _, op := range req.Ops {
+			key := []byte(op.Key)
+			if op.Op == "put" {
+				if err := tx.Put(key, op.Value); err != nil {
+					return err
+				}
+				modified(notifyString, "set", key)
+				continue
+			}
+			if !tx.Has(key) {
+				continue
+			}
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+			modified(notifyGeneric, "del", key)
+		}
+		return nil
+	})
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleHTTPStats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	stats, err := s.db.Stats()
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statsResponse{
+		Datafiles:   stats.Datafiles,
+		Keys:        stats.Keys,
+		Size:        stats.Size,
+		Reclaimable: stats.Reclaimable,
+	})
+}
+
+func (s *server) handleHTTPMerge(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := s.db.Merge(); err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHTTPBackup implements POST /backup which backs up the database to
+// the path given in the request, relative to the backup directory.
+func (s *server) handleHTTPBackup(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	if s.backupDir == "" {
+		writeHTTPError(w, http.StatusForbidden, errBackupsDisabled)
+		return
+	}
+
+	var req backupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Path == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("missing backup path"))
+		return
+	}
+	if !filepath.IsLocal(req.Path) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("backup path %q is outside the backup directory", req.Path))
+		return
+	}
+
+	if err := s.db.Backup(filepath.Join(s.backupDir, req.Path)); err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
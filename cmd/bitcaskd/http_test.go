@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2"
+)
+
+// startTestHTTPServer serves the HTTP gateway of s for tests
+func startTestHTTPServer(t *testing.T, s *server) *httptest.Server {
+	t.Helper()
+
+	hs := httptest.NewServer(s.httpHandler())
+	t.Cleanup(hs.Close)
+	return hs
+}
+
+func doHTTP(t *testing.T, method, url, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(data)
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestHTTPKeys(t *testing.T) {
+	s, c := startTestServer(t)
+	hs := startTestHTTPServer(t, s)
+	url := hs.URL + "/keys/foo"
+
+	assert := assert.New(t)
+
+	resp, _ := doHTTP(t, http.MethodPut, url, "bar", nil)
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	tag := resp.Header.Get("ETag")
+	assert.Equal(etag([]byte("bar")), tag)
+	assert.Equal([]byte("bar"), c.Do("GET", "foo"))
+
+	resp, body := doHTTP(t, http.MethodGet, url, "", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("bar", body)
+	assert.Equal(tag, resp.Header.Get("ETag"))
+
+	resp, body = doHTTP(t, http.MethodGet, url, "", map[string]string{"If-None-Match": tag})
+	assert.Equal(http.StatusNotModified, resp.StatusCode)
+	assert.Empty(body)
+
+	resp, _ = doHTTP(t, http.MethodPut, url, "baz", map[string]string{"If-Match": `"00000000"`})
+	assert.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPut, url, "baz", map[string]string{"If-None-Match": "*"})
+	assert.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPut, url, "baz", map[string]string{"If-Match": tag})
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	tag = resp.Header.Get("ETag")
+
+	resp, _ = doHTTP(t, http.MethodDelete, url, "", map[string]string{"If-Match": etag([]byte("bar"))})
+	assert.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodDelete, url, "", map[string]string{"If-Match": tag})
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Nil(c.Do("GET", "foo"))
+
+	resp, _ = doHTTP(t, http.MethodGet, url, "", nil)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodDelete, url, "", nil)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPut, url, "", nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Bodies are read up to the value size limit
+	big := strings.Repeat("v", int(bitcask.DefaultMaxValueSize))
+	resp, _ = doHTTP(t, http.MethodPut, hs.URL+"/keys/big", big+"v", nil)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPut, hs.URL+"/keys/big", big, nil)
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+
+	r := &countingReader{r: strings.NewReader(strings.Repeat(big, 16))}
+	rec := httptest.NewRecorder()
+	s.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/big", r))
+	assert.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+	assert.LessOrEqual(r.n, len(big)+1)
+	resp, _ = doHTTP(t, http.MethodPost, url, "bar", nil)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// Writes over HTTP invalidate WATCHed keys
+	assert.Equal("OK", c.Do("WATCH", "foo"))
+	resp, _ = doHTTP(t, http.MethodPut, url, "http", nil)
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	assert.Equal("OK", c.Do("MULTI"))
+	assert.Equal("QUEUED", c.Do("SET", "foo", "resp"))
+	assert.Nil(c.Do("EXEC"))
+}
+
+func TestHTTPListKeys(t *testing.T) {
+	s, c := startTestServer(t)
+	hs := startTestHTTPServer(t, s)
+
+	assert := assert.New(t)
+
+	assert.Equal("OK", c.Do("MSET", "a1", "1", "a2", "2", "a3", "3", "a4", "4", "a5", "5", "b1", "1"))
+
+	list := func(query string) keysResponse {
+		resp, body := doHTTP(t, http.MethodGet, hs.URL+"/keys?"+query, "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var keys keysResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &keys))
+		return keys
+	}
+
+	assert.Equal(keysResponse{Keys: []string{"a1", "a2"}, Next: "a2"}, list("prefix=a&limit=2"))
+	assert.Equal(keysResponse{Keys: []string{"a3", "a4"}, Next: "a4"}, list("prefix=a&limit=2&after=a2"))
+	assert.Equal(keysResponse{Keys: []string{"a5"}}, list("prefix=a&limit=2&after=a4"))
+	assert.Equal(keysResponse{Keys: []string{"a1", "a2", "a3", "a4", "a5", "b1"}}, list(""))
+	assert.Equal(keysResponse{Keys: []string{}}, list("prefix=c"))
+
+	resp, _ := doHTTP(t, http.MethodGet, hs.URL+"/keys?limit=0", "", nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHTTPBatch(t *testing.T) {
+	s, c := startTestServer(t)
+	hs := startTestHTTPServer(t, s)
+
+	assert := assert.New(t)
+
+	assert.Equal("OK", c.Do("SET", "old", "value"))
+
+	resp, _ := doHTTP(t, http.MethodPost, hs.URL+"/batch", `{"ops": [
+		{"op": "put", "key": "a", "value": "MQ=="},
+		{"op": "put", "key": "b", "value": "Mg=="},
+		{"op": "delete", "key": "old"},
+		{"op": "delete", "key": "missing"}
+	]}`, nil)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Equal([]interface{}{[]byte("1"), []byte("2"), nil}, c.Do("MGET", "a", "b", "old"))
+
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/batch", `{"ops": [
+		{"op": "put", "key": "c", "value": "Mw=="},
+		{"op": "incr", "key": "a"}
+	]}`, nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Nil(c.Do("GET", "c"))
+
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/batch", `not json`, nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHTTPAdmin(t *testing.T) {
+	backupDir := t.TempDir()
+	s, c := startTestServer(t, withBackupDir(backupDir))
+	hs := startTestHTTPServer(t, s)
+
+	assert := assert.New(t)
+
+	assert.Equal("OK", c.Do("SET", "foo", "bar"))
+	assert.Equal("OK", c.Do("SET", "foo", "baz"))
+
+	resp, body := doHTTP(t, http.MethodGet, hs.URL+"/stats", "", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	var stats statsResponse
+	assert.NoError(json.Unmarshal([]byte(body), &stats))
+	assert.Equal(1, stats.Keys)
+
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/merge", "", nil)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodGet, hs.URL+"/merge", "", nil)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/backup", `{"path": "backup"}`, nil)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/backup", `{}`, nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Backups are only written under the backup directory
+	outside := filepath.Join(t.TempDir(), "backup")
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/backup", `{"path": "`+outside+`"}`, nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doHTTP(t, http.MethodPost, hs.URL+"/backup", `{"path": "../backup"}`, nil)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.NoDirExists(outside)
+
+	db, err := bitcask.Open(filepath.Join(backupDir, "backup"))
+	require.NoError(t, err)
+	defer db.Close()
+	value, err := db.Get([]byte("foo"))
+	assert.NoError(err)
+	assert.Equal(bitcask.Value("baz"), value)
+
+	resp, body = doHTTP(t, http.MethodGet, hs.URL+"/metrics", "", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Contains(resp.Header.Get("Content-Type"), "text/plain")
+	assert.Contains(body, `bitcask_operations_total{op="write_batch"} 2`)
+	assert.Contains(body, `bitcask_operations_total{op="merge"} 1`)
+	assert.Contains(body, `bitcask_operation_duration_seconds_count{op="merge"} 1`)
+	assert.Contains(body, "bitcask_keys 1\n")
+	assert.Contains(body, "# TYPE bitcask_reclaimable_bytes gauge\n")
+}
+
+func TestHTTPBackupDisabled(t *testing.T) {
+	s, _ := startTestServer(t)
+	hs := startTestHTTPServer(t, s)
+
+	path := filepath.Join(t.TempDir(), "backup")
+	resp, body := doHTTP(t, http.MethodPost, hs.URL+"/backup", `{"path": "`+path+`"}`, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, body, errBackupsDisabled.Error())
+	assert.NoDirExists(t, path)
+}
+
+func TestHTTPAuth(t *testing.T) {
+	s, _ := startTestServer(t, withRequirePass("secret"))
+	hs := startTestHTTPServer(t, s)
+
+	assert := assert.New(t)
+
+	resp, _ := doHTTP(t, http.MethodGet, hs.URL+"/stats", "", nil)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(resp.Header.Get("WWW-Authenticate"))
+
+	req, err := http.NewRequest(http.MethodGet, hs.URL+"/stats", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("default", "wrong")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	req.SetBasicAuth("default", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// withTLS serves clients over TLS using the given certificate and key. If a
+// client CA certificate is given clients must present a certificate signed
+// by it.
+func withTLS(certFile, keyFile, caCertFile string) option {
+	return func(s *server) error {
+		if certFile == "" && keyFile == "" && caCertFile == "" {
+			return nil
+		}
+		if certFile == "" || keyFile == "" {
+			return errors.New("both a TLS certificate and key are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+
+		config := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		if caCertFile != "" {
+			data, err := os.ReadFile(caCertFile)
+			if err != nil {
+				return fmt.Errorf("error reading TLS client CA certificate: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return fmt.Errorf("no certificates found in %s", caCertFile)
+			}
+			config.ClientCAs = pool
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		s.tlsConfig = config
+		return nil
+	}
+}
+
+// withUnixSocket also listens for clients on a Unix socket at path
+func withUnixSocket(path string) option {
+	return func(s *server) error {
+		s.unixSocket = path
+		return nil
+	}
+}
+
+// listen creates the listeners the server accepts clients on: TCP (or TLS)
+// on the bind address unless it is empty and the Unix socket if configured.
+func (s *server) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	closeAll := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+
+	if s.bind != "" {
+		ln, err := net.Listen("tcp", s.bind)
+		if err != nil {
+			return nil, err
+		}
+		if s.tlsConfig != nil {
+			ln = tls.NewListener(ln, s.tlsConfig)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if s.unixSocket != "" {
+		// Remove a stale socket left behind by an unclean shutdown
+		if fi, err := os.Stat(s.unixSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(s.unixSocket)
+		}
+		ln, err := net.Listen("unix", s.unixSocket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if len(listeners) == 0 && s.httpBind == "" {
+		return nil, errors.New("no bind address, unix socket or http address to listen on")
+	}
+
+	return listeners, nil
+}
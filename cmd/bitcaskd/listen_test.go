@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and key generated for tests
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert generates a certificate signed by parent, or a self-signed CA
+// certificate if parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// writeFiles writes the certificate and key as PEM files to dir
+func (c *testCert) writeFiles(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSListener(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "server", ca).writeFiles(t, dir, "server")
+	client := newTestCert(t, "client", ca)
+
+	s := serveTestServer(t, withTLS(certFile, keyFile, caFile))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	t.Run("ClientCert", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", s.bind, &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{client.tlsCertificate()},
+		})
+		require.NoError(t, err)
+
+		c := newRespClient(t, conn)
+		assert.Equal(t, "PONG", c.Do("PING"))
+	})
+
+	t.Run("NoClientCert", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", s.bind, &tls.Config{RootCAs: roots})
+		if err == nil {
+			// The server rejects the handshake after the client finished it
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			_, err = conn.Write([]byte("PING\r\n"))
+			if err == nil {
+				_, err = conn.Read(make([]byte, 1))
+			}
+			conn.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("Plaintext", func(t *testing.T) {
+		conn, err := net.Dial("tcp", s.bind)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("PING\r\n"))
+		data, _ := io.ReadAll(conn)
+		assert.NotContains(t, string(data), "PONG")
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := newServer("127.0.0.1:0", t.TempDir(), withTLS(certFile, "", ""))
+		assert.Error(t, err)
+		_, err = newServer("127.0.0.1:0", t.TempDir(), withTLS(certFile, keyFile, filepath.Join(dir, "missing.crt")))
+		assert.Error(t, err)
+	})
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	// Unix socket paths are limited in length so avoid the test's TempDir
+	dir, err := os.MkdirTemp("", "bitcaskd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bitcaskd.sock")
+	s := serveTestServer(t, withUnixSocket(path))
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+
+	c := newRespClient(t, conn)
+	assert.Equal(t, "OK", c.Do("SET", "foo", "bar"))
+	assert.Equal(t, []byte("bar"), dialTestServer(t, s.bind).Do("GET", "foo"))
+}
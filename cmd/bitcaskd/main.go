@@ -15,6 +15,17 @@ var (
 	bind    string
 	debug   bool
 	version bool
+
+	notifyKeyspaceEvents string
+
+	requirePass string
+	users       []string
+	tlsCert     string
+	tlsKey      string
+	tlsCACert   string
+	unixSocket  string
+	httpBind    string
+	backupDir   string
 )
 
 func init() {
@@ -26,7 +37,16 @@ func init() {
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
 	flag.BoolVarP(&debug, "debug", "d", false, "enable debug logging")
 
-	flag.StringVarP(&bind, "bind", "b", ":6379", "interface and port to bind to")
+	flag.StringVarP(&bind, "bind", "b", ":6379", "interface and port to bind to (empty to only listen on --unixsocket)")
+	flag.StringVar(&requirePass, "requirepass", "", "require clients to AUTH with this password")
+	flag.StringArrayVar(&users, "user", nil, "add a user as <name>:<password> that clients can AUTH as (may be repeated)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file to serve clients over TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file to serve clients over TLS")
+	flag.StringVar(&tlsCACert, "tls-ca-cert", "", "CA certificate file used to verify TLS client certificates")
+	flag.StringVar(&unixSocket, "unixsocket", "", "also listen on a Unix socket at this path")
+	flag.StringVar(&httpBind, "http", "", "interface and port to serve the HTTP/JSON gateway on (disabled if empty)")
+	flag.StringVar(&backupDir, "backup-dir", "", "directory POST /backup of the HTTP/JSON gateway writes backups under (disabled if empty)")
+	flag.StringVar(&notifyKeyspaceEvents, "notify-keyspace-events", "", "keyspace events to publish (e.g: KEA, see Redis' notify-keyspace-events)")
 }
 
 func main() {
@@ -50,7 +70,15 @@ func main() {
 
 	path := flag.Arg(0)
 
-	server, err := newServer(bind, path)
+	server, err := newServer(bind, path,
+		withNotifyKeyspaceEvents(notifyKeyspaceEvents),
+		withRequirePass(requirePass),
+		withUsers(users),
+		withTLS(tlsCert, tlsKey, tlsCACert),
+		withUnixSocket(unixSocket),
+		withHTTP(httpBind),
+		withBackupDir(backupDir),
+	)
 	if err != nil {
 		log.WithError(err).Error("error creating server")
 		os.Exit(2)
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
+)
+
+// bufferedConn is a redcon.Conn that buffers replies instead of writing them
+// to the client, so they can be discarded if the transaction that produced
+// them fails to commit.
+type bufferedConn struct {
+	redcon.Conn
+	wr *redcon.Writer
+
+	// failed is true if an error was replied
+	failed bool
+}
+
+func newBufferedConn(conn redcon.Conn) *bufferedConn {
+	return &bufferedConn{Conn: conn, wr: redcon.NewWriter(nil)}
+}
+
+func (bc *bufferedConn) WriteError(msg string) {
+	bc.failed = true
+	bc.wr.WriteError(msg)
+}
+
+func (bc *bufferedConn) WriteString(str string)      { bc.wr.WriteString(str) }
+func (bc *bufferedConn) WriteBulk(bulk []byte)       { bc.wr.WriteBulk(bulk) }
+func (bc *bufferedConn) WriteBulkString(bulk string) { bc.wr.WriteBulkString(bulk) }
+func (bc *bufferedConn) WriteInt(num int)            { bc.wr.WriteInt(num) }
+func (bc *bufferedConn) WriteInt64(num int64)        { bc.wr.WriteInt64(num) }
+func (bc *bufferedConn) WriteUint64(num uint64)      { bc.wr.WriteUint64(num) }
+func (bc *bufferedConn) WriteArray(count int)        { bc.wr.WriteArray(count) }
+func (bc *bufferedConn) WriteNull()                  { bc.wr.WriteNull() }
+func (bc *bufferedConn) WriteRaw(data []byte)        { bc.wr.WriteRaw(data) }
+func (bc *bufferedConn) WriteAny(v interface{})      { bc.wr.WriteAny(v) }
+
+// Bytes returns the buffered replies
+func (bc *bufferedConn) Bytes() []byte { return bc.wr.Buffer() }
+
+// queue queues a copy of cmd for execution by EXEC. The arguments of cmd are
+// only valid for the duration of the handler so they must be copied.
+func (cl *client) queue(cmd redcon.Command) {
+	args := make([][]byte, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = append([]byte(nil), arg...)
+	}
+	cl.queued = append(cl.queued, redcon.Command{Args: args})
+}
+
+// abort flags the current MULTI block (if any) as failed because an invalid
+// command was queued, EXEC will then discard the transaction.
+func (cl *client) abort() {
+	if cl.multi {
+		cl.aborted = true
+	}
+}
+
+// reset ends the current MULTI block
+func (cl *client) reset() {
+	cl.multi = false
+	cl.queued = nil
+	cl.aborted = false
+}
+
+// unwatch removes all the keys watched by the client, the caller must hold
+// the server lock.
+func (s *server) unwatch(cl *client) {
+	for _, key := range cl.watching {
+		delete(s.watchers[key], cl)
+		if len(s.watchers[key]) == 0 {
+			delete(s.watchers, key)
+		}
+	}
+	cl.watching = nil
+	cl.dirty = false
+}
+
+// touch marks the clients watching any of the keys modified by cmd as dirty
+// so their next EXEC fails. Write commands without key positions (FLUSHDB)
+// may modify any key. The caller must hold the server lock.
+func (s *server) touch(c *command, cmd redcon.Command) {
+	if len(s.watchers) == 0 {
+		return
+	}
+
+	if c.first == 0 {
+		for _, clients := range s.watchers {
+			for cl := range clients {
+				cl.dirty = true
+			}
+		}
+		return
+	}
+
+	s.touchKeys(c.keys(cmd)...)
+}
+
+// touchKeys marks the clients watching any of keys as dirty, the caller must
+// hold the server lock.
+func (s *server) touchKeys(keys ...[]byte) {
+	for _, key := range keys {
+		for cl := range s.watchers[string(key)] {
+			cl.dirty = true
+		}
+	}
+}
+
+func (s *server) handleMulti(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+	if cl.multi {
+		conn.WriteError("ERR MULTI calls can not be nested")
+		return
+	}
+	cl.multi = true
+	conn.WriteString("OK")
+}
+
+func (s *server) handleDiscard(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+	if !cl.multi {
+		conn.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	cl.reset()
+
+	s.mu.Lock()
+	s.unwatch(cl)
+	s.mu.Unlock()
+
+	conn.WriteString("OK")
+}
+
+func (s *server) handleWatch(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+	if cl.multi {
+		conn.WriteError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, arg := range cmd.Args[1:] {
+		key := string(arg)
+		if _, ok := s.watchers[key][cl]; ok {
+			continue
+		}
+		if s.watchers[key] == nil {
+			s.watchers[key] = make(map[*client]struct{})
+		}
+		s.watchers[key][cl] = struct{}{}
+		cl.watching = append(cl.watching, key)
+	}
+
+	conn.WriteString("OK")
+}
+
+func (s *server) handleUnwatch(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	s.mu.Lock()
+	s.unwatch(clientOf(conn))
+	s.mu.Unlock()
+
+	conn.WriteString("OK")
+}
+
+// handleExec applies all commands queued since MULTI through a single
+// transaction. Nothing is applied if any of the watched keys were modified
+// since WATCH or if an invalid command was queued.
+func (s *server) handleExec(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+	if !cl.multi {
+		conn.WriteError("ERR EXEC without MULTI")
+		return
+	}
+
+	queued, aborted := cl.queued, cl.aborted
+	cl.reset()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirty := cl.dirty
+	s.unwatch(cl)
+
+	if aborted {
+		conn.WriteError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	if dirty {
+		// A null array tells the client the transaction was not applied
+		conn.WriteRaw([]byte("*-1\r\n"))
+		return
+	}
+
+	tx = s.db.Transaction()
+	defer tx.Discard()
+
+	bc := newBufferedConn(conn)
+	bc.WriteArray(len(queued))
+	for _, cmd := range queued {
+		c := lookupCommand(cmd)
+		if c.hasFlag("readonly") || c.hasFlag("write") {
+			c.fn(s, tx, cmd, bc)
+		} else {
+			c.fn(s, nil, cmd, bc)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		cl.notifications = nil
+		writeError(conn, err)
+		return
+	}
+
+	for _, cmd := range queued {
+		if c := lookupCommand(cmd); c.hasFlag("write") {
+			s.touch(c, cmd)
+		}
+	}
+
+	conn.WriteRaw(bc.Bytes())
+	s.publishNotifications(cl)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
+)
+
+// Keyspace notification classes as configured with notify-keyspace-events
+const (
+	notifyKeyspace = 1 << iota // K: __keyspace@0__:<key> channels
+	notifyKeyevent             // E: __keyevent@0__:<event> channels
+	notifyGeneric              // g: generic commands such as DEL
+	notifyString               // $: string commands
+	notifyList                 // l: list commands
+	notifyHash                 // h: hash commands
+	notifyZSet                 // z: sorted set commands
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifyHash | notifyZSet
+)
+
+// parseNotifyFlags parses a notify-keyspace-events string using the same
+// characters as Redis, e.g: "KEA" or "K$g".
+func parseNotifyFlags(s string) (int, error) {
+	flags := 0
+	for _, c := range s {
+		switch c {
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'A':
+			flags |= notifyAll
+		default:
+			return 0, fmt.Errorf("invalid keyspace notification class %q", c)
+		}
+	}
+	return flags, nil
+}
+
+// notification is a keyspace event produced by a write command, it is only
+// published once the transaction the command ran in is committed.
+type notification struct {
+	event string
+	key   string
+}
+
+// notifying returns true if keyspace events of the given class are published
+func (s *server) notifying(class int) bool {
+	return s.notifyFlags&(notifyKeyspace|notifyKeyevent) != 0 && s.notifyFlags&class != 0
+}
+
+// notify records a keyspace event of the given class for key on the client
+// connected on conn if notifications for the class are enabled.
+func (s *server) notify(conn redcon.Conn, class int, event string, key []byte) {
+	if !s.notifying(class) {
+		return
+	}
+	cl := clientOf(conn)
+	cl.notifications = append(cl.notifications, notification{event, string(key)})
+}
+
+// publishNotifications publishes the keyspace events recorded for the client
+func (s *server) publishNotifications(cl *client) {
+	for _, n := range cl.notifications {
+		s.publishNotification(n)
+	}
+	cl.notifications = nil
+}
+
+func (s *server) publishNotification(n notification) {
+	if s.notifyFlags&notifyKeyspace != 0 {
+		s.pubsub.Publish("__keyspace@0__:"+n.key, n.event)
+	}
+	if s.notifyFlags&notifyKeyevent != 0 {
+		s.pubsub.Publish("__keyevent@0__:"+n.event, n.key)
+	}
+}
+
+// handleSubscribe implements SUBSCRIBE and PSUBSCRIBE. The connection is
+// detached from the server and served by redcon's PubSub from then on, which
+// also handles any further (P)SUBSCRIBE, (P)UNSUBSCRIBE, PING and QUIT.
+func (s *server) handleSubscribe(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	cl := clientOf(conn)
+	if cl.multi {
+		cl.abort()
+		conn.WriteError("ERR Command not allowed inside a transaction")
+		return
+	}
+
+	// Detached connections are never reported as closed to the server
+	s.mu.Lock()
+	s.unwatch(cl)
+	s.mu.Unlock()
+
+	pattern := strings.ToLower(string(cmd.Args[0])) == "psubscribe"
+	for _, channel := range cmd.Args[1:] {
+		if pattern {
+			s.pubsub.Psubscribe(conn, string(channel))
+		} else {
+			s.pubsub.Subscribe(conn, string(channel))
+		}
+	}
+}
+
+// handleUnsubscribe implements UNSUBSCRIBE and PUNSUBSCRIBE for clients that
+// are not subscribed to any channel.
+func (s *server) handleUnsubscribe(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteArray(3)
+	conn.WriteBulkString(strings.ToLower(string(cmd.Args[0])))
+	conn.WriteNull()
+	conn.WriteInt(0)
+}
+
+func (s *server) handlePublish(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteInt(s.pubsub.Publish(string(cmd.Args[1]), string(cmd.Args[2])))
+}
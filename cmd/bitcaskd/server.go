@@ -1,134 +1,530 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/redcon"
 
 	"go.mills.io/bitcask/v2"
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/metrics"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 type server struct {
-	bind string
-	db   bitcask.DB
+	// mu serializes commands that modify the database and guards watchers
+	mu       sync.Mutex
+	watchers map[string]map[*client]struct{}
+
+	pubsub      redcon.PubSub
+	notifyFlags int
+
+	// users maps user names to passwords, if empty no auth is required
+	users map[string]string
+
+	// nextID is the id of the last connected client
+	nextID int64
+
+	bind       string
+	unixSocket string
+	httpBind   string
+	backupDir  string
+	tlsConfig  *tls.Config
+	metrics    *metrics.Prometheus
+	db         bitcask.DB
+
+	// maxValueSize is the value size limit of the database, 0 is unlimited
+	maxValueSize uint64
+}
+
+// option configures optional server behaviour
+type option func(*server) error
+
+// withNotifyKeyspaceEvents enables keyspace notifications for the classes of
+// events given in Redis' notify-keyspace-events format.
+func withNotifyKeyspaceEvents(events string) option {
+	return func(s *server) error {
+		flags, err := parseNotifyFlags(events)
+		if err != nil {
+			return err
+		}
+		s.notifyFlags = flags
+		return nil
+	}
+}
+
+// client holds the per-connection state of a connected client
+type client struct {
+	id   int64
+	name string
+
+	// user is the name of the user the client authenticated as
+	user string
+
+	// multi is true while the client is queueing commands for EXEC
+	multi    bool
+	queued   []redcon.Command
+	aborted  bool
+	watching []string
+
+	// dirty is set (under server.mu) when a watched key is modified
+	dirty bool
+
+	// notifications are the keyspace events of the commands being executed
+	notifications []notification
 }
 
-func newServer(bind, path string) (*server, error) {
-	db, err := bitcask.Open(path)
+// clientOf returns the state of the client connected on conn
+func clientOf(conn redcon.Conn) *client {
+	cl, _ := conn.Context().(*client)
+	if cl == nil {
+		cl = &client{}
+		conn.SetContext(cl)
+	}
+	return cl
+}
+
+func newServer(bind, path string, options ...option) (*server, error) {
+	s := &server{
+		watchers: make(map[string]map[*client]struct{}),
+		users:    make(map[string]string),
+		bind:     bind,
+		metrics:  metrics.NewPrometheus("bitcask"),
+	}
+
+	for _, opt := range options {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bitcask.Open(path, bitcask.WithObserver(s.metrics))
 	if err != nil {
 		log.WithError(err).WithField("path", path).Error("error opening database")
 		return nil, err
 	}
+	s.db = db
+	s.metrics.AddGauges(bitcask.StatsGauges(db))
+
+	// Open saved the configuration of the database, its value size limit
+	// bounds the request bodies read by the HTTP/JSON gateway
+	cfg, err := config.Load(vfs.OS, filepath.Join(path, "config.json"))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.maxValueSize = cfg.MaxValueSize
+
+	return s, nil
+}
+
+func writeArgsError(cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+}
+
+func writeError(conn redcon.Conn, err error) {
+	conn.WriteError(fmt.Sprintf("ERR %s", err))
+}
+
+func (s *server) handlePing(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	switch len(cmd.Args) {
+	case 1:
+		conn.WriteString("PONG")
+	case 2:
+		conn.WriteBulk(cmd.Args[1])
+	default:
+		writeArgsError(cmd, conn)
+	}
+}
 
-	return &server{
-		bind: bind,
-		db:   db,
-	}, nil
+func (s *server) handleQuit(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteString("OK")
+	conn.Close()
 }
 
-func (s *server) handleSet(cmd redcon.Command, conn redcon.Conn) {
-	if len(cmd.Args) < 3 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+func (s *server) handleSelect(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if string(cmd.Args[1]) != "0" {
+		conn.WriteError("ERR DB index is out of range")
 		return
 	}
+	conn.WriteString("OK")
+}
 
-	key := cmd.Args[1]
-	value := cmd.Args[2]
+func (s *server) handleClient(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	c := clientOf(conn)
 
-	if err := s.db.Put(key, value); err != nil {
-		conn.WriteString(fmt.Sprintf("ERR: %s", err))
+	switch strings.ToLower(string(cmd.Args[1])) {
+	case "setname":
+		if len(cmd.Args) != 3 {
+			writeArgsError(cmd, conn)
+			return
+		}
+		if strings.ContainsAny(string(cmd.Args[2]), " \n") {
+			conn.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+			return
+		}
+		c.name = string(cmd.Args[2])
+		conn.WriteString("OK")
+	case "getname":
+		if c.name == "" {
+			conn.WriteNull()
+			return
+		}
+		conn.WriteBulkString(c.name)
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try CLIENT HELP.")
+	}
+}
+
+func (s *server) handleInfo(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	stats, err := s.db.Stats()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("# Server\r\n")
+	sb.WriteString(fmt.Sprintf("bitcask_version:%s\r\n", strings.TrimSpace(internal.FullVersion())))
+	sb.WriteString(fmt.Sprintf("process_id:%d\r\n", os.Getpid()))
+	sb.WriteString("\r\n")
+
+	sb.WriteString("# Stats\r\n")
+	sb.WriteString(fmt.Sprintf("datafiles:%d\r\n", stats.Datafiles))
+	sb.WriteString(fmt.Sprintf("disk_size:%d\r\n", stats.Size))
+	sb.WriteString(fmt.Sprintf("reclaimable_space:%d\r\n", stats.Reclaimable))
+	sb.WriteString("\r\n")
+
+	sb.WriteString("# Keyspace\r\n")
+	if stats.Keys > 0 {
+		sb.WriteString(fmt.Sprintf("db0:keys=%d,expires=0,avg_ttl=0\r\n", stats.Keys))
+	}
+
+	conn.WriteBulkString(sb.String())
+}
+
+func (s *server) handleDBSize(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteInt(tx.Len())
+}
+
+func (s *server) handleFlushDB(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args) > 2 {
+		conn.WriteError("ERR syntax error")
+		return
+	}
+
+	var keys []bitcask.Key
+	if err := tx.ForEach(func(key bitcask.Key) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	for _, key := range keys {
+		if err := tx.Delete(key); err != nil {
+			writeError(conn, err)
+			return
+		}
 	}
 
 	conn.WriteString("OK")
 }
 
-func (s *server) handleGet(cmd redcon.Command, conn redcon.Conn) {
-	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+func (s *server) handleSet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args) != 3 {
+		conn.WriteError("ERR syntax error")
 		return
 	}
 
 	key := cmd.Args[1]
+	value := cmd.Args[2]
 
-	value, err := s.db.Get(key)
+	if err := tx.Put(key, value); err != nil {
+		writeError(conn, err)
+		return
+	}
+	s.notify(conn, notifyString, "set", key)
+
+	conn.WriteString("OK")
+}
+
+func (s *server) handleGet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	key := cmd.Args[1]
+
+	value, err := tx.Get(key)
 	if err != nil {
-		conn.WriteNull()
-	} else {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			conn.WriteNull()
+			return
+		}
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteBulk(value)
+}
+
+func (s *server) handleMGet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	conn.WriteArray(len(cmd.Args) - 1)
+	for _, key := range cmd.Args[1:] {
+		value, err := tx.Get(key)
+		if err != nil {
+			// MGET never fails, missing (or unreadable) keys are nil
+			conn.WriteNull()
+			continue
+		}
 		conn.WriteBulk(value)
 	}
 }
 
-func (s *server) handleKeys(cmd redcon.Command, conn redcon.Conn) {
-	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+func (s *server) handleMSet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args)%2 != 1 {
+		writeArgsError(cmd, conn)
 		return
 	}
 
-	pattern := string(cmd.Args[1])
+	for i := 1; i < len(cmd.Args); i += 2 {
+		if err := tx.Put(cmd.Args[i], cmd.Args[i+1]); err != nil {
+			writeError(conn, err)
+			return
+		}
+		s.notify(conn, notifyString, "set", cmd.Args[i])
+	}
+
+	conn.WriteString("OK")
+}
 
-	// Fast-track condition for improved speed
-	if pattern == "*" {
-		conn.WriteArray(s.db.Len())
-		s.db.ForEach(func(key bitcask.Key) error {
-			conn.WriteBulk(key)
-			return nil
-		})
+func (s *server) handleStrlen(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	value, err := tx.Get(cmd.Args[1])
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			conn.WriteInt(0)
+			return
+		}
+		writeError(conn, err)
 		return
 	}
 
-	// Prefix handling
-	if strings.Count(pattern, "*") == 1 && strings.HasSuffix(pattern, "*") {
-		prefix := strings.ReplaceAll(pattern, "*", "")
-		count := 0
-		keys := make([][]byte, 0)
-		s.db.Scan([]byte(prefix), func(key bitcask.Key) error {
-			keys = append(keys, key)
-			count++
-			return nil
-		})
-		conn.WriteArray(count)
-		for _, key := range keys {
-			conn.WriteBulk(key)
-		}
+	conn.WriteInt(len(value))
+}
+
+func (s *server) handleAppend(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	key := cmd.Args[1]
+
+	value, err := tx.Get(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		writeError(conn, err)
 		return
 	}
 
-	// No results means empty array
-	conn.WriteArray(0)
+	value = append(value, cmd.Args[2]...)
+	if err := tx.Put(key, value); err != nil {
+		writeError(conn, err)
+		return
+	}
+	s.notify(conn, notifyString, "append", key)
+
+	conn.WriteInt(len(value))
 }
 
-func (s *server) handleExists(cmd redcon.Command, conn redcon.Conn) {
+func (s *server) handleKeys(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
 	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		writeArgsError(cmd, conn)
 		return
 	}
 
-	key := cmd.Args[1]
+	pattern := string(cmd.Args[1])
+
+	var keys []bitcask.Key
+	collect := func(key bitcask.Key) error {
+		keys = append(keys, key)
+		return nil
+	}
+
+	var err error
+	switch prefix, ok := globPrefix(pattern); {
+	case pattern == "*":
+		// Fast-track condition for improved speed
+		err = tx.ForEach(collect)
+	case ok:
+		// Prefix handling, unsupported by unordered keydirs
+		err = tx.Scan([]byte(prefix), collect)
+	}
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	// No results means empty array
+	conn.WriteArray(len(keys))
+	for _, key := range keys {
+		conn.WriteBulk(key)
+	}
+}
+
+// globPrefix returns the prefix matched by a glob pattern of the form
+// "prefix*" where the prefix may contain glob characters escaped with \.
+func globPrefix(pattern string) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return "", false
+			}
+			i++
+			sb.WriteByte(pattern[i])
+		case '*':
+			return sb.String(), i == len(pattern)-1
+		case '?', '[':
+			return "", false
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+func (s *server) handleExists(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	count := 0
+	for _, key := range cmd.Args[1:] {
+		if tx.Has(key) {
+			count++
+		}
+	}
+	conn.WriteInt(count)
+}
+
+func (s *server) handleDel(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	count := 0
+	for _, key := range cmd.Args[1:] {
+		if !tx.Has(key) {
+			continue
+		}
+		if err := tx.Delete(key); err != nil {
+			writeError(conn, err)
+			return
+		}
+		s.notify(conn, notifyGeneric, "del", key)
+		count++
+	}
+
+	conn.WriteInt(count)
+}
 
-	if s.db.Has(key) {
-		conn.WriteInt(1)
+// handleTTL implements TTL and PTTL. Bitcask has no support for expiring
+// keys, so existing keys never expire (-1) and missing keys return -2.
+func (s *server) handleTTL(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if tx.Has(cmd.Args[1]) {
+		conn.WriteInt(-1)
 	} else {
-		conn.WriteInt(0)
+		conn.WriteInt(-2)
 	}
 }
 
-func (s *server) handleDel(cmd redcon.Command, conn redcon.Conn) {
-	if len(cmd.Args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+// ServeRESP dispatches a single command from a connected client to its
+// handler, or queues it if the client is in a MULTI block.
+func (s *server) ServeRESP(conn redcon.Conn, cmd redcon.Command) {
+	cl := clientOf(conn)
+
+	c := lookupCommand(cmd)
+	if c == nil {
+		cl.abort()
+		conn.WriteError("ERR unknown command '" + string(cmd.Args[0]) + "'")
 		return
 	}
 
-	key := cmd.Args[1]
+	if !c.validArity(cmd) {
+		cl.abort()
+		writeArgsError(cmd, conn)
+		return
+	}
 
-	if err := s.db.Delete(key); err != nil {
-		conn.WriteInt(0)
-	} else {
-		conn.WriteInt(1)
+	if s.authRequired(cl) && !c.hasFlag("no-auth") {
+		cl.abort()
+		conn.WriteError("NOAUTH Authentication required.")
+		return
+	}
+
+	if cl.multi && !c.hasFlag("no-multi") {
+		cl.queue(cmd)
+		conn.WriteString("QUEUED")
+		return
+	}
+
+	s.execute(conn, c, cmd)
+}
+
+// execute runs a command against its own transaction. Replies to write
+// commands are only sent to the client once the transaction is committed.
+func (s *server) execute(conn redcon.Conn, c *command, cmd redcon.Command) {
+	switch {
+	case c.hasFlag("write"):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		tx := s.db.Transaction()
+		defer tx.Discard()
+
+		bc := newBufferedConn(conn)
+		c.fn(s, tx, cmd, bc)
+
+		// Commands which fail apply none of their writes, unlike within
+		// EXEC where the other commands are still applied
+		if bc.failed {
+			tx.Discard()
+			clientOf(conn).notifications = nil
+			conn.WriteRaw(bc.Bytes())
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			clientOf(conn).notifications = nil
+			writeError(conn, err)
+			return
+		}
+		s.touch(c, cmd)
+		conn.WriteRaw(bc.Bytes())
+		s.publishNotifications(clientOf(conn))
+	case c.hasFlag("readonly"):
+		tx := s.db.Transaction()
+		defer tx.Discard()
+
+		c.fn(s, tx, cmd, conn)
+	default:
+		c.fn(s, nil, cmd, conn)
+	}
+}
+
+// accept is called when a new client connects and sets up its state
+func (s *server) accept(conn redcon.Conn) bool {
+	conn.SetContext(&client{id: atomic.AddInt64(&s.nextID, 1)})
+	return true
+}
+
+// closed is called when a client connection is closed
+func (s *server) closed(conn redcon.Conn, err error) {
+	if cl, ok := conn.Context().(*client); ok {
+		s.mu.Lock()
+		s.unwatch(cl)
+		s.mu.Unlock()
 	}
 }
 
@@ -138,44 +534,66 @@ func (s *server) Shutdown() (err error) {
 }
 
 func (s *server) Run() (err error) {
-	redServer := redcon.NewServerNetwork("tcp", s.bind,
-		func(conn redcon.Conn, cmd redcon.Command) {
-			switch strings.ToLower(string(cmd.Args[0])) {
-			case "ping":
-				conn.WriteString("PONG")
-			case "quit":
-				conn.WriteString("OK")
-				conn.Close()
-			case "set":
-				s.handleSet(cmd, conn)
-			case "get":
-				s.handleGet(cmd, conn)
-			case "keys":
-				s.handleKeys(cmd, conn)
-			case "exists":
-				s.handleExists(cmd, conn)
-			case "del":
-				s.handleDel(cmd, conn)
-			default:
-				conn.WriteError("ERR unknown command '" + string(cmd.Args[0]) + "'")
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	var closers []io.Closer
+	errs := make(chan error, len(listeners)+1)
+	for _, ln := range listeners {
+		rs := redcon.NewServerNetwork(ln.Addr().Network(), ln.Addr().String(),
+			s.ServeRESP, s.accept, s.closed,
+		)
+		go func(ln net.Listener) {
+			errs <- rs.Serve(ln)
+		}(ln)
+		closers = append(closers, rs)
+	}
+
+	if s.httpBind != "" {
+		hs := &http.Server{
+			Addr:      s.httpBind,
+			Handler:   s.httpHandler(),
+			TLSConfig: s.tlsConfig,
+		}
+		go func() {
+			var err error
+			if s.tlsConfig != nil {
+				err = hs.ListenAndServeTLS("", "")
+			} else {
+				err = hs.ListenAndServe()
 			}
-		},
-		func(conn redcon.Conn) bool {
-			return true
-		},
-		func(conn redcon.Conn, err error) {
-		},
-	)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}()
+		closers = append(closers, hs)
+	}
+
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
 
 	go func() {
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 		s := <-signals
 		log.Infof("Shutdown server on signal %s", s)
-		redServer.Close()
+		closeAll()
 	}()
 
-	if err := redServer.ListenAndServe(); err == nil {
+	// Stop serving on all listeners as soon as one of them stops
+	err = <-errs
+	closeAll()
+	for i := 1; i < len(closers); i++ {
+		<-errs
+	}
+
+	if err == nil {
 		return s.Shutdown()
 	}
 	return
@@ -1,18 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
 )
 
 func TestHandleKeys(t *testing.T) {
-	s, err := newServer(":61234", "./test.db")
+	s, err := newServer(":61234", t.TempDir())
 	if err != nil {
 		t.Fatalf("Unable to create server: %v", err)
 	}
+	defer s.Shutdown()
 	s.db.Put([]byte("foo"), []byte("bar"))
 	testCases := []TestCase{
 		{
@@ -46,13 +56,33 @@ func TestHandleKeys(t *testing.T) {
 	}
 	for _, testCase := range testCases {
 		conn := DummyConn{}
-		s.handleKeys(testCase.Command, &conn)
+		s.handleKeys(s.db.Transaction(), testCase.Command, &conn)
 		if testCase.Expected != conn.Result {
 			t.Fatalf("s.handleKeys failed: expected '%s', got '%s'", testCase.Expected, conn.Result)
 		}
 	}
 }
 
+func TestHandleKeysUnordered(t *testing.T) {
+	s, err := newServer(":61234", t.TempDir())
+	require.NoError(t, err)
+	defer s.Shutdown()
+
+	// Prefix scans are unsupported by the hashed keydir
+	require.NoError(t, s.db.Close())
+	s.db, err = bitcask.Open(t.TempDir(), bitcask.WithKeydir(bitcask.KeydirHashed))
+	require.NoError(t, err)
+	require.NoError(t, s.db.Put([]byte("foo"), []byte("bar")))
+
+	conn := DummyConn{}
+	s.handleKeys(s.db.Transaction(), redcon.Command{Args: [][]byte{[]byte("KEYS"), []byte("*")}}, &conn)
+	assert.Equal(t, "1,foo", conn.Result)
+
+	conn = DummyConn{}
+	s.handleKeys(s.db.Transaction(), redcon.Command{Args: [][]byte{[]byte("KEYS"), []byte("fo*")}}, &conn)
+	assert.Equal(t, "-ERR "+bitcask.ErrUnordered.Error(), conn.Result)
+}
+
 type TestCase struct {
 	Command  redcon.Command
 	Expected string
@@ -68,7 +98,9 @@ func (dc *DummyConn) RemoteAddr() string {
 func (dc *DummyConn) Close() error {
 	return nil
 }
-func (dc *DummyConn) WriteError(msg string)  {}
+func (dc *DummyConn) WriteError(msg string) {
+	dc.Result = "-" + msg
+}
 func (dc *DummyConn) WriteString(str string) {}
 func (dc *DummyConn) WriteBulk(bulk []byte) {
 	dc.Result += "," + string(bulk)
@@ -100,3 +132,531 @@ func (dc *DummyConn) PeekPipeline() []redcon.Command {
 func (dc *DummyConn) NetConn() net.Conn {
 	return nil
 }
+
+// startTestServer starts a server backed by a fresh database listening on a
+// random local port and returns a connected RESP test client.
+func startTestServer(t *testing.T, options ...option) (*server, *respClient) {
+	t.Helper()
+
+	s := serveTestServer(t, options...)
+	return s, dialTestServer(t, s.bind)
+}
+
+// serveTestServer starts a server backed by a fresh database on a random
+// local port (and any other configured listeners).
+func serveTestServer(t *testing.T, options ...option) *server {
+	t.Helper()
+
+	s, err := newServer("127.0.0.1:0", t.TempDir(), options...)
+	if err != nil {
+		t.Fatalf("Unable to create server: %v", err)
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		t.Fatalf("Unable to start server: %v", err)
+	}
+	s.bind = listeners[0].Addr().String()
+
+	var redServers []*redcon.Server
+	for _, ln := range listeners {
+		rs := redcon.NewServerNetwork(ln.Addr().Network(), ln.Addr().String(), s.ServeRESP, s.accept, s.closed)
+		go rs.Serve(ln)
+		redServers = append(redServers, rs)
+	}
+	t.Cleanup(func() {
+		for _, rs := range redServers {
+			rs.Close()
+		}
+		s.Shutdown()
+	})
+
+	return s
+}
+
+type respError string
+
+func (e respError) Error() string { return string(e) }
+
+// respClient is a minimal RESP client used to test the server over the wire
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dialTestServer(t *testing.T, addr string) *respClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to connect to server: %v", err)
+	}
+
+	return newRespClient(t, conn)
+}
+
+func newRespClient(t *testing.T, conn net.Conn) *respClient {
+	t.Cleanup(func() { conn.Close() })
+
+	return &respClient{t: t, conn: conn, rd: bufio.NewReader(conn)}
+}
+
+// Do sends a command and returns its reply which is one of: string (simple
+// string), respError, int64, []byte (bulk), nil or []interface{} (array).
+func (c *respClient) Do(args ...string) interface{} {
+	c.t.Helper()
+
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		c.t.Fatalf("error writing command: %v", err)
+	}
+
+	return c.Receive()
+}
+
+// Receive reads the next reply, e.g: a message published to a subscriber
+func (c *respClient) Receive() interface{} {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := c.readReply()
+	if err != nil {
+		c.t.Fatalf("error reading reply: %v", err)
+	}
+	return reply
+}
+
+func (c *respClient) readReply() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+func bulks(values ...string) []interface{} {
+	items := make([]interface{}, len(values))
+	for i, value := range values {
+		items[i] = []byte(value)
+	}
+	return items
+}
+
+func TestStringCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal("PONG", c.Do("PING"))
+	assert.Equal([]byte("hello"), c.Do("PING", "hello"))
+	assert.Equal("OK", c.Do("SET", "foo", "bar"))
+	assert.Equal([]byte("bar"), c.Do("GET", "foo"))
+	assert.Nil(c.Do("GET", "missing"))
+	assert.IsType(respError(""), c.Do("SET", "foo"))
+	assert.IsType(respError(""), c.Do("SET", "foo", "bar", "baz"))
+
+	assert.Equal("OK", c.Do("MSET", "a", "1", "b", "2"))
+	assert.IsType(respError(""), c.Do("MSET", "a", "1", "b"))
+	assert.Equal([]interface{}{[]byte("1"), nil, []byte("2")}, c.Do("MGET", "a", "missing", "b"))
+
+	assert.Equal(int64(3), c.Do("STRLEN", "foo"))
+	assert.Equal(int64(0), c.Do("STRLEN", "missing"))
+	assert.Equal(int64(6), c.Do("APPEND", "foo", "baz"))
+	assert.Equal([]byte("barbaz"), c.Do("GET", "foo"))
+	assert.Equal(int64(5), c.Do("APPEND", "new", "value"))
+
+	assert.Equal(int64(-1), c.Do("TTL", "foo"))
+	assert.Equal(int64(-2), c.Do("TTL", "missing"))
+}
+
+func TestKeyspaceCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal("OK", c.Do("MSET", "a", "1", "b", "2", "c", "3"))
+	assert.Equal(int64(3), c.Do("DBSIZE"))
+	assert.Equal(int64(2), c.Do("EXISTS", "a", "b", "missing"))
+	assert.Equal(int64(2), c.Do("DEL", "a", "b", "missing"))
+	assert.Equal(int64(1), c.Do("DBSIZE"))
+	assert.Equal(bulks("c"), c.Do("KEYS", "*"))
+
+	assert.Equal("OK", c.Do("FLUSHDB"))
+	assert.Equal(int64(0), c.Do("DBSIZE"))
+	assert.Equal([]interface{}{}, c.Do("KEYS", "*"))
+}
+
+func TestServerCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal("OK", c.Do("SELECT", "0"))
+	assert.IsType(respError(""), c.Do("SELECT", "1"))
+
+	assert.Nil(c.Do("CLIENT", "GETNAME"))
+	assert.Equal("OK", c.Do("CLIENT", "SETNAME", "test"))
+	assert.Equal([]byte("test"), c.Do("CLIENT", "GETNAME"))
+
+	assert.Equal(int64(len(commands)), c.Do("COMMAND", "COUNT"))
+	info := c.Do("COMMAND", "INFO", "get", "nosuchcommand").([]interface{})
+	assert.Len(info, 2)
+	assert.Equal([]byte("get"), info[0].([]interface{})[0])
+	assert.Equal(int64(2), info[0].([]interface{})[1])
+	assert.Nil(info[1])
+
+	assert.Equal("OK", c.Do("SET", "foo", "bar"))
+	assert.Contains(string(c.Do("INFO").([]byte)), "db0:keys=1")
+
+	assert.Equal(respError("ERR unknown command 'NOSUCHCOMMAND'"), c.Do("NOSUCHCOMMAND"))
+	assert.Equal(respError("ERR wrong number of arguments for 'GET' command"), c.Do("GET"))
+}
+
+func TestHashCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal(int64(2), c.Do("HSET", "user", "name", "James", "age", "21"))
+	assert.Equal(int64(1), c.Do("HSET", "user", "age", "22", "sex", "Male"))
+	assert.IsType(respError(""), c.Do("HSET", "user", "name"))
+
+	assert.Equal([]byte("22"), c.Do("HGET", "user", "age"))
+	assert.Nil(c.Do("HGET", "user", "missing"))
+	assert.Equal([]interface{}{[]byte("James"), nil, []byte("Male")}, c.Do("HMGET", "user", "name", "missing", "sex"))
+	assert.Equal(bulks("age", "22", "name", "James", "sex", "Male"), c.Do("HGETALL", "user"))
+
+	assert.Equal(int64(1), c.Do("HDEL", "user", "sex", "missing"))
+	assert.Equal(bulks("age", "22", "name", "James"), c.Do("HGETALL", "user"))
+	assert.Equal(int64(2), c.Do("HDEL", "user", "age", "name"))
+	assert.Equal([]interface{}{}, c.Do("HGETALL", "user"))
+}
+
+func TestListCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal(int64(0), c.Do("LLEN", "fruits"))
+	assert.Equal(int64(3), c.Do("RPUSH", "fruits", "apple", "banana", "cherry"))
+	assert.Equal(int64(4), c.Do("RPUSH", "fruits", "date"))
+	assert.Equal(int64(4), c.Do("LLEN", "fruits"))
+
+	assert.Equal([]byte("apple"), c.Do("LINDEX", "fruits", "0"))
+	assert.Equal([]byte("date"), c.Do("LINDEX", "fruits", "-1"))
+	assert.Nil(c.Do("LINDEX", "fruits", "10"))
+
+	assert.Equal(bulks("apple", "banana", "cherry", "date"), c.Do("LRANGE", "fruits", "0", "-1"))
+	assert.Equal(bulks("banana", "cherry"), c.Do("LRANGE", "fruits", "1", "2"))
+	assert.Equal(bulks("cherry", "date"), c.Do("LRANGE", "fruits", "-2", "100"))
+	assert.Equal([]interface{}{}, c.Do("LRANGE", "fruits", "3", "1"))
+
+	assert.Equal([]byte("date"), c.Do("RPOP", "fruits"))
+	assert.Equal([]byte("cherry"), c.Do("RPOP", "fruits"))
+	assert.Equal([]byte("banana"), c.Do("RPOP", "fruits"))
+	assert.Equal([]byte("apple"), c.Do("RPOP", "fruits"))
+	assert.Nil(c.Do("RPOP", "fruits"))
+	assert.Equal(int64(0), c.Do("LLEN", "fruits"))
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	_, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	assert.Equal(int64(4), c.Do("ZADD", "scores", "10", "alice", "-2.5", "bob", "7", "carol", "100", "dave"))
+	assert.Equal(int64(0), c.Do("ZADD", "scores", "20", "alice"))
+	assert.IsType(respError(""), c.Do("ZADD", "scores", "notafloat", "eve"))
+
+	assert.Equal([]byte("20"), c.Do("ZSCORE", "scores", "alice"))
+	assert.Equal([]byte("-2.5"), c.Do("ZSCORE", "scores", "bob"))
+	assert.Nil(c.Do("ZSCORE", "scores", "missing"))
+
+	assert.Equal(bulks("bob", "carol", "alice", "dave"), c.Do("ZRANGEBYSCORE", "scores", "-inf", "+inf"))
+	assert.Equal(bulks("carol", "alice"), c.Do("ZRANGEBYSCORE", "scores", "0", "20"))
+	assert.Equal(bulks("carol"), c.Do("ZRANGEBYSCORE", "scores", "0", "(20"))
+	assert.Equal(bulks("carol", "7", "alice", "20"), c.Do("ZRANGEBYSCORE", "scores", "(-2.5", "50", "WITHSCORES"))
+	assert.Equal(bulks("carol", "alice"), c.Do("ZRANGEBYSCORE", "scores", "-inf", "+inf", "LIMIT", "1", "2"))
+	assert.Equal([]interface{}{}, c.Do("ZRANGEBYSCORE", "scores", "50", "0"))
+	assert.IsType(respError(""), c.Do("ZRANGEBYSCORE", "scores", "foo", "0"))
+
+	assert.Equal(int64(2), c.Do("ZREM", "scores", "alice", "bob", "missing"))
+	assert.Equal(bulks("carol", "dave"), c.Do("ZRANGEBYSCORE", "scores", "-inf", "+inf"))
+}
+
+func TestTransactionCommands(t *testing.T) {
+	s, c := startTestServer(t)
+
+	t.Run("ExecAbort", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.IsType(respError(""), c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "bar"))
+		assert.IsType(respError(""), c.Do("NOSUCHCOMMAND", "foo"))
+		assert.Equal("QUEUED", c.Do("GET", "foo"))
+		assert.Equal(respError("EXECABORT Transaction discarded because of previous errors."), c.Do("EXEC"))
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "bar"))
+		assert.Equal("QUEUED", c.Do("RPUSH", "list", "a", "b"))
+		assert.Equal("QUEUED", c.Do("GET", "foo"))
+		assert.Equal("QUEUED", c.Do("PING"))
+		assert.Equal([]interface{}{"OK", int64(2), []byte("bar"), "PONG"}, c.Do("EXEC"))
+		assert.Equal([]byte("bar"), c.Do("GET", "foo"))
+		assert.IsType(respError(""), c.Do("EXEC"))
+	})
+
+	t.Run("Discard", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "discarded", "value"))
+		assert.Equal("OK", c.Do("DISCARD"))
+		assert.Nil(c.Do("GET", "discarded"))
+		assert.IsType(respError(""), c.Do("DISCARD"))
+	})
+
+	t.Run("WatchUnchanged", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("OK", c.Do("WATCH", "foo"))
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.IsType(respError(""), c.Do("WATCH", "foo"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "baz"))
+		assert.Equal([]interface{}{"OK"}, c.Do("EXEC"))
+		assert.Equal([]byte("baz"), c.Do("GET", "foo"))
+	})
+
+	t.Run("WatchModified", func(t *testing.T) {
+		assert := assert.New(t)
+
+		other := dialTestServer(t, s.bind)
+
+		assert.Equal("OK", c.Do("WATCH", "foo"))
+		assert.Equal("OK", other.Do("SET", "foo", "other"))
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "mine"))
+		assert.Nil(c.Do("EXEC"))
+		assert.Equal([]byte("other"), c.Do("GET", "foo"))
+	})
+
+	t.Run("Unwatch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		other := dialTestServer(t, s.bind)
+
+		assert.Equal("OK", c.Do("WATCH", "foo"))
+		assert.Equal("OK", c.Do("UNWATCH"))
+		assert.Equal("OK", other.Do("SET", "foo", "other"))
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "mine"))
+		assert.Equal([]interface{}{"OK"}, c.Do("EXEC"))
+	})
+
+	t.Run("WatchFlushDB", func(t *testing.T) {
+		assert := assert.New(t)
+
+		other := dialTestServer(t, s.bind)
+
+		assert.Equal("OK", c.Do("WATCH", "foo"))
+		assert.Equal("OK", other.Do("FLUSHDB"))
+		assert.Equal("OK", c.Do("MULTI"))
+		assert.Equal("QUEUED", c.Do("SET", "foo", "mine"))
+		assert.Nil(c.Do("EXEC"))
+	})
+}
+
+func TestPubSubCommands(t *testing.T) {
+	s, c := startTestServer(t)
+
+	assert := assert.New(t)
+
+	sub := dialTestServer(t, s.bind)
+	assert.Equal([]interface{}{[]byte("unsubscribe"), nil, int64(0)}, sub.Do("UNSUBSCRIBE"))
+	assert.Equal([]interface{}{[]byte("subscribe"), []byte("news"), int64(1)}, sub.Do("SUBSCRIBE", "news"))
+
+	assert.Equal(int64(1), c.Do("PUBLISH", "news", "hello"))
+	assert.Equal(int64(0), c.Do("PUBLISH", "other", "hello"))
+	assert.Equal(bulks("message", "news", "hello"), sub.Receive())
+
+	assert.Equal([]interface{}{[]byte("unsubscribe"), []byte("news"), int64(0)}, sub.Do("UNSUBSCRIBE", "news"))
+
+	assert.Equal("OK", c.Do("MULTI"))
+	assert.IsType(respError(""), c.Do("SUBSCRIBE", "news"))
+	assert.IsType(respError(""), c.Do("EXEC"))
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	s, c := startTestServer(t, withNotifyKeyspaceEvents("KEA"))
+
+	assert := assert.New(t)
+
+	sub := dialTestServer(t, s.bind)
+	assert.Equal([]interface{}{[]byte("psubscribe"), []byte("__keyspace@0__:*"), int64(1)}, sub.Do("PSUBSCRIBE", "__keyspace@0__:*"))
+
+	assert.Equal("OK", c.Do("SET", "foo", "bar"))
+	assert.Equal(bulks("pmessage", "__keyspace@0__:*", "__keyspace@0__:foo", "set"), sub.Receive())
+
+	assert.Equal(int64(1), c.Do("DEL", "foo", "missing"))
+	assert.Equal(bulks("pmessage", "__keyspace@0__:*", "__keyspace@0__:foo", "del"), sub.Receive())
+
+	// Nothing is published for transactions that are not applied
+	assert.Equal("OK", c.Do("MULTI"))
+	assert.Equal("QUEUED", c.Do("SET", "discarded", "value"))
+	assert.Equal("OK", c.Do("DISCARD"))
+
+	assert.Equal("OK", c.Do("MULTI"))
+	assert.Equal("QUEUED", c.Do("SET", "a", "1"))
+	assert.Equal("QUEUED", c.Do("HSET", "h", "f", "v"))
+	assert.Equal([]interface{}{"OK", int64(1)}, c.Do("EXEC"))
+	assert.Equal(bulks("pmessage", "__keyspace@0__:*", "__keyspace@0__:a", "set"), sub.Receive())
+	assert.Equal(bulks("pmessage", "__keyspace@0__:*", "__keyspace@0__:h", "hset"), sub.Receive())
+
+	_, err := newServer("127.0.0.1:0", t.TempDir(), withNotifyKeyspaceEvents("KX"))
+	assert.Error(err)
+}
+
+func TestFailedWriteCommands(t *testing.T) {
+	s, c := startTestServer(t, withNotifyKeyspaceEvents("KEA"))
+
+	assert := assert.New(t)
+
+	sub := dialTestServer(t, s.bind)
+	assert.Equal([]interface{}{[]byte("psubscribe"), []byte("__keyspace@0__:*"), int64(1)}, sub.Do("PSUBSCRIBE", "__keyspace@0__:*"))
+
+	// A command replying an error applies none of its writes
+	tooLarge := strings.Repeat("x", 1<<17)
+	assert.IsType(respError(""), c.Do("MSET", "k1", "v1", "k2", tooLarge))
+	assert.IsType(respError(""), c.Do("HSET", "h", "f1", "v1", "f2", tooLarge))
+	assert.Equal(int64(0), c.Do("EXISTS", "k1", "k2", "h"))
+	assert.Equal(int64(0), c.Do("DBSIZE"))
+
+	// and publishes no notifications
+	assert.Equal("OK", c.Do("SET", "foo", "bar"))
+	assert.Equal(bulks("pmessage", "__keyspace@0__:*", "__keyspace@0__:foo", "set"), sub.Receive())
+}
+
+func TestAuthCommands(t *testing.T) {
+	t.Run("NoAuth", func(t *testing.T) {
+		_, c := startTestServer(t)
+
+		assert := assert.New(t)
+
+		assert.IsType(respError(""), c.Do("AUTH", "secret"))
+		assert.Equal([]byte("default"), c.Do("ACL", "WHOAMI"))
+		assert.Equal(bulks("default"), c.Do("ACL", "USERS"))
+
+		hello := c.Do("HELLO").([]interface{})
+		assert.Len(hello, 14)
+		assert.Equal([]byte("proto"), hello[4])
+		assert.Equal(int64(2), hello[5])
+	})
+
+	t.Run("RequirePass", func(t *testing.T) {
+		_, c := startTestServer(t, withRequirePass("secret"))
+
+		assert := assert.New(t)
+
+		assert.Equal(respError("NOAUTH Authentication required."), c.Do("GET", "foo"))
+		assert.Equal(respError("NOAUTH Authentication required."), c.Do("PING"))
+		assert.Equal(respError("WRONGPASS invalid username-password pair or user is disabled."), c.Do("AUTH", "wrong"))
+		assert.Equal("OK", c.Do("AUTH", "secret"))
+		assert.Equal("PONG", c.Do("PING"))
+		assert.Nil(c.Do("GET", "foo"))
+		assert.Equal([]byte("default"), c.Do("ACL", "WHOAMI"))
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		s, c := startTestServer(t, withUsers([]string{"alice:pw", "bob:other:pw"}))
+
+		assert := assert.New(t)
+
+		assert.IsType(respError(""), c.Do("HELLO", "2"))
+		assert.Equal(respError("NOPROTO unsupported protocol version"), c.Do("HELLO", "3"))
+		assert.Equal(respError("WRONGPASS invalid username-password pair or user is disabled."), c.Do("AUTH", "alice", "wrong"))
+		assert.Equal(respError("WRONGPASS invalid username-password pair or user is disabled."), c.Do("AUTH", "pw"))
+
+		hello := c.Do("HELLO", "2", "AUTH", "alice", "pw", "SETNAME", "app").([]interface{})
+		assert.Equal([]byte("server"), hello[0])
+		assert.Equal([]byte("bitcaskd"), hello[1])
+		assert.Equal([]byte("app"), c.Do("CLIENT", "GETNAME"))
+		assert.Equal([]byte("alice"), c.Do("ACL", "WHOAMI"))
+		assert.Equal(bulks("alice", "bob"), c.Do("ACL", "USERS"))
+
+		other := dialTestServer(t, s.bind)
+		assert.Equal("OK", other.Do("AUTH", "bob", "other:pw"))
+		assert.Equal("OK", other.Do("SET", "foo", "bar"))
+	})
+
+	t.Run("InvalidUser", func(t *testing.T) {
+		_, err := newServer("127.0.0.1:0", t.TempDir(), withUsers([]string{"alice"}))
+		assert.Error(t, err)
+	})
+}
+
+func TestGlobPrefix(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		prefix  string
+		ok      bool
+	}{
+		{"foo*", "foo", true},
+		{"*", "", true},
+		{`f\*o*`, "f*o", true},
+		{`f\\*`, `f\`, true},
+		{"foo", "", false},
+		{"f*o", "", false},
+		{"f?o*", "", false},
+		{"f[o]*", "", false},
+		{`foo\`, "", false},
+	}
+	for _, testCase := range testCases {
+		prefix, ok := globPrefix(testCase.pattern)
+		assert.Equal(t, testCase.ok, ok, testCase.pattern)
+		if testCase.ok {
+			assert.Equal(t, testCase.prefix, prefix, testCase.pattern)
+		}
+	}
+}
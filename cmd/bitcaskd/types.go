@@ -0,0 +1,444 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/redcon"
+
+	"go.mills.io/bitcask/v2"
+)
+
+var errNotFloat = errors.New("min or max is not a float")
+
+func (s *server) handleHSet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args)%2 != 0 {
+		writeArgsError(cmd, conn)
+		return
+	}
+
+	h := tx.Hash(cmd.Args[1])
+
+	added := 0
+	for i := 2; i < len(cmd.Args); i += 2 {
+		if _, err := h.Get(cmd.Args[i]); errors.Is(err, bitcask.ErrKeyNotFound) {
+			added++
+		}
+	}
+
+	if err := h.MSet(cmd.Args[2:]...); err != nil {
+		writeError(conn, err)
+		return
+	}
+	s.notify(conn, notifyHash, "hset", cmd.Args[1])
+
+	conn.WriteInt(added)
+}
+
+func (s *server) handleHGet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	value, err := tx.Hash(cmd.Args[1]).Get(cmd.Args[2])
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			conn.WriteNull()
+			return
+		}
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteBulk(value)
+}
+
+func (s *server) handleHMGet(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	h := tx.Hash(cmd.Args[1])
+
+	conn.WriteArray(len(cmd.Args) - 2)
+	for _, field := range cmd.Args[2:] {
+		value, err := h.Get(field)
+		if err != nil {
+			conn.WriteNull()
+			continue
+		}
+		conn.WriteBulk(value)
+	}
+}
+
+func (s *server) handleHGetAll(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	pairs, err := tx.Hash(cmd.Args[1]).GetAll()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	fields := make([]string, 0, len(pairs))
+	for field := range pairs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	conn.WriteArray(len(fields) * 2)
+	for _, field := range fields {
+		conn.WriteBulkString(field)
+		conn.WriteBulk(pairs[field])
+	}
+}
+
+func (s *server) handleHDel(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	h := tx.Hash(cmd.Args[1])
+
+	var fields [][]byte
+	for _, field := range cmd.Args[2:] {
+		if _, err := h.Get(field); err == nil {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) > 0 {
+		if err := h.Remove(fields...); err != nil {
+			writeError(conn, err)
+			return
+		}
+		s.notify(conn, notifyHash, "hdel", cmd.Args[1])
+	}
+
+	conn.WriteInt(len(fields))
+}
+
+func (s *server) handleRPush(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	l := tx.List(cmd.Args[1])
+
+	values := make([]bitcask.Value, 0, len(cmd.Args)-2)
+	for _, value := range cmd.Args[2:] {
+		values = append(values, value)
+	}
+
+	if err := l.Append(values...); err != nil {
+		writeError(conn, err)
+		return
+	}
+	s.notify(conn, notifyList, "rpush", cmd.Args[1])
+
+	n, err := l.Len()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteInt64(n)
+}
+
+func (s *server) handleRPop(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	value, err := tx.List(cmd.Args[1]).Pop()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	if value == nil {
+		conn.WriteNull()
+		return
+	}
+	s.notify(conn, notifyList, "rpop", cmd.Args[1])
+
+	conn.WriteBulk(value)
+}
+
+func (s *server) handleLLen(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	n, err := tx.List(cmd.Args[1]).Len()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteInt64(n)
+}
+
+func (s *server) handleLIndex(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	index, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		conn.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	l := tx.List(cmd.Args[1])
+
+	n, err := l.Len()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	if index < 0 {
+		index += n
+	}
+	if index < 0 || index >= n {
+		conn.WriteNull()
+		return
+	}
+
+	value, err := l.Index(index)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteBulk(value)
+}
+
+func (s *server) handleLRange(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	start, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		conn.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+	stop, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		conn.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	l := tx.List(cmd.Args[1])
+
+	n, err := l.Len()
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	// Normalize negative indexes (counting from the end of the list) and
+	// clamp to the bounds of the list as Redis does.
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		conn.WriteArray(0)
+		return
+	}
+
+	var values [][]byte
+	if err := l.Range(start, stop, func(i int64, value []byte, quit *bool) {
+		values = append(values, value)
+	}); err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteArray(len(values))
+	for _, value := range values {
+		conn.WriteBulk(value)
+	}
+}
+
+func (s *server) handleZAdd(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	if len(cmd.Args)%2 != 0 {
+		writeArgsError(cmd, conn)
+		return
+	}
+
+	scoreMembers := make([][]byte, 0, len(cmd.Args)-2)
+	for i := 2; i < len(cmd.Args); i += 2 {
+		score, err := strconv.ParseFloat(string(cmd.Args[i]), 64)
+		if err != nil || math.IsNaN(score) {
+			conn.WriteError("ERR value is not a valid float")
+			return
+		}
+		scoreMembers = append(scoreMembers, encodeScore(score), cmd.Args[i+1])
+	}
+
+	added, err := tx.SortedSet(cmd.Args[1]).Add(scoreMembers...)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+	s.notify(conn, notifyZSet, "zadd", cmd.Args[1])
+
+	conn.WriteInt(added)
+}
+
+func (s *server) handleZScore(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	score, err := tx.SortedSet(cmd.Args[1]).Score(cmd.Args[2])
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			conn.WriteNull()
+			return
+		}
+		writeError(conn, err)
+		return
+	}
+
+	f, err := decodeScore(score)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	conn.WriteBulkString(formatScore(f))
+}
+
+func (s *server) handleZRem(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	removed, err := tx.SortedSet(cmd.Args[1]).Remove(cmd.Args[2:]...)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+	if removed > 0 {
+		s.notify(conn, notifyZSet, "zrem", cmd.Args[1])
+	}
+
+	conn.WriteInt(removed)
+}
+
+func (s *server) handleZRangeByScore(tx bitcask.Transaction, cmd redcon.Command, conn redcon.Conn) {
+	min, minExclusive, err := parseScoreBound(cmd.Args[2])
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+	max, maxExclusive, err := parseScoreBound(cmd.Args[3])
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+
+	var (
+		withScores bool
+		offset     int64
+		count      int64 = -1
+	)
+	for i := 4; i < len(cmd.Args); i++ {
+		switch strings.ToLower(string(cmd.Args[i])) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(cmd.Args) {
+				conn.WriteError("ERR syntax error")
+				return
+			}
+			if offset, err = strconv.ParseInt(string(cmd.Args[i+1]), 10, 64); err != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			if count, err = strconv.ParseInt(string(cmd.Args[i+2]), 10, 64); err != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			i += 2
+		default:
+			conn.WriteError("ERR syntax error")
+			return
+		}
+	}
+
+	type scoredMember struct {
+		score  float64
+		member []byte
+	}
+
+	var results []scoredMember
+	if min <= max && offset >= 0 {
+		var skipped int64
+		err = tx.SortedSet(cmd.Args[1]).Range(encodeScore(min), encodeScore(max), func(i int64, score bitcask.Score, member []byte, quit *bool) {
+			f, err := decodeScore(score)
+			if err != nil {
+				return
+			}
+			if (minExclusive && f == min) || (maxExclusive && f == max) {
+				return
+			}
+			if skipped < offset {
+				skipped++
+				return
+			}
+			if count >= 0 && int64(len(results)) >= count {
+				*quit = true
+				return
+			}
+			results = append(results, scoredMember{f, member})
+		})
+		if err != nil {
+			writeError(conn, err)
+			return
+		}
+	}
+
+	if withScores {
+		conn.WriteArray(len(results) * 2)
+	} else {
+		conn.WriteArray(len(results))
+	}
+	for _, result := range results {
+		conn.WriteBulk(result.member)
+		if withScores {
+			conn.WriteBulkString(formatScore(result.score))
+		}
+	}
+}
+
+// encodeScore encodes a score as a fixed width hex string which sorts
+// lexicographically in the same order as the numbers it represents and
+// never contains the space used to separate scores from members.
+func encodeScore(f float64) bitcask.Score {
+	u := math.Float64bits(f)
+	if f >= 0 {
+		u |= 1 << 63
+	} else {
+		u = ^u
+	}
+	return bitcask.Score(fmt.Sprintf("%016x", u))
+}
+
+// decodeScore decodes a score encoded with encodeScore
+func decodeScore(score bitcask.Score) (float64, error) {
+	u, err := strconv.ParseUint(string(score), 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	if u&(1<<63) != 0 {
+		u &^= 1 << 63
+	} else {
+		u = ^u
+	}
+	return math.Float64frombits(u), nil
+}
+
+// formatScore formats a score the way Redis does
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// parseScoreBound parses a min/max argument to ZRANGEBYSCORE which may be
+// prefixed with ( to indicate an exclusive bound.
+func parseScoreBound(arg []byte) (float64, bool, error) {
+	exclusive := false
+	if len(arg) > 0 && arg[0] == '(' {
+		exclusive = true
+		arg = arg[1:]
+	}
+
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false, errNotFloat
+	}
+
+	return f, exclusive, nil
+}
@@ -40,6 +40,30 @@ var (
 	// ErrMergeInProgress is the error returned if merge is called when already a merge
 	// is in progress
 	ErrMergeInProgress = errors.New("error: merge already in progress")
+
+	// ErrBackupExists is the error returned by Migrate if the backup path
+	// already exists
+	ErrBackupExists = errors.New("error: backup path already exists")
+
+	// ErrDatabaseExists is the error returned by Salvage if the destination
+	// already contains a database
+	ErrDatabaseExists = errors.New("error: database already exists")
+
+	// ErrInvalidIndexFormat is the error returned by WithIndexFormat for an
+	// unknown index format
+	ErrInvalidIndexFormat = errors.New("error: invalid index format")
+
+	// ErrInvalidKeydir is the error returned for an unknown keydir mode or
+	// one that can't hold entries of the configured maximum sizes
+	ErrInvalidKeydir = errors.New("error: invalid keydir")
+
+	// ErrUnordered is the error returned by Scan, Range and iterators when
+	// the keys aren't ordered because the database uses the hashed keydir
+	ErrUnordered = errors.New("error: keys are unordered in the hashed keydir")
+
+	// ErrInvalidFalsePositiveRate is the error returned for a false positive
+	// rate of Bloom filters not between 0 and 1
+	ErrInvalidFalsePositiveRate = errors.New("error: invalid false positive rate")
 )
 
 // ErrBadConfig is the error returned on failure to load the database config.
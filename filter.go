@@ -0,0 +1,180 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/bloom"
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+// bloomExt is the extension of the Bloom filter stored next to every
+// immutable datafile
+const bloomExt = ".bloom"
+
+func bloomPath(path string, id int) string {
+	return filepath.Join(path, fmt.Sprintf("%09d%s", id, bloomExt))
+}
+
+// keySet is the set of the hashes of the keys written to the active
+// datafile, it becomes the datafile's Bloom filter once it is immutable
+type keySet map[uint64]struct{}
+
+func (ks keySet) filter(fpRate float64) *bloom.Filter {
+	f := bloom.New(len(ks), fpRate)
+	for h := range ks {
+		f.Add(h)
+	}
+	return f
+}
+
+// addKey adds key written to the active datafile to its key set, the caller
+// must hold the lock
+func (b *bitcask) addKey(key []byte) {
+	if b.keys != nil {
+		b.keys[bloom.Hash(key)] = struct{}{}
+	}
+}
+
+// rotateFilter turns the key set of the active datafile with the given id,
+// now immutable, into its Bloom filter, the caller must hold the lock
+func (b *bitcask) rotateFilter(id int) {
+	if b.keys == nil {
+		return
+	}
+
+	f := b.keys.filter(b.config.BloomFalsePositiveRate)
+	filters := maps.Clone(b.filters)
+	filters[id] = f
+	b.filters = filters
+	b.keys = make(keySet)
+
+	// A missing filter is rebuilt when the database is opened
+	if err := b.writeFilter(id, b.datafiles[id].Size(), f); err != nil {
+		b.config.Log().Warn("error writing bloom filter", "path", b.path, "datafile", id, "error", err)
+	}
+}
+
+// writeFilter writes the filter of the datafile with the given id preceded
+// by the size of the datafile, a filter of a datafile of another size is
+// stale as the datafile was written without filters being enabled
+func (b *bitcask) writeFilter(id int, size int64, f *bloom.Filter) error {
+	a, err := vfs.CreateAtomic(b.fs, bloomPath(b.path, id), b.config.FileMode)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(a, binary.BigEndian, size); err != nil {
+		a.Abort()
+		return err
+	}
+	if _, err := f.WriteTo(a); err != nil {
+		a.Abort()
+		return err
+	}
+	return a.Commit()
+}
+
+// readFilter reads the filter of the datafile with the given id and the size
+// of the datafile it was written for
+func (b *bitcask) readFilter(id int) (int64, *bloom.Filter, error) {
+	r, err := b.fs.Open(bloomPath(b.path, id))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Close()
+
+	var size int64
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		if err == io.EOF {
+			err = bloom.ErrInvalidFilter
+		}
+		return 0, nil, err
+	}
+	f, err := bloom.Read(r)
+	return size, f, err
+}
+
+// loadFilters loads the Bloom filters of the immutable datafiles, building
+// the missing and stale ones from the keydir, and the key set of the active
+// datafile, the caller must hold the lock
+func (b *bitcask) loadFilters(readonly bool) error {
+	b.filters, b.keys = nil, nil
+	if b.config.BloomFalsePositiveRate == 0 {
+		return nil
+	}
+
+	// The filter written when the active datafile was closed is stale as
+	// soon as it is appended to
+	current := b.current.FileID()
+	if !readonly {
+		if err := b.fs.Remove(bloomPath(b.path, current)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	filters := make(map[int]*bloom.Filter, len(b.datafiles))
+	missing := make(map[int][]uint64)
+	for id, df := range b.datafiles {
+		if id == current {
+			continue
+		}
+		size, f, err := b.readFilter(id)
+		switch {
+		case err == nil && size == df.Size():
+			filters[id] = f
+			continue
+		case err == nil:
+			b.config.Log().Info("stale bloom filter, rebuilding it", "path", b.path, "datafile", id)
+		case !os.IsNotExist(err):
+			b.config.Log().Warn("error reading bloom filter, rebuilding it", "path", b.path, "datafile", id, "error", err)
+		}
+		missing[id] = nil
+	}
+
+	keys := make(keySet)
+	b.trie.Walk(func(key []byte, item internal.Item) bool {
+		if item.FileID == current {
+			keys[bloom.Hash(key)] = struct{}{}
+		} else if hashes, ok := missing[item.FileID]; ok {
+			missing[item.FileID] = append(hashes, bloom.Hash(key))
+		}
+		return false
+	})
+
+	for id, hashes := range missing {
+		f := bloom.New(len(hashes), b.config.BloomFalsePositiveRate)
+		for _, h := range hashes {
+			f.Add(h)
+		}
+		filters[id] = f
+
+		if readonly {
+			continue
+		}
+		if err := b.writeFilter(id, b.datafiles[id].Size(), f); err != nil {
+			b.config.Log().Warn("error writing bloom filter", "path", b.path, "datafile", id, "error", err)
+		}
+	}
+
+	b.filters, b.keys = filters, keys
+	return nil
+}
+
+// filterFalsePositiveRate returns the mean estimated false positive rate of
+// the Bloom filters, the caller must hold the lock
+func (b *bitcask) filterFalsePositiveRate() float64 {
+	if len(b.filters) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, f := range b.filters {
+		sum += f.FalsePositiveRate()
+	}
+	return sum / float64(len(b.filters))
+}
@@ -0,0 +1,152 @@
+package bitcask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/internal/bloom"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const n = 100
+
+	testDir, err := os.MkdirTemp("", "bitcask")
+	require.NoError(t, err)
+	defer os.RemoveAll(testDir)
+
+	opts := []Option{WithBloomFilter(0.01), WithMaxDatafileSize(1 << 10)}
+
+	check := func(t *testing.T, db DB) {
+		for i := 0; i < n; i++ {
+			key := Key(fmt.Sprintf("foo%d", i))
+			assert.True(t, db.Has(key))
+			val, err := db.Get(key)
+			require.NoError(t, err)
+			assert.Equal(t, Value(fmt.Sprintf("bar%d", i)), val)
+		}
+
+		for i := 0; i < n; i++ {
+			key := Key(fmt.Sprintf("missing%d", i))
+			assert.False(t, db.Has(key))
+			_, err := db.Get(key)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+		}
+
+		stats, err := db.Stats()
+		require.NoError(t, err)
+		assert.Greater(t, stats.BloomFalsePositiveRate, 0.0)
+		assert.Less(t, stats.BloomFalsePositiveRate, 0.05)
+	}
+
+	glob := func(pattern string) []string {
+		fns, err := filepath.Glob(filepath.Join(testDir, pattern))
+		require.NoError(t, err)
+		return fns
+	}
+
+	// Filters are written for immutable datafiles only
+	immutable := func() int { return len(glob("*.data")) - 1 }
+
+	db, err := Open(testDir, opts...)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value(fmt.Sprintf("bar%d", i))))
+	}
+
+	assert.Greater(t, immutable(), 1)
+	assert.Len(t, glob("*"+bloomExt), immutable())
+	check(t, db)
+
+	t.Run("Reopen", func(t *testing.T) {
+		require.NoError(t, db.Close())
+
+		// Missing and corrupted filters are rebuilt
+		fns := glob("*" + bloomExt)
+		require.NoError(t, os.Remove(fns[0]))
+		require.NoError(t, os.WriteFile(fns[1], []byte("corrupted"), 0600))
+
+		db, err = Open(testDir, opts...)
+		require.NoError(t, err)
+		assert.Len(t, glob("*"+bloomExt), immutable())
+		check(t, db)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		require.NoError(t, db.Delete(Key("foo0")))
+		require.NoError(t, db.Put(Key("foo0"), Value("bar0")))
+		require.NoError(t, db.Merge())
+		check(t, db)
+		assert.Len(t, glob("*"+bloomExt), immutable())
+	})
+
+	t.Run("Readonly", func(t *testing.T) {
+		rdb, err := Open(testDir, append(opts, WithAutoReadonly(true))...)
+		require.NoError(t, err)
+		defer rdb.Close()
+
+		assert.True(t, rdb.Readonly())
+		check(t, rdb)
+	})
+	require.NoError(t, db.Close())
+
+	t.Run("Stale", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		db, err := Open(testDir, opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.Put(Key("a"), Value("a")))
+		require.NoError(t, db.Close())
+
+		// The datafile with the filter of "a" is written to without filters
+		db, err = Open(testDir, WithMaxDatafileSize(1<<10))
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			require.NoError(t, db.Put(Key(fmt.Sprintf("k%d", i)), Value("v")))
+		}
+		require.NoError(t, db.Close())
+
+		db, err = Open(testDir, opts...)
+		require.NoError(t, err)
+		defer db.Close()
+
+		for i := 0; i < n; i++ {
+			key := Key(fmt.Sprintf("k%d", i))
+			assert.True(t, db.Has(key))
+			val, err := db.Get(key)
+			require.NoError(t, err)
+			assert.Equal(t, Value("v"), val)
+		}
+
+		bdb := db.(*bitcask)
+		size, f, err := bdb.readFilter(0)
+		require.NoError(t, err)
+		assert.Equal(t, bdb.datafiles[0].Size(), size)
+		assert.True(t, f.Has(bloom.Hash(Key("k0"))))
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		db, err := Open(t.TempDir(), opts...)
+		require.NoError(t, err)
+		defer db.Close()
+
+		for i := 0; i < n; i++ {
+			require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i)), Value(fmt.Sprintf("bar%d", i))))
+		}
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		require.NoError(t, err)
+		assert.Greater(t, report.Datafiles, 1)
+		assert.True(t, report.OK(), "%v", report.Problems)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := Open(t.TempDir(), WithBloomFilter(0))
+		assert.ErrorIs(t, err, ErrInvalidFalsePositiveRate)
+	})
+}
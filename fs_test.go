@@ -0,0 +1,148 @@
+package bitcask
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+func TestMemFS(t *testing.T) {
+	fs := vfs.NewMemFS()
+
+	db, err := Open("/db", WithFS(fs), WithMaxDatafileSize(64))
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i%5)), Value(fmt.Sprintf("bar%d", i))))
+	}
+	require.NoError(t, db.Delete(Key("foo0")))
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := db.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.Keys)
+		assert.True(t, stats.Datafiles > 1)
+		assert.True(t, stats.Size > 0)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		require.NoError(t, db.Merge())
+
+		val, err := db.Get(Key("foo4"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("bar19"), val)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		require.NoError(t, err)
+		assert.True(t, report.OK(), report.Problems)
+	})
+
+	t.Run("Backup", func(t *testing.T) {
+		require.NoError(t, db.Backup("/backup"))
+		assert.True(t, vfs.Exists(fs, "/backup/config.json"))
+	})
+
+	t.Run("Locking", func(t *testing.T) {
+		_, err := Open("/db", WithFS(fs))
+		assert.ErrorIs(t, err, ErrDatabaseLocked)
+	})
+
+	require.NoError(t, db.Close())
+
+	t.Run("Reopen", func(t *testing.T) {
+		for _, path := range []string{"/db", "/backup"} {
+			db, err := Open(path, WithFS(fs))
+			require.NoError(t, err)
+
+			val, err := db.Get(Key("foo1"))
+			require.NoError(t, err)
+			assert.Equal(t, Value("bar16"), val)
+			assert.False(t, db.Has(Key("foo0")))
+
+			require.NoError(t, db.Close())
+		}
+	})
+}
+
+// TestCrashConsistency crashes a workload at every operation changing the
+// filesystem in turn and asserts that the database opens afterwards with
+// every acknowledged write intact
+func TestCrashConsistency(t *testing.T) {
+	const keys = 5
+
+	for n := 1; ; n++ {
+		mem := vfs.NewMemFS()
+		ffs := vfs.NewFaultFS(mem, vfs.CrashAt(n))
+
+		// expected holds the values a key may have after the crash, nil
+		// for a deleted (or never written) key. Only the write in flight
+		// when crashing may or may not have happened.
+		expected := make(map[string][]Value)
+		for i := 0; i < keys; i++ {
+			expected[fmt.Sprintf("foo%d", i)] = []Value{nil}
+		}
+
+		func() {
+			db, err := Open("/db", WithFS(ffs), WithSyncWrites(true), WithMaxDatafileSize(128))
+			if err != nil {
+				return
+			}
+
+			for i := 0; i < 40; i++ {
+				key := fmt.Sprintf("foo%d", i%keys)
+				old := expected[key][len(expected[key])-1]
+
+				var val Value
+				if i%7 == 6 {
+					err = db.Delete(Key(key))
+				} else {
+					val = Value(fmt.Sprintf("bar%d", i))
+					err = db.Put(Key(key), val)
+				}
+				if err != nil {
+					expected[key] = []Value{old, val}
+					return
+				}
+				expected[key] = []Value{val}
+
+				if i%10 == 9 {
+					if err := db.Sync(); err != nil {
+						return
+					}
+				}
+			}
+
+			db.Close()
+		}()
+
+		db, err := Open("/db", WithFS(mem))
+		require.NoError(t, err, "crash at operation %d", n)
+
+		for key, vals := range expected {
+			val, err := db.Get(Key(key))
+			if err != nil {
+				require.ErrorIs(t, err, ErrKeyNotFound, "crash at operation %d", n)
+				val = nil
+			}
+			assert.Contains(t, vals, val, "crash at operation %d: key %s", n, key)
+		}
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		require.NoError(t, err)
+		assert.True(t, report.OK(), "crash at operation %d: %v", n, report.Problems)
+
+		require.NoError(t, db.Put(Key("foo"), Value("bar")), "crash at operation %d", n)
+		require.NoError(t, db.Close(), "crash at operation %d", n)
+
+		if !ffs.Crashed() {
+			break
+		}
+	}
+}
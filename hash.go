@@ -16,7 +16,7 @@ func (b *bitcask) Hash(key Key) *Hash {
 //	h[key]age = "21"
 //	h[key]sex = "Male"
 type Hash struct {
-	db  DB
+	db  store
 	key Key
 }
 
@@ -81,10 +81,20 @@ func (h *Hash) Remove(fields ...[]byte) error {
 		}
 	}
 	// clean up
-	prefix := h.fieldPrefix()
-	return h.db.Scan(prefix, func(key Key) error {
-		return h.db.Delete(key)
+	if h.Len() == 0 {
+		return h.db.Delete(h.rawKey())
+	}
+	return nil
+}
+
+// Len returns the number of fields in the hash
+func (h *Hash) Len() int {
+	n := 0
+	h.db.Scan(h.fieldPrefix(), func(key Key) error {
+		n++
+		return nil
 	})
+	return n
 }
 
 // Drop ...
@@ -50,4 +50,18 @@ func TestHash(t *testing.T) {
 		assert.NoError(err)
 		assert.Equal([]byte("three"), val)
 	})
+
+	t.Run("Remove", func(t *testing.T) {
+		err := h.Remove([]byte("2"))
+		assert.NoError(err)
+
+		_, err = h.Get([]byte("2"))
+		assert.Equal(ErrKeyNotFound, err)
+
+		assert.Equal(2, h.Len())
+
+		all, err := h.GetAll()
+		assert.NoError(err)
+		assert.Equal(map[string][]byte{"1": []byte("one"), "3": []byte("three")}, all)
+	})
 }
@@ -0,0 +1,128 @@
+// Package bloom implements Bloom filters of the keys of datafiles, telling
+// whether a key is definitely not in a datafile without reading it.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// headerSize is the size of the number of hash functions and of bits
+const headerSize = 4 + 8
+
+// ErrInvalidFilter is returned when reading a corrupted filter
+var ErrInvalidFilter = errors.New("error: invalid bloom filter")
+
+// Hash returns the hash of key used by filters, it is stable across
+// processes so filters can be stored
+func Hash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// Filter is a Bloom filter of key hashes
+type Filter struct {
+	k    uint32
+	bits []uint64
+}
+
+// New returns a filter for n keys with the given false positive rate
+func New(n int, fpRate float64) *Filter {
+	n = max(n, 1)
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+
+	return &Filter{
+		k:    uint32(max(k, 1)),
+		bits: make([]uint64, (uint64(m)+63)/64),
+	}
+}
+
+// locations calls fn with the bit of each hash function for h, the hashes
+// are derived from the two halves of h
+func (f *Filter) locations(h uint64, fn func(bit uint64) bool) bool {
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := h&math.MaxUint32, h>>32
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds the key hash h
+func (f *Filter) Add(h uint64) {
+	f.locations(h, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// Has returns false if the key hash h was definitely not added
+func (f *Filter) Has(h uint64) bool {
+	return f.locations(h, func(bit uint64) bool {
+		return f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
+
+// FalsePositiveRate returns the false positive rate of the filter estimated
+// from the fraction of its bits set
+func (f *Filter) FalsePositiveRate() float64 {
+	ones := 0
+	for _, word := range f.bits {
+		ones += bits.OnesCount64(word)
+	}
+	return math.Pow(float64(ones)/float64(len(f.bits)*64), float64(f.k))
+}
+
+// Size returns the number of bytes used by the filter
+func (f *Filter) Size() int64 {
+	return int64(len(f.bits)) * 8
+}
+
+// WriteTo writes the filter followed by its checksum to w
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	b := make([]byte, headerSize+len(f.bits)*8+4)
+	binary.BigEndian.PutUint32(b, f.k)
+	binary.BigEndian.PutUint64(b[4:], uint64(len(f.bits)))
+	for i, word := range f.bits {
+		binary.BigEndian.PutUint64(b[headerSize+i*8:], word)
+	}
+	binary.BigEndian.PutUint32(b[len(b)-4:], crc32.ChecksumIEEE(b[:len(b)-4]))
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// Read reads a filter written by WriteTo from r
+func Read(r io.Reader) (*Filter, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < headerSize+4 {
+		return nil, ErrInvalidFilter
+	}
+
+	k := binary.BigEndian.Uint32(b)
+	words := binary.BigEndian.Uint64(b[4:])
+	if k == 0 || words == 0 || uint64(len(b)) != headerSize+words*8+4 {
+		return nil, ErrInvalidFilter
+	}
+	if crc32.ChecksumIEEE(b[:len(b)-4]) != binary.BigEndian.Uint32(b[len(b)-4:]) {
+		return nil, ErrInvalidFilter
+	}
+
+	f := &Filter{k: k, bits: make([]uint64, words)}
+	for i := range f.bits {
+		f.bits[i] = binary.BigEndian.Uint64(b[headerSize+i*8:])
+	}
+	return f, nil
+}
@@ -0,0 +1,58 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(Hash([]byte(fmt.Sprintf("key%d", i))))
+	}
+
+	// Keys added are always found
+	for i := 0; i < n; i++ {
+		assert.True(t, f.Has(Hash([]byte(fmt.Sprintf("key%d", i)))))
+	}
+
+	t.Run("FalsePositiveRate", func(t *testing.T) {
+		positives := 0
+		for i := 0; i < n; i++ {
+			if f.Has(Hash([]byte(fmt.Sprintf("missing%d", i)))) {
+				positives++
+			}
+		}
+		assert.Less(t, float64(positives)/n, 0.02)
+		assert.InDelta(t, 0.01, f.FalsePositiveRate(), 0.005)
+	})
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := f.WriteTo(&buf)
+		require.NoError(t, err)
+
+		g, err := Read(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, f, g)
+
+		b := buf.Bytes()
+		b[len(b)/2] ^= 0xff
+		_, err = Read(bytes.NewReader(b))
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+
+		_, err = Read(bytes.NewReader(b[:8]))
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		f := New(0, 0.01)
+		assert.False(t, f.Has(Hash([]byte("foo"))))
+	})
+}
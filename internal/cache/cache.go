@@ -0,0 +1,164 @@
+// Package cache implements a least recently used cache of values bounded by
+// the number of bytes they use.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// entryOverhead approximates the bytes used by an entry besides its value
+const entryOverhead = 64
+
+// Key is the location of a value in the datafiles, a location is never
+// reused for another value until datafiles are merged and the epoch changes
+type Key struct {
+	Epoch  uint64
+	FileID int
+	Offset int64
+}
+
+type entry struct {
+	key   Key
+	value []byte
+}
+
+// Cache is a least recently used cache of values. A nil Cache caches
+// nothing.
+type Cache struct {
+	mu      sync.Mutex
+	budget  int64
+	size    int64
+	lru     *list.List
+	entries map[Key]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// New returns a cache of values using at most budget bytes
+func New(budget int64) *Cache {
+	return &Cache{
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[Key]*list.Element),
+	}
+}
+
+func cost(value []byte) int64 {
+	return int64(len(value)) + entryOverhead
+}
+
+// Get returns a copy of the value at key
+func (c *Cache) Get(key Key) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+
+	value := elem.Value.(*entry).value
+	return append(make([]byte, 0, len(value)), value...), true
+}
+
+// Add adds a copy of the value at key evicting the least recently used
+// values over the budget, values larger than the budget aren't cached
+func (c *Cache) Add(key Key, value []byte) {
+	if c == nil || cost(value) > c.budget {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	e := &entry{key: key, value: append(make([]byte, 0, len(value)), value...)}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += cost(value)
+
+	for c.size > c.budget {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Remove removes the value at key
+func (c *Cache) Remove(key Key) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.entries, e.key)
+	c.size -= cost(e.value)
+}
+
+// Purge removes all values, the hit and miss counters are kept
+func (c *Cache) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[Key]*list.Element)
+	c.size = 0
+}
+
+// Len returns the number of cached values
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Size returns the number of bytes used by the cached values
+func (c *Cache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+// Stats returns the number of hits and misses
+func (c *Cache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits, c.misses
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New(3 * (entryOverhead + 3))
+
+	c.Add(Key{FileID: 0, Offset: 0}, []byte("foo"))
+	c.Add(Key{FileID: 0, Offset: 10}, []byte("bar"))
+	c.Add(Key{FileID: 1, Offset: 0}, []byte("baz"))
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, int64(3*(entryOverhead+3)), c.Size())
+
+	value, ok := c.Get(Key{FileID: 0, Offset: 0})
+	assert.True(t, ok)
+	assert.Equal(t, []byte("foo"), value)
+
+	// Returned values are copies
+	value[0] = 'x'
+	value, _ = c.Get(Key{FileID: 0, Offset: 0})
+	assert.Equal(t, []byte("foo"), value)
+
+	t.Run("Evict", func(t *testing.T) {
+		c.Add(Key{FileID: 2, Offset: 0}, []byte("qux"))
+		assert.Equal(t, 3, c.Len())
+
+		// The least recently used value is evicted
+		_, ok := c.Get(Key{FileID: 0, Offset: 10})
+		assert.False(t, ok)
+		_, ok = c.Get(Key{FileID: 0, Offset: 0})
+		assert.True(t, ok)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		c.Add(Key{FileID: 3, Offset: 0}, make([]byte, 4*entryOverhead))
+		_, ok := c.Get(Key{FileID: 3, Offset: 0})
+		assert.False(t, ok)
+		assert.Equal(t, 3, c.Len())
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		c.Remove(Key{FileID: 0, Offset: 0})
+		_, ok := c.Get(Key{FileID: 0, Offset: 0})
+		assert.False(t, ok)
+		assert.Equal(t, 2, c.Len())
+		assert.Equal(t, int64(2*(entryOverhead+3)), c.Size())
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		c.Purge()
+		assert.Equal(t, 0, c.Len())
+		assert.Equal(t, int64(0), c.Size())
+
+		hits, misses := c.Stats()
+		assert.Equal(t, uint64(3), hits)
+		assert.Equal(t, uint64(3), misses)
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var c *Cache
+		c.Add(Key{FileID: 0, Offset: 0}, []byte("foo"))
+		_, ok := c.Get(Key{FileID: 0, Offset: 0})
+		assert.False(t, ok)
+		c.Remove(Key{FileID: 0, Offset: 0})
+		c.Purge()
+		assert.Equal(t, 0, c.Len())
+	})
+}
@@ -3,7 +3,9 @@ package codec
 
 import (
 	"encoding/binary"
+	"hash/crc32"
 	"io"
+	"math"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,12 +17,15 @@ var (
 	errInvalidKeyOrValueSize = errors.New("key/value size is invalid")
 	errCantDecodeOnNilEntry  = errors.New("can't decode on nil entry")
 	errTruncatedData         = errors.New("data is truncated")
+	errPrefixChecksumFailed  = errors.New("key/value size checksum failed")
 )
 
-// NewDecoder creates a streaming Entry decoder.
-func NewDecoder(r io.Reader, maxKeySize uint32, maxValueSize uint64) *Decoder {
+// NewDecoder creates a streaming Entry decoder reading entries in the given
+// format version.
+func NewDecoder(r io.Reader, version int, maxKeySize uint32, maxValueSize uint64) *Decoder {
 	return &Decoder{
 		r:            r,
+		version:      version,
 		maxKeySize:   maxKeySize,
 		maxValueSize: maxValueSize,
 	}
@@ -29,6 +34,7 @@ func NewDecoder(r io.Reader, maxKeySize uint32, maxValueSize uint64) *Decoder {
 // Decoder wraps an underlying io.Reader and allows you to stream entries
 type Decoder struct {
 	r            io.Reader
+	version      int
 	maxKeySize   uint32
 	maxValueSize uint64
 }
@@ -39,14 +45,15 @@ func (d *Decoder) Decode(v *internal.Entry) (int64, error) {
 		return 0, errCantDecodeOnNilEntry
 	}
 
-	prefixBuf := make([]byte, keySize+valueSize)
+	prefixBuf := make([]byte, PrefixSize(d.version))
 
 	_, err := io.ReadFull(d.r, prefixBuf)
 	if err != nil {
 		return 0, err
 	}
 
-	actualKeySize, actualValueSize, err := getKeyValueSizes(prefixBuf, d.maxKeySize, d.maxValueSize)
+	// The sizes are verified before allocating the key and value
+	actualKeySize, actualValueSize, err := getKeyValueSizes(d.version, prefixBuf, d.maxKeySize, d.maxValueSize)
 	if err != nil {
 		return 0, err
 	}
@@ -57,22 +64,86 @@ func (d *Decoder) Decode(v *internal.Entry) (int64, error) {
 	}
 
 	decodeWithoutPrefix(buf, actualKeySize, v)
-	return int64(keySize + valueSize + uint64(actualKeySize) + actualValueSize + checksumSize), nil
+	return int64(uint64(len(prefixBuf)) + uint64(actualKeySize) + actualValueSize + checksumSize), nil
 }
 
-// DecodeEntry decodes a serialized entry
-func DecodeEntry(b []byte, e *internal.Entry, maxKeySize uint32, maxValueSize uint64) error {
-	valueOffset, _, err := getKeyValueSizes(b, maxKeySize, maxValueSize)
+// DecodeKey decodes the key of the next Entry from the current stream and
+// skips its value, seeking past it if the stream is an io.Seeker. The size
+// of the value is returned, zero for tombstones.
+func (d *Decoder) DecodeKey() ([]byte, uint64, int64, error) {
+	prefixBuf := make([]byte, PrefixSize(d.version))
+
+	_, err := io.ReadFull(d.r, prefixBuf)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	actualKeySize, actualValueSize, err := getKeyValueSizes(d.version, prefixBuf, d.maxKeySize, d.maxValueSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if actualValueSize > math.MaxInt64-MetaInfoSize-uint64(actualKeySize) {
+		return nil, 0, 0, errInvalidKeyOrValueSize
+	}
+
+	key := make([]byte, actualKeySize)
+	if _, err = io.ReadFull(d.r, key); err != nil {
+		return nil, 0, 0, errTruncatedData
+	}
+	if err = skip(d.r, int64(actualValueSize)+checksumSize); err != nil {
+		return nil, 0, 0, errTruncatedData
+	}
+
+	return key, actualValueSize, int64(uint64(len(prefixBuf)) + uint64(actualKeySize) + actualValueSize + checksumSize), nil
+}
+
+// skip skips n bytes of r, seeking past all but the last one which is read
+// so a truncated stream is detected
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok && n > 1 {
+		if _, err := s.Seek(n-1, io.SeekCurrent); err != nil {
+			return err
+		}
+		n = 1
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// DecodeEntry decodes a serialized entry in the given format version
+func DecodeEntry(version int, b []byte, e *internal.Entry, maxKeySize uint32, maxValueSize uint64) error {
+	if len(b) < PrefixSize(version) {
+		return errTruncatedData
+	}
+	valueOffset, _, err := getKeyValueSizes(version, b, maxKeySize, maxValueSize)
 	if err != nil {
 		return errors.Wrap(err, "key/value sizes are invalid")
 	}
 
-	decodeWithoutPrefix(b[keySize+valueSize:], valueOffset, e)
+	decodeWithoutPrefix(b[PrefixSize(version):], valueOffset, e)
 
 	return nil
 }
 
-func getKeyValueSizes(buf []byte, maxKeySize uint32, maxValueSize uint64) (uint32, uint64, error) {
+// EntrySize returns the size of the encoded entry in the given format version
+// starting with the given prefix (of at least PrefixSize bytes) or an error
+// if the sizes are invalid
+func EntrySize(version int, prefix []byte, maxKeySize uint32, maxValueSize uint64) (int64, error) {
+	actualKeySize, actualValueSize, err := getKeyValueSizes(version, prefix, maxKeySize, maxValueSize)
+	if err != nil {
+		return 0, err
+	}
+	if actualValueSize > math.MaxInt64-MetaInfoSize-uint64(actualKeySize) {
+		return 0, errInvalidKeyOrValueSize
+	}
+	return int64(uint64(PrefixSize(version)) + uint64(actualKeySize) + actualValueSize + checksumSize), nil
+}
+
+func getKeyValueSizes(version int, buf []byte, maxKeySize uint32, maxValueSize uint64) (uint32, uint64, error) {
+	if version >= Version2 && crc32.Checksum(buf[:keySize+valueSize], castagnoli) != binary.BigEndian.Uint32(buf[keySize+valueSize:]) {
+		return 0, 0, errPrefixChecksumFailed
+	}
+
 	actualKeySize := binary.BigEndian.Uint32(buf[:keySize])
 	actualValueSize := binary.BigEndian.Uint64(buf[keySize:])
 
@@ -102,7 +173,7 @@ func getKeyExpiry(buf []byte) *time.Time {
 // IsCorruptedData indicates if the error corresponds to possible data corruption
 func IsCorruptedData(err error) bool {
 	switch err {
-	case errCantDecodeOnNilEntry, errInvalidKeyOrValueSize, errTruncatedData:
+	case errCantDecodeOnNilEntry, errInvalidKeyOrValueSize, errTruncatedData, errPrefixChecksumFailed, ErrChecksumFailed:
 		return true
 	default:
 		return false
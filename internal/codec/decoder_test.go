@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,7 +18,7 @@ func BenchmarkDecoder(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		decoder := NewDecoder(bytes.NewBuffer(data), 16, 32)
+		decoder := NewDecoder(bytes.NewBuffer(data), Version1, 16, 32)
 		b.StartTimer()
 
 		_, err := decoder.Decode(&internal.Entry{})
@@ -29,7 +30,7 @@ func BenchmarkDecoder(b *testing.B) {
 
 func TestDecoder(t *testing.T) {
 	buf := bytes.NewBuffer([]byte{0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x7, 0x6d, 0x79, 0x6b, 0x65, 0x79, 0x6d, 0x79, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x0, 0x6, 0x51, 0xbd})
-	decoder := NewDecoder(buf, 16, 32)
+	decoder := NewDecoder(buf, Version1, 16, 32)
 
 	expected := internal.Entry{
 		Key:      []byte("mykey"),
@@ -42,9 +43,37 @@ func TestDecoder(t *testing.T) {
 	assert.EqualValues(t, expected, actual)
 }
 
+func TestDecodeKey(t *testing.T) {
+	data := []byte{0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x7, 0x6d, 0x79, 0x6b, 0x65, 0x79, 0x6d, 0x79, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x0, 0x6, 0x51, 0xbd}
+
+	for name, r := range map[string]io.Reader{
+		"Reader": bytes.NewBuffer(data),
+		"Seeker": bytes.NewReader(data),
+	} {
+		t.Run(name, func(t *testing.T) {
+			decoder := NewDecoder(r, Version1, 16, 32)
+
+			key, size, n, err := decoder.DecodeKey()
+			require.NoError(t, err)
+			assert.Equal(t, []byte("mykey"), key)
+			assert.Equal(t, uint64(7), size)
+			assert.Equal(t, int64(len(data)), n)
+
+			_, _, _, err = decoder.DecodeKey()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		decoder := NewDecoder(bytes.NewReader(data[:len(data)-1]), Version1, 16, 32)
+		_, _, _, err := decoder.DecodeKey()
+		assert.Equal(t, errTruncatedData, err)
+	})
+}
+
 func TestDecodeOnNilEntry(t *testing.T) {
 	var buf bytes.Buffer
-	decoder := NewDecoder(&buf, 1, 1)
+	decoder := NewDecoder(&buf, Version1, 1, 1)
 
 	_, err := decoder.Decode(nil)
 	if assert.Error(t, err) {
@@ -60,7 +89,7 @@ func TestShortPrefix(t *testing.T) {
 
 	truncBytesCount := 2
 	buf := bytes.NewBuffer(prefix[:keySize+valueSize-truncBytesCount])
-	decoder := NewDecoder(buf, maxKeySize, maxValueSize)
+	decoder := NewDecoder(buf, Version1, maxKeySize, maxValueSize)
 	_, err := decoder.Decode(&internal.Entry{})
 	if assert.Error(t, err) {
 		assert.Equal(t, io.ErrUnexpectedEOF, err)
@@ -90,7 +119,7 @@ func TestInvalidValueKeySizes(t *testing.T) {
 			binary.BigEndian.PutUint64(prefix[keySize:], tests[i].valueSize)
 
 			buf := bytes.NewBuffer(prefix)
-			decoder := NewDecoder(buf, maxKeySize, maxValueSize)
+			decoder := NewDecoder(buf, Version1, maxKeySize, maxValueSize)
 			_, err := decoder.Decode(&internal.Entry{})
 			if assert.Error(t, err) {
 				assert.Equal(t, errInvalidKeyOrValueSize, err)
@@ -126,7 +155,7 @@ func TestTruncatedData(t *testing.T) {
 		t.Run(tests[i].name, func(t *testing.T) {
 			t.Parallel()
 			buf := bytes.NewBuffer(tests[i].data)
-			decoder := NewDecoder(buf, maxKeySize, maxValueSize)
+			decoder := NewDecoder(buf, Version1, maxKeySize, maxValueSize)
 			_, err := decoder.Decode(&internal.Entry{})
 			if assert.Error(t, err) {
 				assert.Equal(t, errTruncatedData, err)
@@ -149,3 +178,54 @@ func TestDecodeWithoutPrefix(t *testing.T) {
 	assert.Equal(t, expected.Value, actual.Value)
 	assert.Equal(t, expected.Checksum, actual.Checksum)
 }
+
+func TestEntrySize(t *testing.T) {
+	prefix := make([]byte, PrefixSize(Version1))
+	binary.BigEndian.PutUint32(prefix, 5)
+	binary.BigEndian.PutUint64(prefix[keySize:], 7)
+
+	n, err := EntrySize(Version1, prefix, 16, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(keySize+valueSize+checksumSize+5+7), n)
+
+	_, err = EntrySize(Version1, prefix, 4, 32)
+	assert.Equal(t, errInvalidKeyOrValueSize, err)
+
+	binary.BigEndian.PutUint64(prefix[keySize:], ^uint64(0))
+	_, err = EntrySize(Version1, prefix, 16, 0)
+	assert.Equal(t, errInvalidKeyOrValueSize, err)
+}
+
+func TestCorruptedPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewEncoder(&buf, Version2).Encode(internal.Entry{Key: []byte("mykey"), Value: []byte("myvalue")})
+	require.NoError(t, err)
+
+	data := buf.Bytes()
+	decoder := NewDecoder(bytes.NewReader(data), Version2, 0, 0)
+	var e internal.Entry
+	n, err := decoder.Decode(&e)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, int64(MetaInfoSize+5+7), n)
+	assert.Equal(t, []byte("myvalue"), e.Value)
+
+	// A value size of 1GiB is rejected before it is allocated
+	binary.BigEndian.PutUint64(data[keySize:], 1<<30)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	decoder = NewDecoder(bytes.NewReader(data), Version2, 0, 0)
+	_, err = decoder.Decode(&e)
+	runtime.ReadMemStats(&after)
+	assert.Equal(t, errPrefixChecksumFailed, err)
+	assert.True(t, IsCorruptedData(err))
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	decoder = NewDecoder(bytes.NewReader(data), Version2, 0, 0)
+	_, _, _, err = decoder.DecodeKey()
+	assert.Equal(t, errPrefixChecksumFailed, err)
+
+	_, err = EntrySize(Version2, data, 0, 0)
+	assert.Equal(t, errPrefixChecksumFailed, err)
+}
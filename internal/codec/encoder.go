@@ -3,6 +3,7 @@ package codec
 import (
 	"bufio"
 	"encoding/binary"
+	"hash/crc32"
 	"io"
 	"sync"
 
@@ -16,8 +17,9 @@ const (
 	valueSize    = 8
 	checksumSize = 4
 
-	// MetaInfoSize is the total size of the whole encoded entry (key + value + checksum)
-	MetaInfoSize = keySize + valueSize + checksumSize
+	// MetaInfoSize is the size of an entry encoded in the current format
+	// without its key and value (sizes + their checksum + checksum)
+	MetaInfoSize = keySize + valueSize + checksumSize + checksumSize
 )
 
 var bufPool = sync.Pool{
@@ -25,19 +27,21 @@ var bufPool = sync.Pool{
 		// The Pool's New function should generally only return pointer
 		// types, since a pointer can be put into the return interface
 		// value without an allocation:
-		return make([]byte, keySize+valueSize)
+		return make([]byte, keySize+valueSize+checksumSize)
 	},
 }
 
-// NewEncoder creates a streaming Entry encoder.
-func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: bufio.NewWriter(w)}
+// NewEncoder creates a streaming Entry encoder writing entries in the given
+// format version.
+func NewEncoder(w io.Writer, version int) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w), version: version}
 }
 
 // Encoder wraps an underlying io.Writer and allows you to stream
 // Entry encodings on it.
 type Encoder struct {
-	w *bufio.Writer
+	w       *bufio.Writer
+	version int
 }
 
 // Encode takes any Entry and streams it to the underlying writer.
@@ -45,9 +49,12 @@ type Encoder struct {
 func (e *Encoder) Encode(msg internal.Entry) (int64, error) {
 	//var bufKeyValue = make([]byte, keySize+valueSize)
 
-	bufKeyValue := bufPool.Get().([]byte)
+	bufKeyValue := bufPool.Get().([]byte)[:PrefixSize(e.version)]
 	binary.BigEndian.PutUint32(bufKeyValue[:keySize], uint32(len(msg.Key)))
 	binary.BigEndian.PutUint64(bufKeyValue[keySize:keySize+valueSize], uint64(len(msg.Value)))
+	if e.version >= Version2 {
+		binary.BigEndian.PutUint32(bufKeyValue[keySize+valueSize:], crc32.Checksum(bufKeyValue[:keySize+valueSize], castagnoli))
+	}
 
 	if _, err := e.w.Write(bufKeyValue); err != nil {
 		return 0, errors.Wrap(err, "failed writing key & value length prefix")
@@ -70,5 +77,5 @@ func (e *Encoder) Encode(msg internal.Entry) (int64, error) {
 		return 0, errors.Wrap(err, "failed flushing data")
 	}
 
-	return int64(keySize + valueSize + len(msg.Key) + len(msg.Value) + checksumSize), nil
+	return int64(len(bufKeyValue) + len(msg.Key) + len(msg.Value) + checksumSize), nil
 }
@@ -11,7 +11,7 @@ import (
 
 func BenchmarkEncoder(b *testing.B) {
 	var buf bytes.Buffer
-	encoder := NewEncoder(&buf)
+	encoder := NewEncoder(&buf, Version1)
 
 	entry := internal.Entry{
 		Key:      []byte("mykey"),
@@ -30,7 +30,7 @@ func BenchmarkEncoder(b *testing.B) {
 
 func TestEncode(t *testing.T) {
 	var buf bytes.Buffer
-	encoder := NewEncoder(&buf)
+	encoder := NewEncoder(&buf, Version1)
 
 	entry := internal.Entry{
 		Key:      []byte("mykey"),
@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"go.mills.io/bitcask/v2/internal"
+)
+
+const (
+	// VersionLegacy is the format of datafiles written before datafiles had
+	// a header, the checksum of an entry only covers its value
+	VersionLegacy = 0
+
+	// Version1 is the format of datafiles starting with a header, the
+	// checksum of an entry is a CRC32C of its size prefix, key and value
+	Version1 = 1
+
+	// Version2 is the format of datafiles whose entries have a CRC32C of
+	// their size prefix after it so corrupted sizes are detected before the
+	// key and value are read
+	Version2 = 2
+
+	// CurrentVersion is the format new datafiles are written in
+	CurrentVersion = Version2
+
+	// HeaderSize is the size of the header of a datafile
+	HeaderSize = 8
+)
+
+var (
+	// ErrChecksumFailed is the error returned when an entry does not match
+	// its checksum
+	ErrChecksumFailed = errors.New("checksum failed")
+
+	// ErrUnsupportedVersion is the error returned when a datafile was
+	// written in a format newer than CurrentVersion
+	ErrUnsupportedVersion = errors.New("unsupported datafile version")
+
+	// magic identifies a datafile with a header
+	magic = []byte("BCDF")
+
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// WriteHeader writes the header of a datafile in the given format version
+func WriteHeader(w io.Writer, version int) error {
+	header := make([]byte, HeaderSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], uint32(version))
+
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, "failed writing datafile header")
+	}
+	return nil
+}
+
+// ReadHeader reads the header of a datafile of the given size and returns
+// its format version, datafiles without a header are VersionLegacy.
+func ReadHeader(r io.ReaderAt, size int64) (int, error) {
+	if size < HeaderSize {
+		return VersionLegacy, nil
+	}
+
+	header := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return 0, errors.Wrap(err, "failed reading datafile header")
+	}
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return VersionLegacy, nil
+	}
+
+	version := int(binary.BigEndian.Uint32(header[len(magic):]))
+	if version > CurrentVersion {
+		return version, ErrUnsupportedVersion
+	}
+	return version, nil
+}
+
+// DataOffset returns the offset of the first entry of a datafile in the
+// given format version
+func DataOffset(version int) int64 {
+	if version == VersionLegacy {
+		return 0
+	}
+	return HeaderSize
+}
+
+// PrefixSize returns the size of the prefix of an entry, its key and value
+// sizes and their checksum, in the given format version
+func PrefixSize(version int) int {
+	if version < Version2 {
+		return keySize + valueSize
+	}
+	return keySize + valueSize + checksumSize
+}
+
+// Checksum returns the checksum of an entry with the given key and value in
+// the given format version
+func Checksum(version int, key, value []byte) uint32 {
+	if version == VersionLegacy {
+		return crc32.ChecksumIEEE(value)
+	}
+
+	prefix := make([]byte, keySize+valueSize)
+	binary.BigEndian.PutUint32(prefix[:keySize], uint32(len(key)))
+	binary.BigEndian.PutUint64(prefix[keySize:], uint64(len(value)))
+
+	checksum := crc32.Update(0, castagnoli, prefix)
+	checksum = crc32.Update(checksum, castagnoli, key)
+	return crc32.Update(checksum, castagnoli, value)
+}
+
+// VerifyChecksum returns ErrChecksumFailed if the entry does not match its
+// checksum in the given format version
+func VerifyChecksum(version int, e internal.Entry) error {
+	if Checksum(version, e.Key, e.Value) != e.Checksum {
+		return ErrChecksumFailed
+	}
+	return nil
+}
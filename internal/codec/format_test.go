@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/internal"
+)
+
+func TestHeader(t *testing.T) {
+	t.Run("Current", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteHeader(&buf, CurrentVersion))
+		assert.Equal(t, HeaderSize, buf.Len())
+
+		version, err := ReadHeader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Equal(t, CurrentVersion, version)
+		assert.Equal(t, int64(HeaderSize), DataOffset(version))
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := NewEncoder(&buf, VersionLegacy).Encode(internal.Entry{Key: []byte("mykey"), Value: []byte("myvalue")})
+		require.NoError(t, err)
+
+		version, err := ReadHeader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Equal(t, VersionLegacy, version)
+		assert.Equal(t, int64(0), DataOffset(version))
+
+		version, err = ReadHeader(bytes.NewReader(nil), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, VersionLegacy, version)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteHeader(&buf, CurrentVersion+1))
+
+		_, err := ReadHeader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+}
+
+func TestChecksum(t *testing.T) {
+	key, value := []byte("mykey"), []byte("myvalue")
+
+	assert.Equal(t, crc32.ChecksumIEEE(value), Checksum(VersionLegacy, key, value))
+	assert.Equal(t, Checksum(VersionLegacy, key, value), Checksum(VersionLegacy, []byte("other"), value))
+
+	checksum := Checksum(Version1, key, value)
+	assert.NotEqual(t, checksum, Checksum(Version1, []byte("mykez"), value))
+	assert.NotEqual(t, checksum, Checksum(Version1, key, []byte("myvaluf")))
+	assert.NotEqual(t, checksum, Checksum(Version1, []byte("mykeym"), []byte("yvalue")))
+
+	e := internal.Entry{Key: key, Value: value, Checksum: checksum}
+	assert.NoError(t, VerifyChecksum(Version1, e))
+	assert.ErrorIs(t, VerifyChecksum(VersionLegacy, e), ErrChecksumFailed)
+	e.Key = []byte("mykez")
+	assert.ErrorIs(t, VerifyChecksum(Version1, e), ErrChecksumFailed)
+	assert.True(t, IsCorruptedData(VerifyChecksum(Version1, e)))
+}
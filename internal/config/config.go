@@ -2,9 +2,14 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"log/slog"
 	"os"
+	"time"
+
+	"go.mills.io/bitcask/v2/metrics"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 // Config contains the bitcask configuration parameters
@@ -17,13 +22,77 @@ type Config struct {
 	AutoRecovery    bool        `json:"auto_recovery"`
 	DirMode         os.FileMode `json:"dir_mode"`
 	FileMode        os.FileMode `json:"file_mode"`
+	IndexFormat     string      `json:"index_format"`
+
+	// Observer is notified of operations, it is not persisted
+	Observer metrics.Observer `json:"-"`
+
+	// Logger is used for diagnostics, it is not persisted
+	Logger *slog.Logger `json:"-"`
+
+	// Keydir is the mode of the keydir, it is not persisted
+	Keydir string `json:"-"`
+
+	// CacheSize is the budget in bytes of the value cache, it is not persisted
+	CacheSize int64 `json:"-"`
+
+	// RebuildProgress is called while the index is rebuilt, it is not
+	// persisted
+	RebuildProgress func(done, total int) `json:"-"`
+
+	// WriteBufferSize and WriteBufferInterval are the thresholds at which
+	// buffered writes are flushed, they are not persisted
+	WriteBufferSize     int           `json:"-"`
+	WriteBufferInterval time.Duration `json:"-"`
+
+	// BloomFalsePositiveRate is the false positive rate of the Bloom filters
+	// of the datafiles, zero disables them, it is not persisted
+	BloomFalsePositiveRate float64 `json:"-"`
+
+	// Preallocate, Datasync and Fadvise enable filesystem hints for the
+	// datafiles, they are not persisted
+	Preallocate bool `json:"-"`
+	Datasync    bool `json:"-"`
+	Fadvise     bool `json:"-"`
+
+	// FS is the filesystem the database is stored on, it is not persisted
+	FS vfs.FS `json:"-"`
+}
+
+// discardLogger is the logger used when none is configured
+var discardLogger = slog.New(discardHandler{})
+
+// discardHandler is a slog.Handler that discards all records
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Log returns the configured logger, or a logger that discards everything if
+// none is configured
+func (c *Config) Log() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+	return c.Logger
+}
+
+// FileSystem returns the configured filesystem, or the filesystem of the
+// operating system if none is configured
+func (c *Config) FileSystem() vfs.FS {
+	if c.FS == nil {
+		return vfs.OS
+	}
+	return c.FS
 }
 
-// Load loads a configuration from the given path
-func Load(path string) (*Config, error) {
+// Load loads a configuration from the given path of the filesystem
+func Load(fs vfs.FS, path string) (*Config, error) {
 	var cfg Config
 
-	data, err := os.ReadFile(path)
+	data, err := vfs.ReadFile(fs, path)
 	if err != nil {
 		return nil, err
 	}
@@ -35,18 +104,12 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
-// Save saves the configuration to the provided path
+// Save atomically saves the configuration to the provided path
 func (c *Config) Save(path string) error {
-
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(path, data, c.FileMode)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return vfs.WriteFile(c.FileSystem(), path, data, c.FileMode)
 }
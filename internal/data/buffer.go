@@ -0,0 +1,70 @@
+package data
+
+import (
+	"io"
+	"sync"
+)
+
+// writeBuffer holds the entries written to a datafile which aren't written
+// to the file yet, it is shared with the readonly reopens of the datafile so
+// they read the entries too
+type writeBuffer struct {
+	sync.RWMutex
+
+	data    []byte
+	flushed int64 // offset in the file of data
+	size    int   // size at which the buffer is flushed
+}
+
+func (wb *writeBuffer) Write(p []byte) (int, error) {
+	wb.Lock()
+	defer wb.Unlock()
+
+	wb.data = append(wb.data, p...)
+	return len(p), nil
+}
+
+// full returns true if the buffer should be flushed
+func (wb *writeBuffer) full() bool {
+	wb.RLock()
+	defer wb.RUnlock()
+
+	return len(wb.data) >= wb.size
+}
+
+// flush writes the buffered entries to w, entries partially written are kept
+// buffered from the first byte not written
+func (wb *writeBuffer) flush(w io.Writer) error {
+	wb.Lock()
+	defer wb.Unlock()
+
+	if len(wb.data) == 0 {
+		return nil
+	}
+
+	n, err := w.Write(wb.data)
+	wb.flushed += int64(n)
+	wb.data = wb.data[:copy(wb.data, wb.data[n:])]
+	return err
+}
+
+// readAt reads len(b) bytes at offset off of the datafile from r and the
+// buffer, an entry may be partially flushed
+func (wb *writeBuffer) readAt(r io.ReaderAt, b []byte, off int64) (int, error) {
+	wb.RLock()
+	defer wb.RUnlock()
+
+	n := 0
+	if off < wb.flushed {
+		m, err := r.ReadAt(b[:min(int64(len(b)), wb.flushed-off)], off)
+		if err != nil {
+			return m, err
+		}
+		n = m
+	}
+
+	if start := off + int64(n) - wb.flushed; n < len(b) && start < int64(len(wb.data)) {
+		n += copy(b[n:], wb.data[start:])
+	}
+	return n, nil
+}
@@ -3,15 +3,16 @@ package data
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/mattetti/filebuffer"
 	"github.com/pkg/errors"
-	"golang.org/x/exp/mmap"
 
 	"go.mills.io/bitcask/v2/internal"
 	"go.mills.io/bitcask/v2/internal/codec"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 const (
@@ -27,10 +28,14 @@ var (
 type Datafile interface {
 	FileID() int
 	Name() string
+	Version() int
 	Close() error
 	Sync() error
+	Flush() error
+	Prefetch() error
 	Size() int64
 	Read() (internal.Entry, int64, error)
+	ReadKey() ([]byte, uint64, int64, error)
 	ReadAt(index, size int64) (internal.Entry, error)
 	Write(internal.Entry) (int64, int64, error)
 
@@ -39,24 +44,37 @@ type Datafile interface {
 }
 
 // NewOnDiskDatafile opens an existing on disk datafile
-func NewOnDiskDatafile(path string, id int, readonly bool, maxKeySize uint32, maxValueSize uint64, fileMode os.FileMode) (Datafile, error) {
+func NewOnDiskDatafile(fs vfs.FS, path string, id int, readonly bool, maxKeySize uint32, maxValueSize uint64, fileMode os.FileMode, opts ...Option) (Datafile, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var (
-		r   *os.File
-		ra  *mmap.ReaderAt
-		w   *os.File
+		r   vfs.File
+		ra  vfs.ReaderAt
+		w   vfs.File
 		err error
 	)
 
 	fn := filepath.Join(path, fmt.Sprintf(defaultDatafileFilename, id))
 
 	if !readonly {
-		w, err = os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, fileMode)
+		w, err = fs.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, fileMode)
 		if err != nil {
 			return nil, err
 		}
+
+		// The file keeps its size so reads and recovery stop at the last
+		// entry written and not at the end of the preallocated space
+		if o.preallocate > 0 {
+			if err := vfs.Preallocate(w, o.preallocate); err != nil {
+				return nil, fmt.Errorf("error preallocating %s: %w", fn, err)
+			}
+		}
 	}
 
-	r, err = os.Open(fn)
+	r, err = fs.Open(fn)
 	if err != nil {
 		return nil, err
 	}
@@ -67,19 +85,43 @@ func NewOnDiskDatafile(path string, id int, readonly bool, maxKeySize uint32, ma
 
 	if readonly {
 		w = nil
-		ra, err = mmap.Open(fn)
+		ra, err = fs.Mmap(fn)
 		if err != nil {
 			return nil, err
 		}
+
+		// Readonly datafiles read entries at an offset from ra, r is only
+		// read sequentially
+		if o.advise {
+			vfs.Advise(fs, r, vfs.AdviceSequential)
+		}
 	}
 
 	offset := stat.Size()
 
-	dec := codec.NewDecoder(r, maxKeySize, maxValueSize)
-	enc := codec.NewEncoder(w)
+	// New datafiles are written in the current format, empty datafiles
+	// opened readonly have no header and are legacy datafiles
+	version := codec.VersionLegacy
+	if offset == 0 && w != nil {
+		version = codec.CurrentVersion
+		if err := codec.WriteHeader(w, version); err != nil {
+			return nil, err
+		}
+		offset = codec.HeaderSize
+	} else if version, err = codec.ReadHeader(r, offset); err != nil {
+		return nil, fmt.Errorf("error reading header of %s: %w", fn, err)
+	}
+
+	if _, err := r.Seek(codec.DataOffset(version), io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "error calling Seek()")
+	}
+
+	dec := codec.NewDecoder(r, version, maxKeySize, maxValueSize)
+	enc := codec.NewEncoder(w, version)
 
 	return &onDiskDatafile{
 		id:           id,
+		version:      version,
 		r:            r,
 		ra:           ra,
 		w:            w,
@@ -88,18 +130,39 @@ func NewOnDiskDatafile(path string, id int, readonly bool, maxKeySize uint32, ma
 		enc:          enc,
 		maxKeySize:   maxKeySize,
 		maxValueSize: maxValueSize,
+		datasync:     o.datasync,
+		fs:           fs,
+		advise:       o.advise,
 	}, nil
 }
 
+// NewBufferedDatafile opens an on disk datafile for writing which buffers up
+// to bufferSize bytes of entries before writing them to the file, entries
+// are also written when the datafile is flushed, synced or closed
+func NewBufferedDatafile(fs vfs.FS, path string, id int, maxKeySize uint32, maxValueSize uint64, fileMode os.FileMode, bufferSize int, opts ...Option) (Datafile, error) {
+	df, err := NewOnDiskDatafile(fs, path, id, false, maxKeySize, maxValueSize, fileMode, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := df.(*onDiskDatafile)
+	d.wb = &writeBuffer{flushed: d.offset, size: bufferSize}
+	d.enc = codec.NewEncoder(d.wb, d.version)
+	return d, nil
+}
+
 // NewInMemoryDatafile creates a new in-memory datafile
 func NewInMemoryDatafile(id int, maxKeySize uint32, maxValueSize uint64) Datafile {
 	buf := filebuffer.New(nil)
+	codec.WriteHeader(buf, codec.CurrentVersion)
 
-	dec := codec.NewDecoder(buf, maxKeySize, maxValueSize)
-	enc := codec.NewEncoder(buf)
+	dec := codec.NewDecoder(buf, codec.CurrentVersion, maxKeySize, maxValueSize)
+	enc := codec.NewEncoder(buf, codec.CurrentVersion)
 
 	return &inMemoryDatafile{
 		id:           id,
+		version:      codec.CurrentVersion,
+		offset:       codec.HeaderSize,
 		buf:          buf,
 		dec:          dec,
 		enc:          enc,
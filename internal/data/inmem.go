@@ -14,6 +14,7 @@ type inMemoryDatafile struct {
 	sync.RWMutex
 
 	id           int
+	version      int
 	buf          *filebuffer.Buffer
 	offset       int64
 	dec          *codec.Decoder
@@ -26,6 +27,11 @@ func (df *inMemoryDatafile) FileID() int {
 	return df.id
 }
 
+// Version returns the format version of the datafile
+func (df *inMemoryDatafile) Version() int {
+	return df.version
+}
+
 func (df *inMemoryDatafile) Name() string {
 	return fmt.Sprintf("in-memory-%d", df.id)
 }
@@ -38,6 +44,14 @@ func (df *inMemoryDatafile) Sync() error {
 	return nil
 }
 
+func (df *inMemoryDatafile) Flush() error {
+	return nil
+}
+
+func (df *inMemoryDatafile) Prefetch() error {
+	return nil
+}
+
 func (df *inMemoryDatafile) Size() int64 {
 	df.RLock()
 	defer df.RUnlock()
@@ -57,6 +71,15 @@ func (df *inMemoryDatafile) Read() (e internal.Entry, n int64, err error) {
 	return
 }
 
+// ReadKey reads the key of the next entry from the datafile skipping its
+// value, returning the size of the value and of the entry
+func (df *inMemoryDatafile) ReadKey() ([]byte, uint64, int64, error) {
+	df.Lock()
+	defer df.Unlock()
+
+	return df.dec.DecodeKey()
+}
+
 // ReadAt the entry located at index offset with expected serialized size
 func (df *inMemoryDatafile) ReadAt(index, size int64) (e internal.Entry, err error) {
 	b := make([]byte, size)
@@ -73,7 +96,11 @@ func (df *inMemoryDatafile) ReadAt(index, size int64) (e internal.Entry, err err
 		return
 	}
 
-	codec.DecodeEntry(b, &e, df.maxKeySize, df.maxValueSize)
+	if err = codec.DecodeEntry(df.version, b, &e, df.maxKeySize, df.maxValueSize); err != nil {
+		return
+	}
+
+	err = codec.VerifyChecksum(df.version, e)
 
 	return
 }
@@ -84,6 +111,7 @@ func (df *inMemoryDatafile) Write(e internal.Entry) (int64, int64, error) {
 
 	offset := df.offset
 
+	e.Checksum = codec.Checksum(df.version, e.Key, e.Value)
 	n, err := df.enc.Encode(e)
 	if err != nil {
 		return -1, 0, err
@@ -1,43 +1,59 @@
 package data
 
 import (
-	"os"
 	"sync"
 
-	"golang.org/x/exp/mmap"
-
 	"go.mills.io/bitcask/v2/internal"
 	"go.mills.io/bitcask/v2/internal/codec"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 type onDiskDatafile struct {
 	sync.RWMutex
 
+	// syncMu serializes Sync with Close so syncing, which doesn't block
+	// readers and writers, never syncs a closed datafile
+	syncMu sync.Mutex
+	closed bool
+
 	id           int
-	r            *os.File
-	ra           *mmap.ReaderAt
-	w            *os.File
+	version      int
+	r            vfs.File
+	ra           vfs.ReaderAt
+	w            vfs.File
+	wb           *writeBuffer
 	offset       int64
 	dec          *codec.Decoder
 	enc          *codec.Encoder
 	maxKeySize   uint32
 	maxValueSize uint64
+	datasync     bool
+	fs           vfs.FS
+	advise       bool
 }
 
 func (df *onDiskDatafile) FileID() int {
 	return df.id
 }
 
+// Version returns the format version of the datafile
+func (df *onDiskDatafile) Version() int {
+	return df.version
+}
+
 func (df *onDiskDatafile) Name() string {
 	return df.r.Name()
 }
 
 func (df *onDiskDatafile) Close() error {
+	// Wait for reads in progress before unmapping the datafile
+	df.Lock()
 	defer func() {
 		if df.ra != nil {
 			df.ra.Close()
 		}
 		df.r.Close()
+		df.Unlock()
 	}()
 
 	// Readonly datafile -- Nothing further to close on the write side
@@ -45,20 +61,73 @@ func (df *onDiskDatafile) Close() error {
 		return nil
 	}
 
-	err := df.Sync()
-	if err != nil {
+	if err := df.flush(); err != nil {
 		return err
 	}
+
+	df.syncMu.Lock()
+	defer df.syncMu.Unlock()
+
+	if err := df.sync(); err != nil {
+		return err
+	}
+	df.closed = true
 	return df.w.Close()
 }
 
+// Sync commits the datafile to stable storage, a closed datafile was synced
+// when it was closed
 func (df *onDiskDatafile) Sync() error {
 	if df.w == nil {
 		return nil
 	}
+
+	if err := df.Flush(); err != nil {
+		return err
+	}
+
+	df.syncMu.Lock()
+	defer df.syncMu.Unlock()
+
+	if df.closed {
+		return nil
+	}
+	return df.sync()
+}
+
+// sync commits the written entries, fdatasync is sufficient as datafiles
+// are only appended to and it syncs the size of the file
+func (df *onDiskDatafile) sync() error {
+	if df.datasync {
+		return vfs.Datasync(df.w)
+	}
 	return df.w.Sync()
 }
 
+// Flush writes the entries buffered, if any, to the file
+func (df *onDiskDatafile) Flush() error {
+	df.Lock()
+	defer df.Unlock()
+
+	return df.flush()
+}
+
+func (df *onDiskDatafile) flush() error {
+	if df.w == nil || df.wb == nil || df.closed {
+		return nil
+	}
+	return df.wb.flush(df.w)
+}
+
+// Prefetch hints that the whole datafile is read soon in any order, if read
+// hints are enabled
+func (df *onDiskDatafile) Prefetch() error {
+	if !df.advise {
+		return nil
+	}
+	return vfs.Advise(df.fs, df.r, vfs.AdviceWillNeed)
+}
+
 func (df *onDiskDatafile) Size() int64 {
 	df.RLock()
 	defer df.RUnlock()
@@ -78,6 +147,15 @@ func (df *onDiskDatafile) Read() (e internal.Entry, n int64, err error) {
 	return
 }
 
+// ReadKey reads the key of the next entry from the datafile skipping its
+// value, returning the size of the value and of the entry
+func (df *onDiskDatafile) ReadKey() ([]byte, uint64, int64, error) {
+	df.Lock()
+	defer df.Unlock()
+
+	return df.dec.DecodeKey()
+}
+
 // ReadAt the entry located at index offset with expected serialized size
 func (df *onDiskDatafile) ReadAt(index, size int64) (e internal.Entry, err error) {
 	var n int
@@ -87,9 +165,12 @@ func (df *onDiskDatafile) ReadAt(index, size int64) (e internal.Entry, err error
 	df.RLock()
 	defer df.RUnlock()
 
-	if df.ra != nil {
+	switch {
+	case df.ra != nil:
 		n, err = df.ra.ReadAt(b, index)
-	} else {
+	case df.wb != nil:
+		n, err = df.wb.readAt(df.r, b, index)
+	default:
 		n, err = df.r.ReadAt(b, index)
 	}
 	if err != nil {
@@ -100,7 +181,11 @@ func (df *onDiskDatafile) ReadAt(index, size int64) (e internal.Entry, err error
 		return
 	}
 
-	codec.DecodeEntry(b, &e, df.maxKeySize, df.maxValueSize)
+	if err = codec.DecodeEntry(df.version, b, &e, df.maxKeySize, df.maxValueSize); err != nil {
+		return
+	}
+
+	err = codec.VerifyChecksum(df.version, e)
 
 	return
 }
@@ -115,12 +200,19 @@ func (df *onDiskDatafile) Write(e internal.Entry) (int64, int64, error) {
 
 	offset := df.offset
 
+	e.Checksum = codec.Checksum(df.version, e.Key, e.Value)
 	n, err := df.enc.Encode(e)
 	if err != nil {
 		return -1, 0, err
 	}
 	df.offset += n
 
+	if df.wb != nil && df.wb.full() {
+		if err := df.flush(); err != nil {
+			return -1, 0, err
+		}
+	}
+
 	return offset, n, nil
 }
 
@@ -137,13 +229,17 @@ func (df *onDiskDatafile) ReopenReadonly() Datafile {
 
 	return &onDiskDatafile{
 		id:           df.id,
+		version:      df.version,
 		r:            df.r,
 		ra:           df.ra,
 		w:            nil,
+		wb:           df.wb,
 		offset:       df.offset,
 		dec:          df.dec,
 		enc:          df.enc,
 		maxKeySize:   df.maxKeySize,
 		maxValueSize: df.maxValueSize,
+		fs:           df.fs,
+		advise:       df.advise,
 	}
 }
@@ -0,0 +1,28 @@
+package data
+
+// Option configures how an on disk datafile uses its files
+type Option func(o *options)
+
+type options struct {
+	preallocate int64
+	datasync    bool
+	advise      bool
+}
+
+// WithPreallocate preallocates size bytes of disk space for writable
+// datafiles so they don't fragment as they grow by small appends
+func WithPreallocate(size int64) Option {
+	return func(o *options) { o.preallocate = size }
+}
+
+// WithDatasync syncs datafiles with fdatasync instead of fsync
+func WithDatasync() Option {
+	return func(o *options) { o.datasync = true }
+}
+
+// WithReadHints hints the filesystem how datafiles are read: readonly
+// datafiles sequentially by Read and ReadKey, as when rebuilding the index,
+// and entirely in any order once prefetched, as when they are merged
+func WithReadHints() Option {
+	return func(o *options) { o.advise = true }
+}
@@ -1,95 +1,374 @@
 package data
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"go.mills.io/bitcask/v2/internal"
 	"go.mills.io/bitcask/v2/internal/codec"
 	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
+// QuarantineDir is the subdirectory of a database corrupted byte ranges of
+// datafiles are moved to on recovery
+const QuarantineDir = "quarantine"
+
+var errTruncatedEntry = errors.New("entry is truncated")
+
+// RecoverOptions controls which datafiles are recovered and how
+type RecoverOptions struct {
+	// All recovers all datafiles instead of only the last one
+	All bool
+
+	// DryRun only reports what would be recovered without changing anything
+	DryRun bool
+}
+
+// Region is a corrupted byte range of a datafile
+type Region struct {
+	Datafile   string `json:"datafile"`
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	Quarantine string `json:"quarantine,omitempty"`
+}
+
+// LostKey is a key whose entry was in a corrupted region and that has no
+// valid entry after it. An older value of the key may still be in the
+// database.
+type LostKey struct {
+	Key      string `json:"key"`
+	Datafile string `json:"datafile"`
+	Offset   int64  `json:"offset"`
+}
+
+// Report is the result of a recovery
+type Report struct {
+	// Datafiles is the number of datafiles checked
+	Datafiles int `json:"datafiles"`
+	// Recovered are the datafiles with corrupted regions, they are only
+	// rewritten if it isn't a dry run
+	Recovered []string  `json:"recovered"`
+	Regions   []Region  `json:"regions"`
+	LostKeys  []LostKey `json:"lost_keys"`
+}
+
 // CheckAndRecover checks and recovers the last datafile.
-// If the datafile isn't corrupted, this is a noop. If it is,
-// the longest non-corrupted prefix will be kept and the rest
-// will be *deleted*. Also, the index file is also *deleted* which
-// will be automatically recreated on next startup.
+// If the datafile isn't corrupted, this is a noop. If it is, the corrupted
+// byte ranges are moved to the quarantine directory and every valid entry
+// is kept. Also, the index file is also *deleted* which will be
+// automatically recreated on next startup.
 func CheckAndRecover(path string, cfg *config.Config) error {
-	dfs, err := internal.GetDatafiles(path)
+	log := cfg.Log()
+
+	report, err := Recover(path, cfg, RecoverOptions{})
 	if err != nil {
-		return fmt.Errorf("scanning datafiles: %s", err)
+		return err
 	}
-	if len(dfs) == 0 {
-		return nil
+	for _, r := range report.Regions {
+		log.Warn("recovered corrupted datafile, quarantined corrupted entries", "datafile", r.Datafile, "offset", r.Offset, "size", r.Size, "quarantine", r.Quarantine)
 	}
-	f := dfs[len(dfs)-1]
-	recovered, err := recoverDatafile(f, cfg)
+	for _, k := range report.LostKeys {
+		log.Warn("lost the latest value of key", "key", k.Key, "datafile", k.Datafile, "offset", k.Offset)
+	}
+	return nil
+}
+
+// Recover checks the datafiles of the database at path for corrupted
+// entries. Instead of discarding everything after the first corrupted entry
+// the datafile is resynchronized at the next valid entry (with valid sizes
+// and a matching checksum), the corrupted byte ranges in between are moved
+// to the quarantine directory and the keys of corrupted entries that could
+// still be read are reported as lost. The index is deleted if any datafile
+// was recovered so it is rebuilt on next startup.
+func Recover(path string, cfg *config.Config, opts RecoverOptions) (*Report, error) {
+	fs := cfg.FileSystem()
+
+	dfs, err := internal.GetDatafiles(fs, path)
 	if err != nil {
-		return fmt.Errorf("error recovering data file: %s", err)
+		return nil, fmt.Errorf("scanning datafiles: %w", err)
+	}
+	if !opts.All && len(dfs) > 0 {
+		dfs = dfs[len(dfs)-1:]
 	}
-	if recovered {
-		if err := os.Remove(filepath.Join(path, "index")); err != nil {
-			return fmt.Errorf("error deleting the index on recovery: %s", err)
+	log := cfg.Log()
+
+	report := &Report{Recovered: []string{}, Regions: []Region{}, LostKeys: []LostKey{}}
+	lost := make(map[string]LostKey)
+
+	for _, f := range dfs {
+		log.Debug("checking datafile", "datafile", f)
+		report.Datafiles++
+
+		regions, err := recoverDatafile(path, f, cfg, opts.DryRun, lost)
+		if err != nil {
+			return nil, fmt.Errorf("error recovering data file: %w", err)
+		}
+		if len(regions) > 0 {
+			report.Recovered = append(report.Recovered, filepath.Base(f))
+			report.Regions = append(report.Regions, regions...)
 		}
 	}
-	return nil
+
+	for _, k := range lost {
+		report.LostKeys = append(report.LostKeys, k)
+	}
+	sort.Slice(report.LostKeys, func(i, j int) bool {
+		a, b := report.LostKeys[i], report.LostKeys[j]
+		if a.Datafile != b.Datafile {
+			return a.Datafile < b.Datafile
+		}
+		return a.Offset < b.Offset
+	})
+
+	if len(report.Recovered) > 0 && !opts.DryRun {
+		if err := fs.Remove(filepath.Join(path, "index")); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error deleting the index on recovery: %w", err)
+		}
+		log.Info("deleted index to be rebuilt from datafiles", "path", path)
+	}
+
+	return report, nil
 }
 
-func recoverDatafile(path string, cfg *config.Config) (recovered bool, err error) {
-	f, err := os.Open(path)
+// ScannedEntry is an entry read by ScanDatafile
+type ScannedEntry struct {
+	internal.Entry
+
+	// Offset is the offset of the entry in the datafile
+	Offset int64
+
+	// Size is the encoded size of the entry
+	Size int64
+
+	// Corrupted is set if the entry failed its checksum, only its key may
+	// still be of use and it is covered by a corrupted region
+	Corrupted bool
+}
+
+// ScanDatafile streams every entry of the datafile fn to onEntry and every
+// corrupted region to onRegion, in order, resynchronizing at the next valid
+// entry (with valid sizes and a matching checksum) after each corrupted
+// region. Only the bytes around the offset being scanned are buffered. The
+// format version of the datafile is returned. A maxKeySize or maxValueSize
+// of 0 is unlimited.
+func ScanDatafile(fs vfs.FS, fn string, maxKeySize uint32, maxValueSize uint64, onEntry func(ScannedEntry) error, onRegion func(Region) error) (int, error) {
+	f, err := fs.Open(fn)
 	if err != nil {
-		return false, fmt.Errorf("opening the datafile: %s", err)
+		return 0, fmt.Errorf("opening the datafile: %w", err)
 	}
-	defer func() {
-		closeErr := f.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
-	dir, file := filepath.Split(path)
-	rPath := filepath.Join(dir, fmt.Sprintf("%s.recovered", file))
-	fr, err := os.OpenFile(rPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("reading the datafile: %w", err)
+	}
+	version, err := codec.ReadHeader(f, stat.Size())
 	if err != nil {
-		return false, fmt.Errorf("creating the recovered datafile: %w", err)
+		return 0, fmt.Errorf("reading the datafile header: %w", err)
 	}
-	defer func() {
-		closeErr := fr.Close()
+	name := filepath.Base(fn)
+
+	r := &scanReader{r: f, size: stat.Size()}
+
+	offset := codec.DataOffset(version)
+	for offset < r.size {
+		e, n, err := r.entryAt(offset, version, maxKeySize, maxValueSize)
+		if r.err != nil {
+			return version, fmt.Errorf("reading the datafile: %w", r.err)
+		}
 		if err == nil {
-			err = closeErr
+			if err := onEntry(ScannedEntry{Entry: e, Offset: offset, Size: n}); err != nil {
+				return version, err
+			}
+			offset += n
+			continue
 		}
-	}()
 
-	dec := codec.NewDecoder(f, cfg.MaxKeySize, cfg.MaxValueSize)
-	enc := codec.NewEncoder(fr)
-	e := internal.Entry{}
+		// The key of an entry failing its checksum can still be read
+		if errors.Is(err, codec.ErrChecksumFailed) {
+			if err := onEntry(ScannedEntry{Entry: e, Offset: offset, Corrupted: true}); err != nil {
+				return version, err
+			}
+		}
 
-	corrupted := false
-	for !corrupted {
-		_, err = dec.Decode(&e)
-		if err == io.EOF {
-			break
+		end := offset + 1
+		for ; end < r.size; end++ {
+			if _, _, err := r.entryAt(end, version, maxKeySize, maxValueSize); err == nil {
+				break
+			}
+			if r.err != nil {
+				return version, fmt.Errorf("reading the datafile: %w", r.err)
+			}
 		}
-		if codec.IsCorruptedData(err) {
-			corrupted = true
-			continue
+		if onRegion != nil {
+			if err := onRegion(Region{Datafile: name, Offset: offset, Size: end - offset}); err != nil {
+				return version, err
+			}
 		}
-		if err != nil {
-			return false, fmt.Errorf("unexpected error while reading datafile: %w", err)
+		offset = end
+	}
+
+	return version, nil
+}
+
+// recoverDatafile scans the datafile fn for corrupted regions, keeping track
+// of keys lost in them, and unless dryRun is set quarantines the corrupted
+// regions and rewrites it with only its valid entries
+func recoverDatafile(path, fn string, cfg *config.Config, dryRun bool, lost map[string]LostKey) ([]Region, error) {
+	fs := cfg.FileSystem()
+	name := filepath.Base(fn)
+
+	var regions []Region
+	version, err := ScanDatafile(fs, fn, cfg.MaxKeySize, cfg.MaxValueSize, func(e ScannedEntry) error {
+		if e.Corrupted {
+			lost[string(e.Key)] = LostKey{Key: string(e.Key), Datafile: name, Offset: e.Offset}
+		} else {
+			delete(lost, string(e.Key))
 		}
-		if _, err := enc.Encode(e); err != nil {
-			return false, fmt.Errorf("writing to recovered datafile: %w", err)
+		return nil
+	}, func(r Region) error {
+		regions = append(regions, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(regions) == 0 || dryRun {
+		return regions, nil
+	}
+
+	qdir := filepath.Join(path, QuarantineDir)
+	if err := fs.MkdirAll(qdir, cfg.DirMode); err != nil {
+		return nil, fmt.Errorf("creating the quarantine directory: %w", err)
+	}
+	for i, r := range regions {
+		qfn := filepath.Join(qdir, fmt.Sprintf("%s.%d", name, r.Offset))
+		if err := quarantine(fs, fn, qfn, r, cfg.FileMode); err != nil {
+			return nil, fmt.Errorf("quarantining corrupted region: %w", err)
 		}
+		regions[i].Quarantine = filepath.Join(QuarantineDir, filepath.Base(qfn))
 	}
-	if !corrupted {
-		if err := os.Remove(fr.Name()); err != nil {
-			return false, fmt.Errorf("can't remove temporal recovered datafile: %w", err)
+
+	a, err := vfs.CreateAtomic(fs, fn, cfg.FileMode)
+	if err != nil {
+		return nil, fmt.Errorf("replacing corrupted datafile: %w", err)
+	}
+	if version != codec.VersionLegacy {
+		if err := codec.WriteHeader(a, version); err != nil {
+			a.Abort()
+			return nil, fmt.Errorf("writing to recovered datafile: %w", err)
+		}
+	}
+
+	// The valid entries are encoded as they were read
+	enc := codec.NewEncoder(a, version)
+	if _, err := ScanDatafile(fs, fn, cfg.MaxKeySize, cfg.MaxValueSize, func(e ScannedEntry) error {
+		if e.Corrupted {
+			return nil
 		}
-		return false, nil
+		_, err := enc.Encode(e.Entry)
+		return err
+	}, nil); err != nil {
+		a.Abort()
+		return nil, fmt.Errorf("writing to recovered datafile: %w", err)
+	}
+
+	if err := a.Commit(); err != nil {
+		return nil, fmt.Errorf("replacing corrupted datafile: %w", err)
+	}
+
+	return regions, nil
+}
+
+// quarantine copies the corrupted region r of the datafile fn to qfn
+func quarantine(fs vfs.FS, fn, qfn string, r Region, perm os.FileMode) error {
+	f, err := fs.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	a, err := vfs.CreateAtomic(fs, qfn, perm)
+	if err != nil {
+		return err
 	}
-	if err := os.Rename(rPath, path); err != nil {
-		return false, fmt.Errorf("removing corrupted file: %s", err)
+	if _, err := io.Copy(a, io.NewSectionReader(f, r.Offset, r.Size)); err != nil {
+		a.Abort()
+		return err
+	}
+	return a.Commit()
+}
+
+// scanBufferSize is the size of the window of a datafile buffered by
+// scanReader, it grows to fit larger entries
+const scanBufferSize = 64 << 10
+
+// scanReader reads entries of a datafile through a window buffering the
+// bytes around the offset being scanned, the window only moves forward when
+// scanning or resynchronizing after a corrupted region
+type scanReader struct {
+	r    io.ReaderAt
+	size int64
+
+	// buf holds the bytes of the datafile starting at off
+	buf []byte
+	off int64
+
+	// err is the first error reading the datafile, it is not corruption
+	err error
+}
+
+// read returns the n bytes at offset, they are valid until the next read
+func (s *scanReader) read(offset, n int64) ([]byte, error) {
+	if n > s.size-offset {
+		return nil, errTruncatedEntry
+	}
+	if offset >= s.off && offset+n <= s.off+int64(len(s.buf)) {
+		return s.buf[offset-s.off : offset-s.off+n], nil
+	}
+
+	size := min(max(n, scanBufferSize), s.size-offset)
+	if int64(cap(s.buf)) < size {
+		s.buf = make([]byte, size)
+	}
+	s.buf = s.buf[:size]
+	if m, err := s.r.ReadAt(s.buf, offset); m < len(s.buf) {
+		s.buf, s.err = s.buf[:0], err
+		return nil, err
+	}
+	s.off = offset
+	return s.buf[:n], nil
+}
+
+// entryAt decodes and verifies the entry at offset and returns it along with
+// its encoded size. On a checksum failure the entry is returned too as its
+// key may still be of use.
+func (s *scanReader) entryAt(offset int64, version int, maxKeySize uint32, maxValueSize uint64) (internal.Entry, int64, error) {
+	var e internal.Entry
+
+	prefix, err := s.read(offset, int64(codec.PrefixSize(version)))
+	if err != nil {
+		return e, 0, err
+	}
+	n, err := codec.EntrySize(version, prefix, maxKeySize, maxValueSize)
+	if err != nil {
+		return e, 0, err
+	}
+	b, err := s.read(offset, n)
+	if err != nil {
+		return e, 0, err
+	}
+
+	// Entries outlive the window
+	if err := codec.DecodeEntry(version, bytes.Clone(b), &e, maxKeySize, maxValueSize); err != nil {
+		return e, 0, err
 	}
-	return true, nil
+	return e, n, codec.VerifyChecksum(version, e)
 }
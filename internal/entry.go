@@ -1,11 +1,9 @@
 // Package internal contains internal implementation details
 package internal
 
-import (
-	"hash/crc32"
-)
-
-// Entry represents a key/value in the database
+// Entry represents a key/value in the database. The checksum is computed
+// when the entry is written to a datafile as it depends on the format of the
+// datafile.
 type Entry struct {
 	Checksum uint32
 	Key      []byte
@@ -14,11 +12,8 @@ type Entry struct {
 
 // NewEntry creates a new `Entry` with the given `key` and `value`
 func NewEntry(key, value []byte) Entry {
-	checksum := crc32.ChecksumIEEE(value)
-
 	return Entry{
-		Checksum: checksum,
-		Key:      key,
-		Value:    value,
+		Key:   key,
+		Value: value,
 	}
 }
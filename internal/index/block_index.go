@@ -0,0 +1,209 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/keydir"
+)
+
+// The block format stores the keys in the order walked from the keydir,
+// sorted unless the keydir is unordered, in blocks of up to blockEntries entries each:
+//
+//	header  "BCIB" version (uint32)
+//	block   size (uint32) count (uint32) entry...
+//	entry   shared (uvarint) unshared (uvarint) key suffix (unshared bytes)
+//	        fileID (uvarint) offset (uvarint) size (uvarint)
+//	trailer "BCIE" CRC32C of everything before it (uint32)
+//
+// Keys are prefix compressed against the previous key of their block. The
+// whole index is read at once and bulk loaded into the keydir.
+
+var (
+	errCorruptBlock = errors.New("index block is corrupted")
+
+	// blockMagic identifies an index in the block format
+	blockMagic = []byte("BCIB")
+)
+
+const (
+	// BlockVersion1 is the first version of the block format
+	BlockVersion1 = 1
+
+	// BlockCurrentVersion is the version of the block format indexes are
+	// written in
+	BlockCurrentVersion = BlockVersion1
+
+	blockHeaderSize = 8
+	blockEntries    = 1024
+
+	// arenaSize is the size of the chunks of memory keys are loaded into
+	arenaSize = 64 << 10
+)
+
+// isBlockIndex returns true if data is an index in the block format
+func isBlockIndex(data []byte) bool {
+	return bytes.HasPrefix(data, blockMagic)
+}
+
+// writeBlockHeader writes the header of an index in the block format
+func writeBlockHeader(w io.Writer) error {
+	header := make([]byte, headerSize)
+	copy(header, blockMagic)
+	binary.BigEndian.PutUint32(header[len(blockMagic):], BlockCurrentVersion)
+
+	_, err := w.Write(header)
+	return err
+}
+
+// writeBlocks writes the keys and items of the keydir as blocks
+func writeBlocks(t keydir.View, w io.Writer) (err error) {
+	var (
+		block []byte
+		prev  []byte
+		count int
+	)
+
+	flush := func() error {
+		header := make([]byte, blockHeaderSize)
+		binary.BigEndian.PutUint32(header, uint32(len(block)))
+		binary.BigEndian.PutUint32(header[4:], uint32(count))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+		block, prev, count = block[:0], nil, 0
+		return nil
+	}
+
+	t.Walk(func(key []byte, item internal.Item) bool {
+		shared := commonPrefix(prev, key)
+		block = binary.AppendUvarint(block, uint64(shared))
+		block = binary.AppendUvarint(block, uint64(len(key)-shared))
+		block = append(block, key[shared:]...)
+		block = binary.AppendUvarint(block, uint64(item.FileID))
+		block = binary.AppendUvarint(block, uint64(item.Offset))
+		block = binary.AppendUvarint(block, uint64(item.Size))
+		prev = key
+		count++
+
+		if count == blockEntries {
+			err = flush()
+		}
+		return err != nil
+	})
+	if err != nil || count == 0 {
+		return err
+	}
+	return flush()
+}
+
+// readBlocks verifies the index data in the block format and bulk loads its
+// keys and items into the keydir
+func readBlocks(data []byte, t keydir.Keydir, maxKeySize uint32) (keydir.Keydir, error) {
+	if len(data) < headerSize {
+		return t, errTruncatedData
+	}
+	version := int(binary.BigEndian.Uint32(data[len(blockMagic):headerSize]))
+	if version > BlockCurrentVersion {
+		return t, ErrUnsupportedVersion
+	}
+
+	body, err := verifyTrailer(data)
+	if err != nil {
+		return t, err
+	}
+	body = body[headerSize:]
+
+	return keydir.Load(t, func(w keydir.Writer) error {
+		return loadBlocks(body, maxKeySize, w.Insert)
+	})
+}
+
+// loadBlocks passes the keys and items of the blocks to insert
+func loadBlocks(body []byte, maxKeySize uint32, insert func(key []byte, item internal.Item)) (err error) {
+	var arena []byte
+	for len(body) > 0 {
+		if len(body) < blockHeaderSize {
+			return errTruncatedData
+		}
+		size := binary.BigEndian.Uint32(body)
+		count := binary.BigEndian.Uint32(body[4:])
+		body = body[blockHeaderSize:]
+		if uint64(size) > uint64(len(body)) {
+			return errTruncatedData
+		}
+		block := body[:size]
+		body = body[size:]
+
+		var prev []byte
+		for n := uint32(0); n < count; n++ {
+			var shared, unshared, fileID, offset, itemSize uint64
+			if shared, block, err = uvarint(block); err != nil {
+				return err
+			}
+			if unshared, block, err = uvarint(block); err != nil {
+				return err
+			}
+			if shared > uint64(len(prev)) || unshared > uint64(len(block)) {
+				return errCorruptBlock
+			}
+			keySize := shared + unshared
+			if maxKeySize > 0 && keySize > uint64(maxKeySize) {
+				return errKeySizeTooLarge
+			}
+
+			// Keys are allocated from larger chunks of memory
+			if uint64(cap(arena)-len(arena)) < keySize {
+				arena = make([]byte, 0, max(arenaSize, int(keySize)))
+			}
+			key := arena[len(arena) : len(arena)+int(keySize) : len(arena)+int(keySize)]
+			arena = arena[:len(arena)+int(keySize)]
+			copy(key, prev[:shared])
+			copy(key[shared:], block[:unshared])
+			block = block[unshared:]
+
+			if fileID, block, err = uvarint(block); err != nil {
+				return err
+			}
+			if offset, block, err = uvarint(block); err != nil {
+				return err
+			}
+			if itemSize, block, err = uvarint(block); err != nil {
+				return err
+			}
+
+			insert(key, internal.Item{FileID: int(fileID), Offset: int64(offset), Size: int64(itemSize)})
+			prev = key
+		}
+		if len(block) > 0 {
+			return errCorruptBlock
+		}
+	}
+	return nil
+}
+
+// uvarint decodes an uvarint from b and returns the rest of b
+func uvarint(b []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, b, errCorruptBlock
+	}
+	return v, b[n:], nil
+}
+
+// commonPrefix returns the length of the common prefix of a and b
+func commonPrefix(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
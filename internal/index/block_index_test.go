@@ -0,0 +1,177 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/keydir"
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+// getLargeTree returns a tree with n keys sharing long prefixes
+func getLargeTree(n int) keydir.Keydir {
+	kd, _ := keydir.Load(emptyKeydir(), func(w keydir.Writer) error {
+		for i := 0; i < n; i++ {
+			key := []byte(fmt.Sprintf("user:%08d:profile", i*7919%n))
+			w.Insert(key, internal.Item{FileID: i % 100, Offset: int64(i) * 4096, Size: int64(i%512 + 1)})
+		}
+		return nil
+	})
+	return kd
+}
+
+func assertSameTree(t *testing.T, expected, actual keydir.Keydir) {
+	t.Helper()
+
+	require.Equal(t, expected.Len(), actual.Len())
+	expected.Walk(func(key []byte, item internal.Item) bool {
+		loaded, found := actual.Get(key)
+		assert.True(t, found, "key %s", key)
+		assert.Equal(t, item, loaded, "key %s", key)
+		return false
+	})
+}
+
+func TestBlockFormat(t *testing.T) {
+	at := getLargeTree(3*blockEntries + 17)
+	fn := filepath.Join(t.TempDir(), "index")
+
+	indexer, err := NewIndexerWithFormat(vfs.OS, FormatBlock)
+	require.NoError(t, err)
+	require.NoError(t, indexer.Save(at, fn, 0600))
+
+	loaded, err := indexer.Load(fn, 1024, emptyKeydir())
+	require.NoError(t, err)
+	assertSameTree(t, at, loaded)
+
+	t.Run("Empty", func(t *testing.T) {
+		require.NoError(t, indexer.Save(emptyKeydir(), fn+".empty", 0600))
+
+		loaded, err := indexer.Load(fn+".empty", 1024, emptyKeydir())
+		require.NoError(t, err)
+		assert.Equal(t, 0, loaded.Len())
+	})
+
+	t.Run("AnyFormat", func(t *testing.T) {
+		// Indexes in either format are loaded by either indexer
+		stream := NewIndexer()
+		loaded, err := stream.Load(fn, 1024, emptyKeydir())
+		require.NoError(t, err)
+		assertSameTree(t, at, loaded)
+
+		require.NoError(t, stream.Save(at, fn+".stream", 0600))
+		loaded, err = indexer.Load(fn+".stream", 1024, emptyKeydir())
+		require.NoError(t, err)
+		assertSameTree(t, at, loaded)
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		_, err := NewIndexerWithFormat(vfs.OS, Format("foo"))
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	})
+
+	t.Run("KeySizeTooLarge", func(t *testing.T) {
+		_, err := indexer.Load(fn, 4, emptyKeydir())
+		assert.ErrorIs(t, err, errKeySizeTooLarge)
+	})
+
+	t.Run("Newer", func(t *testing.T) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		data[headerSize-1] = BlockCurrentVersion + 1
+		require.NoError(t, os.WriteFile(fn+".newer", data, 0600))
+
+		_, err = indexer.Load(fn+".newer", 1024, emptyKeydir())
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+
+	t.Run("Torn", func(t *testing.T) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+
+		// A torn index is never partially loaded
+		for n := len(blockMagic); n < len(data); n += 97 {
+			require.NoError(t, os.WriteFile(fn+".torn", data[:n], 0600))
+
+			loaded, err := indexer.Load(fn+".torn", 1024, emptyKeydir())
+			assert.True(t, IsIndexCorruption(err), "torn at %d: %v", n, err)
+			assert.Equal(t, 0, loaded.Len())
+		}
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		data[headerSize+blockHeaderSize+2] ^= 0xff
+		require.NoError(t, os.WriteFile(fn+".corrupt", data, 0600))
+
+		loaded, err := indexer.Load(fn+".corrupt", 1024, emptyKeydir())
+		assert.ErrorIs(t, err, errChecksumFailed)
+		assert.Equal(t, 0, loaded.Len())
+	})
+}
+
+func TestReadBlocksCorrupted(t *testing.T) {
+	// Blocks are checked even if the checksum matches
+	var w bytes.Buffer
+	require.NoError(t, writeBlockHeader(&w))
+	require.NoError(t, writeBlocks(getLargeTree(10), &w))
+	body := w.Bytes()
+
+	for _, tc := range []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{"Count", func(b []byte) []byte { b[headerSize+7]++; return b }},
+		{"Size", func(b []byte) []byte { b[headerSize+3]--; return b }},
+		{"Shared", func(b []byte) []byte { b[headerSize+blockHeaderSize] = 10; return b }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := bytes.NewBuffer(tc.corrupt(append([]byte(nil), body...)))
+			require.NoError(t, writeTrailer(data, crc32.Checksum(data.Bytes(), castagnoli)))
+
+			loaded, err := readBlocks(data.Bytes(), emptyKeydir(), 1024)
+			assert.True(t, IsIndexCorruption(err), err)
+			assert.Equal(t, 0, loaded.Len())
+		})
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	const keys = 100000
+
+	at := getLargeTree(keys)
+	for _, format := range []Format{FormatStream, FormatBlock} {
+		indexer, err := NewIndexerWithFormat(vfs.OS, format)
+		require.NoError(b, err)
+		fn := filepath.Join(b.TempDir(), "index")
+
+		b.Run(fmt.Sprintf("%s/Save", format), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := indexer.Save(at, fn, 0600); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("%s/Load", format), func(b *testing.B) {
+			info, err := os.Stat(fn)
+			require.NoError(b, err)
+			b.SetBytes(info.Size())
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := indexer.Load(fn, 1024, emptyKeydir()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package index
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"hash/crc32"
 	"io"
 
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
 	"github.com/pkg/errors"
 	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/keydir"
 )
 
 var (
@@ -14,6 +17,38 @@ var (
 	errTruncatedKeyData = errors.New("key data is truncated")
 	errTruncatedData    = errors.New("data is truncated")
 	errKeySizeTooLarge  = errors.New("key size too large")
+	errChecksumFailed   = errors.New("index checksum failed")
+
+	// ErrUnsupportedVersion is the error returned when the index was written
+	// in a format newer than CurrentVersion
+	ErrUnsupportedVersion = errors.New("unsupported index version")
+
+	// magic identifies an index with a header
+	magic = []byte("BCIX")
+
+	// trailerMagic identifies the trailer of an index
+	trailerMagic = []byte("BCIE")
+
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+)
+
+const (
+	// VersionLegacy is the format of indexes written before indexes had a
+	// header
+	VersionLegacy = 0
+
+	// Version1 is the format of indexes starting with a header
+	Version1 = 1
+
+	// Version2 is the format of indexes ending with a trailer with a CRC32C
+	// checksum of the whole index so a torn index is detected
+	Version2 = 2
+
+	// CurrentVersion is the format indexes are written in
+	CurrentVersion = Version2
+
+	headerSize  = 8
+	trailerSize = 8
 )
 
 const (
@@ -24,6 +59,62 @@ const (
 	sizeSize   = int64Size
 )
 
+// writeHeader writes the header of an index in the given format version
+func writeHeader(w io.Writer, version int) error {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], uint32(version))
+
+	_, err := w.Write(header)
+	return err
+}
+
+// readHeader reads the header of an index, if any, and returns its format
+// version, indexes without a header are VersionLegacy.
+func readHeader(r *bufio.Reader) (int, error) {
+	header, err := r.Peek(headerSize)
+	if err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		// Too short for a header or no header, left for readIndex
+		return VersionLegacy, nil
+	}
+
+	version := int(binary.BigEndian.Uint32(header[len(magic):]))
+	if version > CurrentVersion {
+		return version, ErrUnsupportedVersion
+	}
+	if _, err := r.Discard(headerSize); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// writeTrailer writes the trailer of an index with the checksum of
+// everything written before it
+func writeTrailer(w io.Writer, checksum uint32) error {
+	trailer := make([]byte, trailerSize)
+	copy(trailer, trailerMagic)
+	binary.BigEndian.PutUint32(trailer[len(trailerMagic):], checksum)
+
+	_, err := w.Write(trailer)
+	return err
+}
+
+// verifyTrailer verifies the trailer of the index data and returns the data
+// it covers without the trailer
+func verifyTrailer(data []byte) ([]byte, error) {
+	if len(data) < headerSize+trailerSize {
+		return nil, errTruncatedData
+	}
+	body, trailer := data[:len(data)-trailerSize], data[len(data)-trailerSize:]
+	if !bytes.Equal(trailer[:len(trailerMagic)], trailerMagic) {
+		return nil, errTruncatedData
+	}
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(trailer[len(trailerMagic):]) {
+		return nil, errChecksumFailed
+	}
+	return body, nil
+}
+
 func readKeyBytes(r io.Reader, maxKeySize uint32) ([]byte, error) {
 	s := make([]byte, int32Size)
 	_, err := io.ReadFull(r, s)
@@ -84,7 +175,7 @@ func writeItem(item internal.Item, w io.Writer) error {
 }
 
 // ReadIndex reads a persisted from a io.Reader into a Tree
-func readIndex(r io.Reader, t *iradix.Tree[internal.Item], maxKeySize uint32) (*iradix.Tree[internal.Item], error) {
+func readIndex(r io.Reader, t keydir.Keydir, maxKeySize uint32) (keydir.Keydir, error) {
 	for {
 		key, err := readKeyBytes(r, maxKeySize)
 		if err != nil {
@@ -99,20 +190,20 @@ func readIndex(r io.Reader, t *iradix.Tree[internal.Item], maxKeySize uint32) (*
 			return t, err
 		}
 
-		t, _, _ = t.Insert(key, item)
+		t = t.Insert(key, item)
 	}
 
 	return t, nil
 }
 
-func writeIndex(t *iradix.Tree[internal.Item], w io.Writer) (err error) {
-	t.Root().Walk(func(key []byte, item internal.Item) bool {
+func writeIndex(t keydir.View, w io.Writer) (err error) {
+	t.Walk(func(key []byte, item internal.Item) bool {
 		err = writeBytes(key, w)
 		if err != nil {
 			return true
 		}
 
-		err := writeItem(item, w)
+		err = writeItem(item, w)
 		return err != nil
 	})
 	return
@@ -123,7 +214,7 @@ func writeIndex(t *iradix.Tree[internal.Item], w io.Writer) (err error) {
 func IsIndexCorruption(err error) bool {
 	cause := errors.Cause(err)
 	switch cause {
-	case errKeySizeTooLarge, errTruncatedData, errTruncatedKeyData, errTruncatedKeySize:
+	case errKeySizeTooLarge, errTruncatedData, errTruncatedKeyData, errTruncatedKeySize, errChecksumFailed, errCorruptBlock:
 		return true
 	}
 	return false
@@ -6,9 +6,9 @@ import (
 	"encoding/binary"
 	"testing"
 
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
 	"github.com/pkg/errors"
 	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/keydir"
 )
 
 const (
@@ -32,12 +32,36 @@ func TestWriteIndex(t *testing.T) {
 	}
 }
 
+// failWriter fails every write after n bytes were written
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("write failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteIndexError(t *testing.T) {
+	at, expectedSerializedSize := getSampleTree()
+
+	// Fail writing the item of the last key
+	itemSize := fileIDSize + offsetSize + sizeSize
+	err := writeIndex(at, &failWriter{n: expectedSerializedSize - itemSize})
+	if err == nil {
+		t.Fatalf("writing index should fail")
+	}
+}
+
 func TestReadIndex(t *testing.T) {
 	sampleTreeBytes, _ := base64.StdEncoding.DecodeString(base64SampleTree)
 	b := bytes.NewBuffer(sampleTreeBytes)
 
 	var err error
-	at := iradix.New[internal.Item]()
+	at := emptyKeydir()
 	at, err = readIndex(b, at, 1024)
 	if err != nil {
 		t.Fatalf("error while deserializing correct sample tree: %v", err)
@@ -47,8 +71,8 @@ func TestReadIndex(t *testing.T) {
 	if atsample.Len() != at.Len() {
 		t.Fatalf("trees aren't the same size, expected %v, got %v", atsample.Len(), at.Len())
 	}
-	atsample.Root().Walk(func(key []byte, item internal.Item) bool {
-		_, found := at.Root().Get(key)
+	atsample.Walk(func(key []byte, item internal.Item) bool {
+		_, found := at.Get(key)
 		if !found {
 			t.Fatalf("expected node wasn't found: %s", key)
 		}
@@ -76,7 +100,7 @@ func TestReadCorruptedData(t *testing.T) {
 			t.Run(table[i].name, func(t *testing.T) {
 				bf := bytes.NewBuffer(table[i].data)
 
-				if _, err := readIndex(bf, iradix.New[internal.Item](), 1024); !IsIndexCorruption(err) || errors.Cause(err) != table[i].err {
+				if _, err := readIndex(bf, emptyKeydir(), 1024); !IsIndexCorruption(err) || errors.Cause(err) != table[i].err {
 					t.Fatalf("expected %v, got %v", table[i].err, err)
 				}
 			})
@@ -105,7 +129,7 @@ func TestReadCorruptedData(t *testing.T) {
 			t.Run(table[i].name, func(t *testing.T) {
 				bf := bytes.NewBuffer(table[i].data)
 
-				if _, err := readIndex(bf, iradix.New[internal.Item](), table[i].maxKeySize); !IsIndexCorruption(err) || errors.Cause(err) != table[i].err {
+				if _, err := readIndex(bf, emptyKeydir(), table[i].maxKeySize); !IsIndexCorruption(err) || errors.Cause(err) != table[i].err {
 					t.Fatalf("expected %v, got %v", table[i].err, err)
 				}
 			})
@@ -114,12 +138,17 @@ func TestReadCorruptedData(t *testing.T) {
 
 }
 
-func getSampleTree() (*iradix.Tree[internal.Item], int) {
-	at := iradix.New[internal.Item]()
+func emptyKeydir() keydir.Keydir {
+	kd, _ := keydir.New(keydir.ModeRadix)
+	return kd
+}
+
+func getSampleTree() (keydir.Keydir, int) {
+	at := emptyKeydir()
 	keys := [][]byte{[]byte("abcd"), []byte("abce"), []byte("abcf"), []byte("abgd")}
 	expectedSerializedSize := 0
 	for i := range keys {
-		at, _, _ = at.Insert(keys[i], internal.Item{FileID: i, Offset: int64(i), Size: int64(i)})
+		at = at.Insert(keys[i], internal.Item{FileID: i, Offset: int64(i), Size: int64(i)})
 		expectedSerializedSize += int32Size + len(keys[i]) + fileIDSize + offsetSize + sizeSize
 	}
 
@@ -2,52 +2,139 @@
 package index
 
 import (
+	"bufio"
+	"bytes"
+	"hash/crc32"
+	"io"
 	"os"
 
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
-	"go.mills.io/bitcask/v2/internal"
+	"github.com/pkg/errors"
+	"go.mills.io/bitcask/v2/internal/keydir"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
-// Indexer is an interface for loading and saving the index (an Adaptive Radix Tree)
-type Indexer[T any] interface {
-	Load(path string, maxKeySize uint32) (*iradix.Tree[T], error)
-	Save(t *iradix.Tree[T], path string) error
+// Indexer is an interface for loading and saving the index (the keydir),
+// Load loads the index into the given empty keydir
+type Indexer interface {
+	Load(path string, maxKeySize uint32, kd keydir.Keydir) (keydir.Keydir, error)
+	Save(kd keydir.View, path string, perm os.FileMode) error
 }
 
+// Format is the on-disk format indexes are saved in, indexes in any format
+// are loaded
+type Format string
+
+const (
+	// FormatStream is the default format, a stream of key and item records
+	FormatStream Format = "stream"
+
+	// FormatBlock is a sorted block-structured format with prefix compressed
+	// keys which is faster to load and save
+	FormatBlock Format = "block"
+)
+
+// ErrUnknownFormat is the error returned for an unknown index format
+var ErrUnknownFormat = errors.New("unknown index format")
+
 // NewIndexer returns an instance of the default `Indexer` implementation
 // which persists the index (an Adaptive Radix Tree) as a binary blob on file
-func NewIndexer() Indexer[internal.Item] {
-	return &indexer{}
+func NewIndexer() Indexer {
+	return NewIndexerWithFS(vfs.OS)
+}
+
+// NewIndexerWithFS returns an instance of the default `Indexer`
+// implementation saving the index to the given filesystem
+func NewIndexerWithFS(fs vfs.FS) Indexer {
+	return &indexer{fs: fs, format: FormatStream}
 }
 
-type indexer struct{}
+// NewIndexerWithFormat returns an `Indexer` saving the index in the given
+// format to the given filesystem, the empty format is FormatStream
+func NewIndexerWithFormat(fs vfs.FS, format Format) (Indexer, error) {
+	switch format {
+	case "":
+		format = FormatStream
+	case FormatStream, FormatBlock:
+	default:
+		return nil, errors.Wrap(ErrUnknownFormat, string(format))
+	}
+	return &indexer{fs: fs, format: format}, nil
+}
 
-func (i *indexer) Load(path string, maxKeySize uint32) (*iradix.Tree[internal.Item], error) {
-	t := iradix.New[internal.Item]()
+type indexer struct {
+	fs     vfs.FS
+	format Format
+}
 
-	f, err := os.Open(path)
+func (i *indexer) Load(path string, maxKeySize uint32, t keydir.Keydir) (keydir.Keydir, error) {
+	data, err := vfs.ReadFile(i.fs, path)
 	if err != nil {
 		return t, err
 	}
-	defer f.Close()
 
-	t, err = readIndex(f, t, maxKeySize)
+	if isBlockIndex(data) {
+		return readBlocks(data, t, maxKeySize)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	version, err := readHeader(r)
+	if err != nil {
+		return t, err
+	}
+
+	// Don't load a torn index at all rather than partially
+	if version >= Version2 {
+		body, err := verifyTrailer(data)
+		if err != nil {
+			return t, err
+		}
+		r = bufio.NewReader(bytes.NewReader(body[headerSize:]))
+	}
+
+	t, err = readIndex(r, t, maxKeySize)
 	if err != nil {
 		return t, err
 	}
 	return t, nil
 }
 
-func (i *indexer) Save(t *iradix.Tree[internal.Item], path string) error {
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+// Save atomically replaces the index at path with a file with the given
+// permissions so a crash while saving it leaves either the old or the new
+// index
+func (i *indexer) Save(t keydir.View, path string, perm os.FileMode) error {
+	f, err := vfs.CreateAtomic(i.fs, path, perm)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	if err := writeIndex(t, f); err != nil {
+	crc := crc32.New(castagnoli)
+	w := bufio.NewWriter(io.MultiWriter(f, crc))
+
+	if i.format == FormatBlock {
+		err = writeBlockHeader(w)
+		if err == nil {
+			err = writeBlocks(t, w)
+		}
+	} else {
+		err = writeHeader(w, CurrentVersion)
+		if err == nil {
+			err = writeIndex(t, w)
+		}
+	}
+	if err != nil {
+		f.Abort()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Abort()
+		return err
+	}
+
+	if err := writeTrailer(f, crc.Sum32()); err != nil {
+		f.Abort()
 		return err
 	}
 
-	return f.Close()
+	return f.Commit()
 }
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+func TestSaveLoad(t *testing.T) {
+	at, _ := getSampleTree()
+	fn := filepath.Join(t.TempDir(), "index")
+
+	indexer := NewIndexer()
+	require.NoError(t, indexer.Save(at, fn, 0600))
+	tmps, err := filepath.Glob(fn + ".*.tmp")
+	require.NoError(t, err)
+	assert.Empty(t, tmps)
+
+	loaded, err := indexer.Load(fn, 1024, emptyKeydir())
+	require.NoError(t, err)
+	assert.Equal(t, at.Len(), loaded.Len())
+
+	t.Run("Version1", func(t *testing.T) {
+		// Indexes without a trailer are still loaded
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		data = data[:len(data)-trailerSize]
+		data[headerSize-1] = Version1
+		require.NoError(t, os.WriteFile(fn+".v1", data, 0600))
+
+		loaded, err := indexer.Load(fn+".v1", 1024, emptyKeydir())
+		require.NoError(t, err)
+		assert.Equal(t, at.Len(), loaded.Len())
+	})
+
+	t.Run("Torn", func(t *testing.T) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+
+		// A torn index is never partially loaded
+		for n := headerSize; n < len(data); n++ {
+			require.NoError(t, os.WriteFile(fn+".torn", data[:n], 0600))
+
+			loaded, err := indexer.Load(fn+".torn", 1024, emptyKeydir())
+			assert.True(t, IsIndexCorruption(err), "torn at %d: %v", n, err)
+			assert.Equal(t, 0, loaded.Len())
+		}
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		data[headerSize+4] ^= 0xff
+		require.NoError(t, os.WriteFile(fn+".corrupt", data, 0600))
+
+		loaded, err := indexer.Load(fn+".corrupt", 1024, emptyKeydir())
+		assert.ErrorIs(t, err, errChecksumFailed)
+		assert.Equal(t, 0, loaded.Len())
+	})
+	t.Run("WriteFault", func(t *testing.T) {
+		// An index failing to be written is never saved
+		for _, format := range []Format{FormatStream, FormatBlock} {
+			mem := vfs.NewMemFS()
+			fs := vfs.NewFaultFS(mem, vfs.FailOn(vfs.OpWrite, "index.*.tmp", vfs.Fail))
+			indexer, err := NewIndexerWithFormat(fs, format)
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, indexer.Save(at, "index", 0600), vfs.ErrInjected)
+			assert.False(t, vfs.Exists(mem, "index"))
+		}
+	})
+}
@@ -8,3 +8,22 @@ type Item struct {
 	Offset int64 `json:"offset"`
 	Size   int64 `json:"size"`
 }
+
+// PackedItem is an Item packed into 16 bytes for compact keydirs, it holds
+// file IDs up to 2^31-1 and sizes up to 4GiB
+type PackedItem struct {
+	Offset uint64
+	FileID uint32
+	Size   uint32
+}
+
+// Pack returns the item packed
+func (i Item) Pack() PackedItem {
+	return PackedItem{Offset: uint64(i.Offset), FileID: uint32(i.FileID), Size: uint32(i.Size)}
+}
+
+// Unpack returns the packed item
+func (p PackedItem) Unpack() Item {
+	// File IDs are signed so the negative IDs of in-memory datafiles survive
+	return Item{FileID: int(int32(p.FileID)), Offset: int64(p.Offset), Size: int64(p.Size)}
+}
@@ -0,0 +1,196 @@
+package keydir
+
+import (
+	"hash/maphash"
+	"sync"
+
+	"go.mills.io/bitcask/v2/internal"
+)
+
+// shards is the number of shards of a hashed keydir, writers only block
+// readers of the same shard
+const shards = 256
+
+// hashed is an unordered keydir of sharded hash maps of packed items
+type hashed struct {
+	seed   maphash.Seed
+	shards [shards]shard
+}
+
+type shard struct {
+	sync.RWMutex
+	items map[string]internal.PackedItem
+}
+
+func newHashed() *hashed {
+	h := &hashed{seed: maphash.MakeSeed()}
+	for i := range h.shards {
+		h.shards[i].items = make(map[string]internal.PackedItem)
+	}
+	return h
+}
+
+func (h *hashed) shard(key []byte) *shard {
+	return &h.shards[maphash.Bytes(h.seed, key)%shards]
+}
+
+func (h *hashed) Len() int {
+	n := 0
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.RLock()
+		n += len(s.items)
+		s.RUnlock()
+	}
+	return n
+}
+
+func (h *hashed) Get(key []byte) (internal.Item, bool) {
+	s := h.shard(key)
+	s.RLock()
+	defer s.RUnlock()
+
+	p, found := s.items[string(key)]
+	if !found {
+		return internal.Item{}, false
+	}
+	return p.Unpack(), true
+}
+
+// Walk calls fn for the keys of one shard after the other in no particular
+// order. Every shard is copied first so fn may use the keydir, changes made
+// while walking may or may not be seen.
+func (h *hashed) Walk(fn WalkFn) {
+	type entry struct {
+		key  string
+		item internal.PackedItem
+	}
+
+	var entries []entry
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.RLock()
+		entries = entries[:0]
+		for key, p := range s.items {
+			entries = append(entries, entry{key, p})
+		}
+		s.RUnlock()
+
+		for _, e := range entries {
+			if fn([]byte(e.key), e.item.Unpack()) {
+				return
+			}
+		}
+	}
+}
+
+func (h *hashed) Insert(key []byte, item internal.Item) Keydir {
+	s := h.shard(key)
+	s.Lock()
+	s.items[string(key)] = item.Pack()
+	s.Unlock()
+	return h
+}
+
+func (h *hashed) Delete(key []byte) Keydir {
+	s := h.shard(key)
+	s.Lock()
+	delete(s.items, string(key))
+	s.Unlock()
+	return h
+}
+
+func (h *hashed) Txn() Txn {
+	return &hashedTxn{h: h, writes: make(map[string]*internal.Item)}
+}
+
+// hashedTxn is a transaction of a hashed keydir keeping its changes apart
+// from the keydir, a nil item is a deleted key
+type hashedTxn struct {
+	h      *hashed
+	writes map[string]*internal.Item
+}
+
+func (t *hashedTxn) Len() int {
+	n := t.h.Len()
+	for key, item := range t.writes {
+		_, found := t.h.Get([]byte(key))
+		switch {
+		case item == nil && found:
+			n--
+		case item != nil && !found:
+			n++
+		}
+	}
+	return n
+}
+
+func (t *hashedTxn) Get(key []byte) (internal.Item, bool) {
+	if item, ok := t.writes[string(key)]; ok {
+		if item == nil {
+			return internal.Item{}, false
+		}
+		return *item, true
+	}
+	return t.h.Get(key)
+}
+
+func (t *hashedTxn) Walk(fn WalkFn) {
+	stopped := false
+	t.h.Walk(func(key []byte, item internal.Item) bool {
+		if _, ok := t.writes[string(key)]; ok {
+			return false
+		}
+		stopped = fn(key, item)
+		return stopped
+	})
+	if stopped {
+		return
+	}
+	for key, item := range t.writes {
+		if item != nil && fn([]byte(key), *item) {
+			return
+		}
+	}
+}
+
+func (t *hashedTxn) Insert(key []byte, item internal.Item) {
+	t.writes[string(key)] = &item
+}
+
+func (t *hashedTxn) Delete(key []byte) {
+	t.writes[string(key)] = nil
+}
+
+// load inserts the keys into a new keydir so h is left unchanged on errors
+func (h *hashed) load(fn func(w Writer) error) (Keydir, error) {
+	n := newHashed()
+	n.seed = h.seed
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.RLock()
+		for key, p := range s.items {
+			n.shards[i].items[key] = p
+		}
+		s.RUnlock()
+	}
+
+	if err := fn(hashedWriter{n}); err != nil {
+		return h, err
+	}
+	return n, nil
+}
+
+// hashedWriter is a Writer of a hashed keydir not shared yet, which doesn't
+// need locking
+type hashedWriter struct {
+	h *hashed
+}
+
+func (w hashedWriter) Insert(key []byte, item internal.Item) {
+	w.h.shards[maphash.Bytes(w.h.seed, key)%shards].items[string(key)] = item.Pack()
+}
+
+func (w hashedWriter) Delete(key []byte) {
+	delete(w.h.shards[maphash.Bytes(w.h.seed, key)%shards].items, string(key))
+}
@@ -0,0 +1,142 @@
+// Package keydir implements the in-memory keydir mapping every key to the
+// location of its latest value on disk
+package keydir
+
+import (
+	"github.com/pkg/errors"
+	"go.mills.io/bitcask/v2/internal"
+)
+
+// Mode selects the implementation of a keydir
+type Mode string
+
+const (
+	// ModeRadix is the default, an ordered radix tree of items
+	ModeRadix Mode = "radix"
+
+	// ModePacked is an ordered radix tree of packed items
+	ModePacked Mode = "packed"
+
+	// ModeHashed is an unordered hash map of packed items, using much less
+	// memory than a radix tree
+	ModeHashed Mode = "hashed"
+)
+
+// ErrUnknownMode is the error returned for an unknown keydir mode
+var ErrUnknownMode = errors.New("unknown keydir mode")
+
+// WalkFn is called for the keys of a keydir, returning true stops the walk
+type WalkFn func(key []byte, item internal.Item) bool
+
+// View is a read-only view of a keydir
+type View interface {
+	// Len returns the number of keys
+	Len() int
+
+	// Get returns the item of a key
+	Get(key []byte) (internal.Item, bool)
+
+	// Walk calls fn for every key, in key order if the keydir is Ordered
+	Walk(fn WalkFn)
+}
+
+// Keydir maps keys to the location of their latest value on disk. Ordered
+// keydirs are immutable snapshots, changing them returns a new keydir. The
+// hashed keydir is changed in place and is safe for concurrent use.
+type Keydir interface {
+	View
+
+	// Insert sets the item of a key and returns the changed keydir
+	Insert(key []byte, item internal.Item) Keydir
+
+	// Delete deletes a key and returns the changed keydir
+	Delete(key []byte) Keydir
+
+	// Txn starts a transaction whose changes are only visible to itself.
+	// The transaction of an ordered keydir reads from a snapshot, the one
+	// of the hashed keydir reads the latest state of the keydir.
+	Txn() Txn
+}
+
+// Txn is a transaction of a keydir
+type Txn interface {
+	View
+
+	// Insert sets the item of a key
+	Insert(key []byte, item internal.Item)
+
+	// Delete deletes a key
+	Delete(key []byte)
+}
+
+// Ordered is implemented by keydirs and transactions keeping their keys in
+// order
+type Ordered interface {
+	// WalkPrefix calls fn for every key starting with prefix in key order
+	WalkPrefix(prefix []byte, fn WalkFn)
+
+	// Iterator returns an iterator over the keys in key order, or reverse
+	// key order
+	Iterator(reverse bool) Iterator
+}
+
+// Iterator iterates over the keys of an ordered keydir
+type Iterator interface {
+	// Next returns the next key and its item, ok is false at the end
+	Next() (key []byte, item internal.Item, ok bool)
+
+	// SeekPrefix moves the iterator to the keys starting with prefix
+	SeekPrefix(prefix []byte)
+}
+
+// New returns an empty keydir of the given mode, the empty mode is
+// ModeRadix
+func New(mode Mode) (Keydir, error) {
+	switch mode {
+	case "", ModeRadix:
+		return newTree(itemCodec), nil
+	case ModePacked:
+		return newTree(packedCodec), nil
+	case ModeHashed:
+		return newHashed(), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownMode, string(mode))
+	}
+}
+
+// Writer inserts and deletes the keys of a keydir being loaded
+type Writer interface {
+	Insert(key []byte, item internal.Item)
+	Delete(key []byte)
+}
+
+// Load applies the inserts and deletes of fn to kd in bulk, which is faster
+// than applying them one by one, and returns the resulting keydir
+func Load(kd Keydir, fn func(w Writer) error) (Keydir, error) {
+	switch kd := kd.(type) {
+	case bulkLoader:
+		return kd.load(fn)
+	default:
+		w := &keydirWriter{kd}
+		err := fn(w)
+		return w.kd, err
+	}
+}
+
+// bulkLoader is implemented by keydirs that load keys faster in bulk
+type bulkLoader interface {
+	load(fn func(w Writer) error) (Keydir, error)
+}
+
+// keydirWriter is a Writer applying changes to a keydir one by one
+type keydirWriter struct {
+	kd Keydir
+}
+
+func (w *keydirWriter) Insert(key []byte, item internal.Item) {
+	w.kd = w.kd.Insert(key, item)
+}
+
+func (w *keydirWriter) Delete(key []byte) {
+	w.kd = w.kd.Delete(key)
+}
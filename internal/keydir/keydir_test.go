@@ -0,0 +1,183 @@
+package keydir
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mills.io/bitcask/v2/internal"
+)
+
+var benchKeys = flag.Int("keydir.keys", 1000000, "number of keys of keydir benchmarks")
+
+var modes = []Mode{ModeRadix, ModePacked, ModeHashed}
+
+func item(i int) internal.Item {
+	return internal.Item{FileID: i % 7, Offset: int64(i) * 100, Size: int64(i + 1)}
+}
+
+func keys(v View) []string {
+	var keys []string
+	v.Walk(func(key []byte, item internal.Item) bool {
+		keys = append(keys, string(key))
+		return false
+	})
+	return keys
+}
+
+func TestPackedItem(t *testing.T) {
+	for _, item := range []internal.Item{
+		{FileID: 0, Offset: 0, Size: 0},
+		{FileID: 1<<31 - 1, Offset: 1 << 40, Size: 1<<32 - 1},
+		{FileID: -1, Offset: 42, Size: 7},
+	} {
+		assert.Equal(t, item, item.Pack().Unpack())
+	}
+}
+
+func TestKeydir(t *testing.T) {
+	for _, mode := range modes {
+		t.Run(string(mode), func(t *testing.T) {
+			kd, err := New(mode)
+			require.NoError(t, err)
+
+			for i := 9; i >= 0; i-- {
+				kd = kd.Insert([]byte(fmt.Sprintf("foo%d", i)), item(i))
+			}
+			kd = kd.Delete([]byte("foo0"))
+			kd = kd.Delete([]byte("bar"))
+			assert.Equal(t, 9, kd.Len())
+
+			got, found := kd.Get([]byte("foo3"))
+			assert.True(t, found)
+			assert.Equal(t, item(3), got)
+			_, found = kd.Get([]byte("foo0"))
+			assert.False(t, found)
+
+			walked := keys(kd)
+			assert.Len(t, walked, 9)
+			_, ordered := kd.(Ordered)
+			assert.Equal(t, mode != ModeHashed, ordered)
+			if ordered {
+				assert.True(t, sort.StringsAreSorted(walked))
+			}
+
+			t.Run("Txn", func(t *testing.T) {
+				txn := kd.Txn()
+				txn.Insert([]byte("foo0"), item(0))
+				txn.Insert([]byte("foo1"), item(100))
+				txn.Delete([]byte("foo2"))
+				assert.Equal(t, 9, txn.Len())
+				assert.Len(t, keys(txn), 9)
+
+				got, found := txn.Get([]byte("foo1"))
+				assert.True(t, found)
+				assert.Equal(t, item(100), got)
+				_, found = txn.Get([]byte("foo2"))
+				assert.False(t, found)
+
+				// Changes of a transaction are only visible to itself
+				got, _ = kd.Get([]byte("foo1"))
+				assert.Equal(t, item(1), got)
+				_, found = kd.Get([]byte("foo0"))
+				assert.False(t, found)
+
+				// Only the transactions of ordered keydirs are snapshots
+				kd = kd.Insert([]byte("foo10"), item(10))
+				_, found = txn.Get([]byte("foo10"))
+				assert.Equal(t, !ordered, found)
+				kd = kd.Delete([]byte("foo10"))
+			})
+
+			t.Run("Load", func(t *testing.T) {
+				empty, err := New(mode)
+				require.NoError(t, err)
+
+				loaded, err := Load(empty, func(w Writer) error {
+					kd.Walk(func(key []byte, item internal.Item) bool {
+						w.Insert(key, item)
+						return false
+					})
+					w.Insert([]byte("bar"), item(1))
+					w.Delete([]byte("bar"))
+					return nil
+				})
+				require.NoError(t, err)
+				assert.ElementsMatch(t, keys(kd), keys(loaded))
+
+				loaded, err = Load(empty, func(w Writer) error {
+					w.Insert([]byte("foo"), item(1))
+					return fmt.Errorf("error")
+				})
+				assert.Error(t, err)
+				assert.Equal(t, 0, loaded.Len())
+			})
+		})
+	}
+
+	t.Run("Ordered", func(t *testing.T) {
+		kd, err := New(ModePacked)
+		require.NoError(t, err)
+		for _, key := range []string{"b", "ab", "aa", "c"} {
+			kd = kd.Insert([]byte(key), item(1))
+		}
+
+		var prefixed []string
+		kd.(Ordered).WalkPrefix([]byte("a"), func(key []byte, item internal.Item) bool {
+			prefixed = append(prefixed, string(key))
+			return false
+		})
+		assert.Equal(t, []string{"aa", "ab"}, prefixed)
+
+		var reversed []string
+		it := kd.(Ordered).Iterator(true)
+		for key, _, ok := it.Next(); ok; key, _, ok = it.Next() {
+			reversed = append(reversed, string(key))
+		}
+		assert.Equal(t, []string{"c", "b", "ab", "aa"}, reversed)
+
+		it = kd.Txn().(Ordered).Iterator(false)
+		it.SeekPrefix([]byte("b"))
+		key, _, ok := it.Next()
+		assert.True(t, ok)
+		assert.Equal(t, "b", string(key))
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		_, err := New(Mode("foo"))
+		assert.ErrorIs(t, err, ErrUnknownMode)
+	})
+}
+
+// BenchmarkKeydir reports the memory used per key by each mode, run it with
+// -keydir.keys=10000000 for large keyspaces
+func BenchmarkKeydir(b *testing.B) {
+	for _, mode := range modes {
+		b.Run(string(mode), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				kd, err := New(mode)
+				require.NoError(b, err)
+				kd, err = Load(kd, func(w Writer) error {
+					for j := 0; j < *benchKeys; j++ {
+						w.Insert([]byte(fmt.Sprintf("user:%012d:profile", j)), internal.Item{FileID: j / 100000, Offset: int64(j) * 64, Size: 64})
+					}
+					return nil
+				})
+				require.NoError(b, err)
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(kd.Len()), "bytes/key")
+				runtime.KeepAlive(kd)
+			}
+		})
+	}
+}
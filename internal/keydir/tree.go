@@ -0,0 +1,147 @@
+package keydir
+
+import (
+	iradix "github.com/hashicorp/go-immutable-radix/v2"
+	"go.mills.io/bitcask/v2/internal"
+)
+
+// codec converts items to and from the values stored in a tree
+type codec[T any] struct {
+	encode func(internal.Item) T
+	decode func(T) internal.Item
+}
+
+var (
+	itemCodec = codec[internal.Item]{
+		encode: func(item internal.Item) internal.Item { return item },
+		decode: func(item internal.Item) internal.Item { return item },
+	}
+
+	packedCodec = codec[internal.PackedItem]{
+		encode: internal.Item.Pack,
+		decode: internal.PackedItem.Unpack,
+	}
+)
+
+// tree is an ordered keydir of a radix tree
+type tree[T any] struct {
+	t     *iradix.Tree[T]
+	codec codec[T]
+}
+
+func newTree[T any](codec codec[T]) *tree[T] {
+	return &tree[T]{t: iradix.New[T](), codec: codec}
+}
+
+func (t *tree[T]) Len() int { return t.t.Len() }
+
+func (t *tree[T]) Get(key []byte) (internal.Item, bool) {
+	return get(t.t.Root(), t.codec, key)
+}
+
+func (t *tree[T]) Walk(fn WalkFn) { walk(t.t.Root(), t.codec, nil, fn) }
+
+func (t *tree[T]) WalkPrefix(prefix []byte, fn WalkFn) { walk(t.t.Root(), t.codec, prefix, fn) }
+
+func (t *tree[T]) Iterator(reverse bool) Iterator { return iterator(t.t.Root(), t.codec, reverse) }
+
+func (t *tree[T]) Insert(key []byte, item internal.Item) Keydir {
+	n, _, _ := t.t.Insert(key, t.codec.encode(item))
+	return &tree[T]{t: n, codec: t.codec}
+}
+
+func (t *tree[T]) Delete(key []byte) Keydir {
+	n, _, _ := t.t.Delete(key)
+	return &tree[T]{t: n, codec: t.codec}
+}
+
+func (t *tree[T]) Txn() Txn {
+	return &treeTxn[T]{txn: t.t.Txn(), codec: t.codec}
+}
+
+func (t *tree[T]) load(fn func(w Writer) error) (Keydir, error) {
+	txn := &treeTxn[T]{txn: t.t.Txn(), codec: t.codec}
+	if err := fn(txn); err != nil {
+		return t, err
+	}
+	return &tree[T]{t: txn.txn.Commit(), codec: t.codec}, nil
+}
+
+// treeTxn is a transaction of a tree
+type treeTxn[T any] struct {
+	txn   *iradix.Txn[T]
+	codec codec[T]
+}
+
+func (t *treeTxn[T]) Len() int {
+	// CommitOnly doesn't end the transaction, it only snapshots the current
+	// state of the tree which is what we need for its size.
+	return t.txn.CommitOnly().Len()
+}
+
+func (t *treeTxn[T]) Get(key []byte) (internal.Item, bool) {
+	return get(t.txn.Root(), t.codec, key)
+}
+
+func (t *treeTxn[T]) Walk(fn WalkFn) { walk(t.txn.Root(), t.codec, nil, fn) }
+
+func (t *treeTxn[T]) WalkPrefix(prefix []byte, fn WalkFn) { walk(t.txn.Root(), t.codec, prefix, fn) }
+
+func (t *treeTxn[T]) Iterator(reverse bool) Iterator {
+	return iterator(t.txn.Root(), t.codec, reverse)
+}
+
+func (t *treeTxn[T]) Insert(key []byte, item internal.Item) {
+	t.txn.Insert(key, t.codec.encode(item))
+}
+
+func (t *treeTxn[T]) Delete(key []byte) { t.txn.Delete(key) }
+
+func get[T any](n *iradix.Node[T], codec codec[T], key []byte) (internal.Item, bool) {
+	v, found := n.Get(key)
+	if !found {
+		return internal.Item{}, false
+	}
+	return codec.decode(v), true
+}
+
+func walk[T any](n *iradix.Node[T], codec codec[T], prefix []byte, fn WalkFn) {
+	n.WalkPrefix(prefix, func(key []byte, v T) bool {
+		return fn(key, codec.decode(v))
+	})
+}
+
+func iterator[T any](n *iradix.Node[T], codec codec[T], reverse bool) Iterator {
+	if reverse {
+		return &treeIterator[T]{next: n.ReverseIterator(), codec: codec}
+	}
+	return &treeIterator[T]{next: n.Iterator(), codec: codec}
+}
+
+// treeIterator is an iterator of a tree in either direction
+type treeIterator[T any] struct {
+	next interface {
+		SeekPrefix(prefix []byte)
+	}
+	codec codec[T]
+}
+
+func (it *treeIterator[T]) Next() ([]byte, internal.Item, bool) {
+	var (
+		key []byte
+		v   T
+		ok  bool
+	)
+	switch next := it.next.(type) {
+	case *iradix.Iterator[T]:
+		key, v, ok = next.Next()
+	case *iradix.ReverseIterator[T]:
+		key, v, ok = next.Previous()
+	}
+	if !ok {
+		return nil, internal.Item{}, false
+	}
+	return key, it.codec.decode(v), true
+}
+
+func (it *treeIterator[T]) SeekPrefix(prefix []byte) { it.next.SeekPrefix(prefix) }
@@ -4,19 +4,24 @@ import (
 	"os"
 
 	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 type MetaData struct {
 	IndexUpToDate    bool  `json:"index_up_to_date"`
 	ReclaimableSpace int64 `json:"reclaimable_space"`
+
+	// Version is the format version of the database, all datafiles and the
+	// index are in this format or newer
+	Version int `json:"version"`
 }
 
-func (m *MetaData) Save(path string, mode os.FileMode) error {
-	return internal.SaveJSONToFile(m, path, mode)
+func (m *MetaData) Save(fs vfs.FS, path string, mode os.FileMode) error {
+	return internal.SaveJSONToFile(fs, m, path, mode)
 }
 
-func Load(path string) (*MetaData, error) {
+func Load(fs vfs.FS, path string) (*MetaData, error) {
 	var m MetaData
-	err := internal.LoadFromJSONFile(path, &m)
+	err := internal.LoadFromJSONFile(fs, path, &m)
 	return &m, err
 }
@@ -2,46 +2,66 @@ package internal
 
 import (
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+
+	"go.mills.io/bitcask/v2/vfs"
 )
 
-// Exists returns `true` if the given `path` on the current file system exists
-func Exists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
+// Exists returns `true` if the given `path` on the file system exists
+func Exists(fs vfs.FS, path string) bool {
+	return vfs.Exists(fs, path)
 }
 
-// DirSize returns the space occupied by the given `path` on disk on the current
-// file system.
-func DirSize(path string) (int64, error) {
+// DirSize returns the space occupied by the given `path` on the file system
+func DirSize(fs vfs.FS, path string) (int64, error) {
+	entries, err := fs.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+
 	var size int64
-	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, entry := range entries {
+		if entry.IsDir() {
+			n, err := DirSize(fs, filepath.Join(path, entry.Name()))
+			if err != nil {
+				return 0, err
+			}
+			size += n
+			continue
 		}
-		if !info.IsDir() {
-			size += info.Size()
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
 		}
-		return err
-	})
-	return size, err
+		size += info.Size()
+	}
+	return size, nil
 }
 
 // GetDatafiles returns a list of all data files stored in the database path
 // given by `path`. All datafiles are identified by the the glob `*.data` and
 // the basename is represented by a monotonic increasing integer.
 // The returned files are *sorted* in increasing order.
-func GetDatafiles(path string) ([]string, error) {
-	fns, err := filepath.Glob(fmt.Sprintf("%s/*.data", path))
+func GetDatafiles(fs vfs.FS, path string) ([]string, error) {
+	entries, err := fs.ReadDir(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
+
+	var fns []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".data" {
+			continue
+		}
+		fns = append(fns, filepath.Join(path, entry.Name()))
+	}
 	sort.Strings(fns)
 	return fns, nil
 }
@@ -66,45 +86,80 @@ func ParseIds(fns []string) ([]int, error) {
 	return ids, nil
 }
 
-// Copy copies source contents to destination
-func Copy(src, dst string, exclude []string) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		relPath := strings.Replace(path, src, "", 1)
-		if relPath == "" {
-			return nil
-		}
+// Copy copies source contents of srcFS to destination of dstFS
+func Copy(srcFS vfs.FS, src string, dstFS vfs.FS, dst string, exclude []string) error {
+	entries, err := srcFS.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		excluded := false
 		for _, e := range exclude {
-			matched, err := filepath.Match(e, info.Name())
+			matched, err := filepath.Match(e, entry.Name())
 			if err != nil {
 				return err
 			}
-			if matched {
-				return nil
+			excluded = excluded || matched
+		}
+		if excluded {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		srcPath, dstPath := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		if entry.IsDir() {
+			if err := dstFS.Mkdir(dstPath, info.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := Copy(srcFS, srcPath, dstFS, dstPath, exclude); err != nil {
+				return err
 			}
+			continue
 		}
-		if info.IsDir() {
-			return os.Mkdir(filepath.Join(dst, relPath), info.Mode())
+		data, err := vfs.ReadFile(srcFS, srcPath)
+		if err != nil {
+			return err
 		}
-		var data, err1 = os.ReadFile(filepath.Join(src, relPath))
-		if err1 != nil {
-			return err1
+		if err := writeFile(dstFS, dstPath, data, info.Mode().Perm()); err != nil {
+			return err
 		}
-		return ioutil.WriteFile(filepath.Join(dst, relPath), data, info.Mode())
-	})
+	}
+	return nil
+}
+
+func writeFile(fs vfs.FS, path string, data []byte, perm os.FileMode) error {
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
-// SaveJSONToFile converts v into json and store in file identified by path
-func SaveJSONToFile(v interface{}, path string, mode os.FileMode) error {
+// SaveJSONToFile converts v into json and atomically stores it in the file
+// identified by path
+func SaveJSONToFile(fs vfs.FS, v interface{}, path string, mode os.FileMode) error {
 	b, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, mode)
+	return vfs.WriteFile(fs, path, b, mode)
 }
 
 // LoadFromJSONFile reads file located at `path` and put its content in json format in v
-func LoadFromJSONFile(path string, v interface{}) error {
-	b, err := os.ReadFile(path)
+func LoadFromJSONFile(fs vfs.FS, path string, v interface{}) error {
+	b, err := vfs.ReadFile(fs, path)
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 func Test_SaveAndLoad(t *testing.T) {
@@ -17,10 +19,10 @@ func Test_SaveAndLoad(t *testing.T) {
 			Value bool `json:"value"`
 		}
 		m := test{Value: true}
-		err = SaveJSONToFile(&m, filepath.Join(tempDir, "meta.json"), os.FileMode(0644))
+		err = SaveJSONToFile(vfs.OS, &m, filepath.Join(tempDir, "meta.json"), os.FileMode(0644))
 		assert.NoError(t, err)
 		m1 := test{}
-		err = LoadFromJSONFile(filepath.Join(tempDir, "meta.json"), &m1)
+		err = LoadFromJSONFile(vfs.OS, filepath.Join(tempDir, "meta.json"), &m1)
 		assert.NoError(t, err)
 		assert.Equal(t, m, m1)
 	})
@@ -32,10 +34,10 @@ func Test_SaveAndLoad(t *testing.T) {
 		type test struct {
 			Value bool `json:"value"`
 		}
-		err = SaveJSONToFile(make(chan int), filepath.Join(tempDir, "meta.json"), os.FileMode(644))
+		err = SaveJSONToFile(vfs.OS, make(chan int), filepath.Join(tempDir, "meta.json"), os.FileMode(644))
 		assert.Error(t, err)
 		m1 := test{}
-		err = LoadFromJSONFile(filepath.Join(tempDir, "meta.json"), &m1)
+		err = LoadFromJSONFile(vfs.OS, filepath.Join(tempDir, "meta.json"), &m1)
 		assert.Error(t, err)
 	})
 }
@@ -3,8 +3,7 @@ package bitcask
 import (
 	"errors"
 
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
-	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/keydir"
 )
 
 var (
@@ -31,32 +30,40 @@ func Reverse() IteratorOption {
 
 type iterator struct {
 	keys Keys
-	itf  *iradix.Iterator[internal.Item]
-	itr  *iradix.ReverseIterator[internal.Item]
+	it   keydir.Iterator
+	err  error
 	opts *iteratorOptions
 }
 
+// newIterator returns an iterator over the keys of the keydir view reading
+// values from keys
+func newIterator(keys Keys, view keydir.View, opts ...IteratorOption) Iterator {
+	it := &iterator{keys: keys, opts: &iteratorOptions{}}
+	for _, opt := range opts {
+		opt(it)
+	}
+	if o, ok := view.(keydir.Ordered); ok {
+		it.it = o.Iterator(it.opts.reverse)
+	} else {
+		it.err = ErrUnordered
+	}
+	return it
+}
+
 func (it *iterator) Close() error {
-	if it.itf == nil && it.itr == nil {
+	if it.it == nil {
 		return ErrIteratorClosed
 	}
-	it.itf = nil
-	it.itr = nil
+	it.it = nil
 	return nil
 }
 
 func (it *iterator) Next() (*Item, error) {
-	var (
-		key  []byte
-		more bool
-	)
-
-	if it.opts.reverse {
-		key, _, more = it.itr.Previous()
-	} else {
-		key, _, more = it.itf.Next()
+	if it.err != nil {
+		return nil, it.err
 	}
 
+	key, _, more := it.it.Next()
 	if !more {
 		defer it.Close()
 		return nil, ErrStopIteration
@@ -70,24 +77,15 @@ func (it *iterator) Next() (*Item, error) {
 }
 
 func (it *iterator) SeekPrefix(prefix Key) (*Item, error) {
-	if it.opts.reverse {
-		it.itr.SeekPrefix(prefix)
-	} else {
-		it.itf.SeekPrefix(prefix)
+	if it.err != nil {
+		return nil, it.err
 	}
+
+	it.it.SeekPrefix(prefix)
 	return it.Next()
 }
 
 // Iterator returns an iterator for iterating through keys in key order
 func (b *bitcask) Iterator(opts ...IteratorOption) Iterator {
-	it := &iterator{keys: b, opts: &iteratorOptions{}}
-	for _, opt := range opts {
-		opt(it)
-	}
-	if it.opts.reverse {
-		it.itr = b.trie.Root().ReverseIterator()
-	} else {
-		it.itf = b.trie.Root().Iterator()
-	}
-	return it
+	return newIterator(b, b.state.Load().trie, opts...)
 }
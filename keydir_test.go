@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeydir(t *testing.T) {
+	for _, mode := range []string{KeydirPacked, KeydirHashed} {
+		t.Run(mode, func(t *testing.T) {
+			testDir, err := os.MkdirTemp("", "bitcask")
+			require.NoError(t, err)
+			defer os.RemoveAll(testDir)
+
+			db, err := Open(testDir, WithKeydir(mode), WithMaxDatafileSize(128))
+			require.NoError(t, err)
+
+			for i := 0; i < 20; i++ {
+				require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i%5)), Value(fmt.Sprintf("bar%d", i))))
+			}
+			require.NoError(t, db.Delete(Key("foo0")))
+			assert.Equal(t, 4, db.Len())
+
+			val, err := db.Get(Key("foo4"))
+			require.NoError(t, err)
+			assert.Equal(t, Value("bar19"), val)
+			assert.False(t, db.Has(Key("foo0")))
+
+			var keys []string
+			require.NoError(t, db.ForEach(func(key Key) error {
+				keys = append(keys, string(key))
+				return nil
+			}))
+			assert.ElementsMatch(t, []string{"foo1", "foo2", "foo3", "foo4"}, keys)
+
+			t.Run("Transaction", func(t *testing.T) {
+				tx := db.Transaction()
+				require.NoError(t, tx.Put(Key("hello"), Value("world")))
+				require.NoError(t, tx.Delete(Key("foo1")))
+				assert.Equal(t, 4, tx.Len())
+
+				val, err := tx.Get(Key("foo2"))
+				require.NoError(t, err)
+				assert.Equal(t, Value("bar17"), val)
+				assert.False(t, db.Has(Key("hello")))
+
+				require.NoError(t, tx.Commit())
+				assert.True(t, db.Has(Key("hello")))
+				assert.False(t, db.Has(Key("foo1")))
+			})
+
+			t.Run("Merge", func(t *testing.T) {
+				require.NoError(t, db.Merge())
+
+				val, err := db.Get(Key("foo3"))
+				require.NoError(t, err)
+				assert.Equal(t, Value("bar18"), val)
+			})
+
+			t.Run("Reopen", func(t *testing.T) {
+				require.NoError(t, db.Close())
+
+				db, err = Open(testDir, WithKeydir(mode))
+				require.NoError(t, err)
+				assert.Equal(t, 4, db.Len())
+
+				val, err := db.Get(Key("hello"))
+				require.NoError(t, err)
+				assert.Equal(t, Value("world"), val)
+			})
+
+			t.Run("Ordered", func(t *testing.T) {
+				scanErr := db.Scan(Key("foo"), func(key Key) error { return nil })
+				rangeErr := db.Range(Key("foo1"), Key("foo3"), func(key Key) error { return nil })
+				_, nextErr := db.Iterator().Next()
+
+				if mode == KeydirHashed {
+					assert.ErrorIs(t, scanErr, ErrUnordered)
+					assert.ErrorIs(t, rangeErr, ErrUnordered)
+					assert.ErrorIs(t, nextErr, ErrUnordered)
+				} else {
+					assert.NoError(t, scanErr)
+					assert.NoError(t, rangeErr)
+					assert.NoError(t, nextErr)
+				}
+			})
+
+			require.NoError(t, db.Close())
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "bitcask")
+		require.NoError(t, err)
+		defer os.RemoveAll(testDir)
+
+		_, err = Open(testDir, WithKeydir("foo"))
+		assert.ErrorIs(t, err, ErrInvalidKeydir)
+
+		// Packed items can't hold the size of every entry
+		_, err = Open(testDir, WithKeydir(KeydirPacked), WithMaxValueSize(1<<32))
+		assert.ErrorIs(t, err, ErrInvalidKeydir)
+	})
+}
@@ -2,6 +2,7 @@ package bitcask
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 )
 
@@ -10,12 +11,12 @@ func (b *bitcask) List(key Key) *List {
 }
 
 // List ...
-// +key,l = ""
+// +key,l = left and right index
 // l[key]0 = "a"
 // l[key]1 = "b"
 // l[key]2 = "c"
 type List struct {
-	db  DB
+	db  store
 	key Key
 }
 
@@ -42,29 +43,20 @@ func (l *List) Range(start, stop int64, fn func(i int64, value []byte, quit *boo
 	if stop == -1 {
 		stop = (y - x + 1) - 1 // (size) - 1
 	}
-	min := l.indexKey(x + int64(start))
-	max := l.indexKey(x + int64(stop))
-	var i int64 // 0
-	ErrStopIteration := errors.New("err: stop iteration")
-	err = l.db.Scan(min, func(key Key) error {
-		if key != nil && bytes.Compare(key, max) <= 0 {
-			val, err := l.db.Get(key)
-			if err != nil {
-				return err
-			}
-			quit := false
-			if fn(start+i, val, &quit); quit {
-				return ErrStopIteration
-			}
-			i++
+	if stop > y-x {
+		stop = y - x
+	}
+	for i := start; i <= stop; i++ {
+		val, err := l.db.Get(l.indexKey(x + i))
+		if err != nil {
+			return err
+		}
+		quit := false
+		if fn(i, val, &quit); quit {
 			return nil
 		}
-		return ErrStopIteration
-	})
-	if err == ErrStopIteration {
-		return nil
 	}
-	return err
+	return nil
 }
 
 // Append ...
@@ -73,17 +65,15 @@ func (l *List) Append(values ...Value) error {
 	if err != nil {
 		return err
 	}
-	if x == 0 && y == -1 {
-		if err := l.db.Put(l.rawKey(), nil); err != nil {
-			return err
-		}
+	if len(values) == 0 {
+		return nil
 	}
 	for i, val := range values {
 		if err := l.db.Put(l.indexKey(y+int64(i)+1), val); err != nil {
 			return err
 		}
 	}
-	return nil
+	return l.setRangeIndex(x, y+int64(len(values)))
 }
 
 // Pop ...
@@ -109,8 +99,8 @@ func (l *List) Pop() ([]byte, error) {
 	if err := l.db.Delete(keyIndex); err != nil {
 		return nil, err
 	}
-	if size == 1 { // clean up
-		return nil, l.db.Delete(l.rawKey())
+	if err := l.setRangeIndex(x, y-1); err != nil {
+		return nil, err
 	}
 
 	return val, nil
@@ -122,47 +112,65 @@ func (l *List) Len() (int64, error) {
 	return y - x + 1, err
 }
 
+// rangeIndex returns the lowest and highest index of the list or (0, -1) if
+// the list is empty, as stored in the meta key of the list
 func (l *List) rangeIndex() (int64, int64, error) {
-	left, err := l.leftIndex()
-	if err != nil {
+	meta, err := l.db.Get(l.rawKey())
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return 0, -1, err
 	}
-	right, err := l.rightIndex()
-	if err != nil {
-		return 0, -1, err
+	if len(meta) == 16 {
+		return int64(binary.BigEndian.Uint64(meta)), int64(binary.BigEndian.Uint64(meta[8:])), nil
 	}
-	return left, right, nil
+	return l.scanIndex()
 }
 
-func (l *List) leftIndex() (int64, error) {
-	idx := int64(0) // default 0
-	prefix := l.keyPrefix()
-	ErrStopIteration := errors.New("err: stop iteration")
-	err := l.db.Scan(prefix, func(key Key) error {
-		if bytes.HasPrefix(key, prefix) {
-			idx = l.indexInKey(key)
-		}
-		return ErrStopIteration
-	})
-	if err == ErrStopIteration {
-		return idx, nil
+// setRangeIndex stores the lowest and highest index of the list in its meta
+// key, which is removed once the list is empty
+func (l *List) setRangeIndex(left, right int64) error {
+	if right < left {
+		return l.db.Delete(l.rawKey())
 	}
-	return idx, err
+
+	meta := make([]byte, 16)
+	binary.BigEndian.PutUint64(meta, uint64(left))
+	binary.BigEndian.PutUint64(meta[8:], uint64(right))
+	return l.db.Put(l.rawKey(), meta)
 }
 
-func (l *List) rightIndex() (int64, error) {
-	idx := int64(-1) // default -1
+// scanIndex returns the lowest and highest index of a list written without
+// them in its meta key from all of its keys, as indexes are not stored in
+// numeric key order
+func (l *List) scanIndex() (int64, int64, error) {
+	left, right := int64(0), int64(-1) // defaults 0, -1
+	found := false
 	prefix := l.keyPrefix()
 	err := l.db.Scan(prefix, func(key Key) error {
-		if bytes.HasPrefix(key, prefix) {
-			idx = l.indexInKey(key)
+		if !bytes.HasPrefix(key, prefix) {
+			return nil
+		}
+		idx := l.indexInKey(key)
+		if !found || idx < left {
+			left = idx
+		}
+		if !found || idx > right {
+			right = idx
 		}
+		found = true
 		return nil
 	})
-	return idx, err
+	if err != nil {
+		return 0, -1, err
+	}
+	return left, right, nil
+}
+
+func (l *List) leftIndex() (int64, error) {
+	left, _, err := l.rangeIndex()
+	return left, err
 }
 
-// +key,l = ""
+// +key,l = left and right index
 func (l *List) rawKey() []byte {
 	return rawKey(l.key, elementType(listType))
 }
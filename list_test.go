@@ -1,6 +1,7 @@
 package bitcask
 
 import (
+	"fmt"
 	"io/ioutil"
 	"testing"
 
@@ -42,4 +43,79 @@ func TestList(t *testing.T) {
 		assert.NoError(err)
 		assert.Equal(int64(3), len)
 	})
+
+	t.Run("Range", func(t *testing.T) {
+		var actual [][]byte
+		err := l.Range(1, -1, func(i int64, value []byte, quit *bool) {
+			actual = append(actual, value)
+		})
+		assert.NoError(err)
+		assert.Equal([][]byte{[]byte("two"), []byte("three")}, actual)
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		val, err := l.Index(2)
+		assert.NoError(err)
+		assert.Equal([]byte("three"), val)
+	})
+
+	t.Run("Pop", func(t *testing.T) {
+		for _, expected := range []string{"three", "two", "one"} {
+			val, err := l.Pop()
+			assert.NoError(err)
+			assert.Equal([]byte(expected), val)
+		}
+
+		len, err := l.Len()
+		assert.NoError(err)
+		assert.Equal(int64(0), len)
+	})
+
+	t.Run("Large", func(t *testing.T) {
+		for i := 0; i < 300; i++ {
+			err := l.Append([]byte(fmt.Sprintf("%d", i)))
+			assert.NoError(err)
+		}
+
+		len, err := l.Len()
+		assert.NoError(err)
+		assert.Equal(int64(300), len)
+
+		val, err := l.Index(299)
+		assert.NoError(err)
+		assert.Equal([]byte("299"), val)
+
+		// The bounds are stored in the meta key instead of scanning the list
+		x, y, err := l.rangeIndex()
+		assert.NoError(err)
+		assert.Equal(int64(0), x)
+		assert.Equal(int64(299), y)
+		meta, err := db.Get(l.rawKey())
+		assert.NoError(err)
+		assert.Len(meta, 16)
+	})
+
+	t.Run("NoBounds", func(t *testing.T) {
+		// Lists written without their bounds in the meta key are scanned
+		l := db.List([]byte("legacy"))
+		for i := int64(0); i < 3; i++ {
+			assert.NoError(db.Put(l.indexKey(i), []byte(fmt.Sprintf("%d", i))))
+		}
+
+		len, err := l.Len()
+		assert.NoError(err)
+		assert.Equal(int64(3), len)
+
+		assert.NoError(l.Append([]byte("3")))
+		meta, err := db.Get(l.rawKey())
+		assert.NoError(err)
+		assert.Len(meta, 16)
+
+		val, err := l.Pop()
+		assert.NoError(err)
+		assert.Equal([]byte("3"), val)
+		len, err = l.Len()
+		assert.NoError(err)
+		assert.Equal(int64(3), len)
+	})
 }
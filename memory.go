@@ -0,0 +1,74 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/index"
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+// memoryPath is the path of a database opened with OpenInMemory on its
+// in-memory filesystem
+const memoryPath = "/bitcask"
+
+// memoryFS is the filesystem of a database opened with OpenInMemory, no
+// other process can open it so it needs no lock file
+type memoryFS struct {
+	*vfs.MemFS
+}
+
+func (memoryFS) Lock(name string) (vfs.Locker, error) { return nopLocker{}, nil }
+
+// nopLocker is a lock that is always acquired
+type nopLocker struct{}
+
+func (nopLocker) TryLock() (bool, error) { return true, nil }
+
+func (nopLocker) Unlock() error { return nil }
+
+// OpenInMemory opens a new empty database kept entirely in memory, for
+// example for tests or ephemeral caches. Rotation, merges and stats work as
+// with Open, but everything is lost when the database is closed unless it is
+// saved with SaveTo first, see Saver. Options are applied as with Open, except for
+// WithFS.
+func OpenInMemory(options ...Option) (DB, error) {
+	return Open(memoryPath, append(options, WithFS(memoryFS{vfs.NewMemFS()}))...)
+}
+
+// SaveTo saves a copy of the database to path on the filesystem of the
+// operating system which can be opened with Open, path must not exist or be
+// empty. Unlike Backup the copy has an up to date index.
+func (b *bitcask) SaveTo(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.current.Flush(); err != nil {
+		return err
+	}
+
+	if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+		return ErrDatabaseExists
+	}
+	if err := os.MkdirAll(path, b.config.DirMode); err != nil {
+		return err
+	}
+
+	exclude := []string{lockfile, "index", "meta.json", "*.tmp"}
+	if err := internal.Copy(b.fs, b.path, vfs.OS, path, exclude); err != nil {
+		return err
+	}
+
+	indexer, err := index.NewIndexerWithFormat(vfs.OS, index.Format(b.config.IndexFormat))
+	if err != nil {
+		return err
+	}
+	if err := indexer.Save(b.trie, filepath.Join(path, "index"), b.config.FileMode); err != nil {
+		return err
+	}
+
+	meta := *b.metadata
+	meta.IndexUpToDate = true
+	return meta.Save(vfs.OS, filepath.Join(path, "meta.json"), b.config.FileMode)
+}
@@ -0,0 +1,89 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+func TestOpenInMemory(t *testing.T) {
+	db, err := OpenInMemory(WithMaxDatafileSize(64))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, db.Put(Key(fmt.Sprintf("foo%d", i%5)), Value(fmt.Sprintf("bar%d", i))))
+	}
+	require.NoError(t, db.Delete(Key("foo0")))
+
+	t.Run("NoLockFile", func(t *testing.T) {
+		b := db.(*bitcask)
+		assert.False(t, vfs.Exists(b.fs, filepath.Join(db.Path(), lockfile)))
+	})
+
+	t.Run("Independent", func(t *testing.T) {
+		other, err := OpenInMemory()
+		require.NoError(t, err)
+		defer other.Close()
+
+		assert.Equal(t, 0, other.Len())
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := db.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.Keys)
+		assert.True(t, stats.Datafiles > 1)
+		assert.True(t, stats.Size > 0)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		require.NoError(t, db.Merge())
+
+		stats, err := db.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.Keys)
+		assert.Equal(t, int64(0), stats.Reclaimable)
+	})
+
+	t.Run("SaveTo", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "bitcask")
+		require.NoError(t, err)
+		defer os.RemoveAll(testDir)
+
+		require.NoError(t, db.Put(Key("hello"), Value("world")))
+		saver, ok := db.(Saver)
+		require.True(t, ok)
+		require.NoError(t, saver.SaveTo(testDir))
+		assert.NoFileExists(t, filepath.Join(testDir, lockfile))
+
+		saved, err := Open(testDir)
+		require.NoError(t, err)
+		defer saved.Close()
+
+		assert.FileExists(t, filepath.Join(testDir, "index"))
+		assert.Equal(t, db.Len(), saved.Len())
+		val, err := saved.Get(Key("foo4"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("bar19"), val)
+		val, err = saved.Get(Key("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, Value("world"), val)
+		assert.False(t, saved.Has(Key("foo0")))
+	})
+
+	t.Run("SaveToExists", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "bitcask")
+		require.NoError(t, err)
+		defer os.RemoveAll(testDir)
+
+		require.NoError(t, os.WriteFile(filepath.Join(testDir, "foo"), []byte("bar"), 0600))
+		assert.ErrorIs(t, db.(Saver).SaveTo(testDir), ErrDatabaseExists)
+	})
+}
@@ -0,0 +1,89 @@
+// Package metrics defines the Observer hook used to instrument a Bitcask
+// database and a ready-made exporter of metrics in the Prometheus text
+// exposition format.
+package metrics
+
+import "time"
+
+// Op is a database operation reported to an Observer
+type Op int
+
+const (
+	// OpGet is a read of a key with Get
+	OpGet Op = iota
+	// OpPut is a write of a key with Put
+	OpPut
+	// OpDelete is a deletion of a key with Delete
+	OpDelete
+	// OpWriteBatch is a batch of entries written to the active datafile,
+	// every write (including Put, Delete and transaction commits) ends up
+	// in a batch
+	OpWriteBatch
+	// OpMerge is a merge of the datafiles
+	OpMerge
+	// OpRotate is a rotation of the active datafile
+	OpRotate
+	// OpRecover is a check (and recovery if required) of the datafiles
+	// when the database is opened
+	OpRecover
+)
+
+var opNames = [...]string{
+	OpGet:        "get",
+	OpPut:        "put",
+	OpDelete:     "delete",
+	OpWriteBatch: "write_batch",
+	OpMerge:      "merge",
+	OpRotate:     "rotate",
+	OpRecover:    "recover",
+}
+
+// Ops returns all the operations reported to observers
+func Ops() []Op {
+	ops := make([]Op, len(opNames))
+	for i := range ops {
+		ops[i] = Op(i)
+	}
+	return ops
+}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return "unknown"
+	}
+	return opNames[op]
+}
+
+// Event describes a completed operation
+type Event struct {
+	// Op is the operation performed
+	Op Op
+
+	// Duration is how long the operation took
+	Duration time.Duration
+
+	// Bytes is the number of bytes read (Get) or written (Put, Delete,
+	// WriteBatch and Merge), or the size of the rotated datafile (Rotate)
+	Bytes int64
+
+	// Keys is the number of keys the operation read or wrote, for Get it is
+	// 0 if the key was not found
+	Keys int
+
+	// Err is the error the operation failed with, if any. A Get of a key
+	// that does not exist is not an error.
+	Err error
+}
+
+// Observer is notified of every database operation. Observe is called
+// synchronously, possibly concurrently and possibly while holding locks of
+// the database so it must be safe for concurrent use and return quickly.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is an adapter to use an ordinary function as an Observer
+type ObserverFunc func(Event)
+
+// Observe calls f(e)
+func (f ObserverFunc) Observe(e Event) { f(e) }
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the buckets of the
+// operation latency histograms
+var DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Gauge is a value sampled when metrics are exported, e.g: the number of keys
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// opMetrics are the metrics aggregated for an operation
+type opMetrics struct {
+	count   uint64
+	errors  uint64
+	bytes   int64
+	keys    int64
+	sum     float64
+	buckets []uint64
+}
+
+// Prometheus is an Observer that aggregates operation counts, errors, bytes,
+// keys and latencies and exports them along with gauges in the Prometheus
+// text exposition format.
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu     sync.Mutex
+	ops    map[Op]*opMetrics
+	gauges []func() []Gauge
+}
+
+var _ Observer = (*Prometheus)(nil)
+
+// NewPrometheus returns a new exporter whose metric names are prefixed with
+// namespace (e.g: "bitcask") using the given latency histogram buckets, or
+// DefaultBuckets if none are given.
+func NewPrometheus(namespace string, buckets ...float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	p := &Prometheus{
+		namespace: namespace,
+		buckets:   buckets,
+		ops:       make(map[Op]*opMetrics),
+	}
+	for _, op := range Ops() {
+		p.ops[op] = &opMetrics{buckets: make([]uint64, len(buckets))}
+	}
+	return p
+}
+
+// Observe implements the Observer interface
+func (p *Prometheus) Observe(e Event) {
+	seconds := e.Duration.Seconds()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.ops[e.Op]
+	if !ok {
+		return
+	}
+
+	m.count++
+	if e.Err != nil {
+		m.errors++
+	}
+	m.bytes += e.Bytes
+	m.keys += int64(e.Keys)
+	m.sum += seconds
+	for i, le := range p.buckets {
+		if seconds <= le {
+			m.buckets[i]++
+			break
+		}
+	}
+}
+
+// AddGauges adds a function called on every export which returns gauges to
+// export, e.g: the statistics of a database.
+func (p *Prometheus) AddGauges(f func() []Gauge) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.gauges = append(p.gauges, f)
+}
+
+func (p *Prometheus) name(name string) string {
+	if p.namespace == "" {
+		return name
+	}
+	return p.namespace + "_" + name
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	gaugeFuncs := p.gauges
+	p.mu.Unlock()
+
+	// Sample gauges without holding the lock as they may be slow
+	var gauges []Gauge
+	for _, f := range gaugeFuncs {
+		gauges = append(gauges, f()...)
+	}
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	p.mu.Lock()
+	p.writeCounter(bw, "operations_total", "Total number of operations.", func(m *opMetrics) string {
+		return strconv.FormatUint(m.count, 10)
+	})
+	p.writeCounter(bw, "operation_errors_total", "Total number of operations that failed.", func(m *opMetrics) string {
+		return strconv.FormatUint(m.errors, 10)
+	})
+	p.writeCounter(bw, "operation_bytes_total", "Total number of bytes read or written by operations.", func(m *opMetrics) string {
+		return strconv.FormatInt(m.bytes, 10)
+	})
+	p.writeCounter(bw, "operation_keys_total", "Total number of keys read or written by operations.", func(m *opMetrics) string {
+		return strconv.FormatInt(m.keys, 10)
+	})
+	p.writeHistogram(bw)
+	p.mu.Unlock()
+
+	for _, g := range gauges {
+		name := p.name(g.Name)
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, g.Help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(bw, "%s %s\n", name, formatFloat(g.Value))
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (p *Prometheus) writeCounter(w io.Writer, name, help string, value func(*opMetrics) string) {
+	name = p.name(name)
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, op := range Ops() {
+		fmt.Fprintf(w, "%s{op=%q} %s\n", name, op, value(p.ops[op]))
+	}
+}
+
+func (p *Prometheus) writeHistogram(w io.Writer) {
+	name := p.name("operation_duration_seconds")
+	fmt.Fprintf(w, "# HELP %s Latency of operations in seconds.\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, op := range Ops() {
+		m := p.ops[op]
+		var cumulative uint64
+		for i, le := range p.buckets {
+			cumulative += m.buckets[i]
+			fmt.Fprintf(w, "%s_bucket{op=%q,le=%q} %d\n", name, op, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{op=%q,le=\"+Inf\"} %d\n", name, op, m.count)
+		fmt.Fprintf(w, "%s_sum{op=%q} %s\n", name, op, formatFloat(m.sum))
+		fmt.Fprintf(w, "%s_count{op=%q} %d\n", name, op, m.count)
+	}
+}
+
+// ServeHTTP serves the metrics to a Prometheus server
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
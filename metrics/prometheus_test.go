@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewPrometheus("test", 0.01, 0.001)
+	p.Observe(Event{Op: OpGet, Duration: 500 * time.Microsecond, Bytes: 3, Keys: 1})
+	p.Observe(Event{Op: OpGet, Duration: 5 * time.Millisecond, Bytes: 0, Keys: 0})
+	p.Observe(Event{Op: OpPut, Duration: time.Second, Bytes: 6, Keys: 1, Err: errors.New("error: boom")})
+	p.Observe(Event{Op: Op(-1)})
+	p.AddGauges(func() []Gauge {
+		return []Gauge{{Name: "keys", Help: "Number of keys.", Value: 42}}
+	})
+
+	var sb strings.Builder
+	n, err := p.WriteTo(&sb)
+	assert.NoError(err)
+	assert.Equal(int64(sb.Len()), n)
+
+	out := sb.String()
+	for _, line := range []string{
+		"# TYPE test_operations_total counter",
+		`test_operations_total{op="get"} 2`,
+		`test_operations_total{op="put"} 1`,
+		`test_operations_total{op="merge"} 0`,
+		`test_operation_errors_total{op="get"} 0`,
+		`test_operation_errors_total{op="put"} 1`,
+		`test_operation_bytes_total{op="get"} 3`,
+		`test_operation_keys_total{op="put"} 1`,
+		"# TYPE test_operation_duration_seconds histogram",
+		`test_operation_duration_seconds_bucket{op="get",le="0.001"} 1`,
+		`test_operation_duration_seconds_bucket{op="get",le="0.01"} 2`,
+		`test_operation_duration_seconds_bucket{op="get",le="+Inf"} 2`,
+		`test_operation_duration_seconds_bucket{op="put",le="0.01"} 0`,
+		`test_operation_duration_seconds_bucket{op="put",le="+Inf"} 1`,
+		`test_operation_duration_seconds_sum{op="put"} 1`,
+		`test_operation_duration_seconds_count{op="get"} 2`,
+		"# HELP test_keys Number of keys.",
+		"# TYPE test_keys gauge",
+		"test_keys 42",
+	} {
+		assert.Contains(out, line+"\n")
+	}
+	assert.NotContains(out, "unknown")
+
+	t.Run("ServeHTTP", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Contains(w.Header().Get("Content-Type"), "version=0.0.4")
+		assert.Equal(out, w.Body.String())
+	})
+}
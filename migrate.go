@@ -0,0 +1,60 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"go.mills.io/bitcask/v2/internal"
+)
+
+// FormatVersion is the on-disk format version of databases created by this
+// version of the library. Databases in an older format can still be opened
+// and are upgraded with Migrate (or a Merge), databases in a newer format are
+// refused with ErrInvalidVersion.
+//
+//   - 0: datafiles and index without a header, checksums of values only
+//   - 1: datafiles and index with a versioned header, CRC32C checksums of
+//     the size prefix, key and value
+const FormatVersion = 1
+
+// Migrate upgrades the database at path to the current format (FormatVersion)
+// by rewriting all of its datafiles and its index. The database is backed up
+// to backup first, which must not exist, so it can be restored if anything
+// goes wrong. Databases already in the current format are left as is and no
+// backup is made. The database must not be open.
+func Migrate(path, backup string, options ...Option) (err error) {
+	options = append(options, WithAutoReadonly(false))
+
+	db, err := Open(path, options...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	b := db.(*bitcask)
+	log := b.config.Log()
+
+	if b.metadata.Version == FormatVersion {
+		log.Debug("database is already in the current format", "path", path, "version", FormatVersion)
+		return nil
+	}
+
+	if internal.Exists(b.fs, backup) {
+		return ErrBackupExists
+	}
+
+	log.Info("backing up database", "path", path, "backup", backup)
+	if err := db.Backup(backup); err != nil {
+		return fmt.Errorf("error backing up database: %w", err)
+	}
+
+	log.Info("migrating database", "path", path, "from", b.metadata.Version, "to", FormatVersion)
+	if err := db.Merge(); err != nil {
+		return fmt.Errorf("error migrating database (a backup is in %s): %w", backup, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/codec"
+	"go.mills.io/bitcask/v2/internal/index"
+	"go.mills.io/bitcask/v2/internal/metadata"
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+// writeLegacyDatafile writes a datafile in the legacy format (no header and
+// checksums of values only) with the given key/value pairs
+func writeLegacyDatafile(t *testing.T, path string, id int, kvs ...string) {
+	f, err := os.Create(filepath.Join(path, fmt.Sprintf("%09d.data", id)))
+	require.NoError(t, err)
+	defer f.Close()
+
+	enc := codec.NewEncoder(f, codec.VersionLegacy)
+	for i := 0; i < len(kvs); i += 2 {
+		e := internal.NewEntry([]byte(kvs[i]), []byte(kvs[i+1]))
+		e.Checksum = crc32.ChecksumIEEE(e.Value)
+		_, err := enc.Encode(e)
+		require.NoError(t, err)
+	}
+}
+
+func hasHeader(t *testing.T, fn, magic string) bool {
+	data, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	return len(data) >= 8 && string(data[:4]) == magic
+}
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir := t.TempDir()
+	writeLegacyDatafile(t, testDir, 0, "foo", "bar", "hello", "world")
+	writeLegacyDatafile(t, testDir, 1, "foo", "baz")
+
+	db, err := Open(testDir)
+	require.NoError(t, err)
+	assert.Equal(0, db.(*bitcask).metadata.Version)
+	require.NoError(t, db.Close())
+
+	backup := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, Migrate(testDir, backup))
+
+	// The backup is the database as it was
+	assert.False(hasHeader(t, filepath.Join(backup, "000000000.data"), "BCDF"))
+	assert.False(hasHeader(t, filepath.Join(backup, "000000001.data"), "BCDF"))
+
+	fns, err := internal.GetDatafiles(vfs.OS, testDir)
+	require.NoError(t, err)
+	for _, fn := range fns {
+		assert.True(hasHeader(t, fn, "BCDF"), fn)
+	}
+	assert.True(hasHeader(t, filepath.Join(testDir, "index"), "BCIX"))
+
+	meta, err := metadata.Load(vfs.OS, filepath.Join(testDir, "meta.json"))
+	require.NoError(t, err)
+	assert.Equal(FormatVersion, meta.Version)
+
+	db, err = Open(testDir)
+	require.NoError(t, err)
+	value, err := db.Get([]byte("foo"))
+	assert.NoError(err)
+	assert.Equal(Value("baz"), value)
+	value, err = db.Get([]byte("hello"))
+	assert.NoError(err)
+	assert.Equal(Value("world"), value)
+	require.NoError(t, db.Close())
+
+	t.Run("Current", func(t *testing.T) {
+		backup := filepath.Join(t.TempDir(), "backup")
+		assert.NoError(Migrate(testDir, backup))
+		assert.NoDirExists(backup)
+	})
+
+	t.Run("BackupExists", func(t *testing.T) {
+		testDir := t.TempDir()
+		writeLegacyDatafile(t, testDir, 0, "foo", "bar")
+
+		assert.ErrorIs(Migrate(testDir, t.TempDir()), ErrBackupExists)
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		testDir := t.TempDir()
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.ErrorIs(Migrate(testDir, filepath.Join(t.TempDir(), "backup")), ErrDatabaseLocked)
+	})
+}
+
+func TestFormatVersion(t *testing.T) {
+	t.Run("New", func(t *testing.T) {
+		testDir := t.TempDir()
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		meta, err := metadata.Load(vfs.OS, filepath.Join(testDir, "meta.json"))
+		require.NoError(t, err)
+		assert.Equal(t, FormatVersion, meta.Version)
+	})
+
+	newer := func(t *testing.T, fn string, version int) {
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		binary.BigEndian.PutUint32(data[4:8], uint32(version))
+		require.NoError(t, os.WriteFile(fn, data, 0600))
+	}
+
+	setup := func(t *testing.T) string {
+		testDir := t.TempDir()
+		db, err := Open(testDir)
+		require.NoError(t, err)
+		require.NoError(t, db.Put([]byte("foo"), []byte("bar")))
+		require.NoError(t, db.Close())
+		return testDir
+	}
+
+	t.Run("NewerMetadata", func(t *testing.T) {
+		testDir := setup(t)
+		meta := &metadata.MetaData{Version: FormatVersion + 1}
+		require.NoError(t, meta.Save(vfs.OS, filepath.Join(testDir, "meta.json"), 0600))
+
+		_, err := Open(testDir)
+		assert.ErrorIs(t, err, ErrInvalidVersion)
+	})
+
+	t.Run("NewerDatafile", func(t *testing.T) {
+		testDir := setup(t)
+		newer(t, filepath.Join(testDir, "000000000.data"), codec.CurrentVersion+1)
+
+		_, err := Open(testDir, WithAutoRecovery(false))
+		assert.ErrorIs(t, err, ErrInvalidVersion)
+
+		_, err = Open(testDir, WithAutoRecovery(true))
+		assert.ErrorIs(t, err, ErrInvalidVersion)
+	})
+
+	t.Run("NewerIndex", func(t *testing.T) {
+		testDir := setup(t)
+		newer(t, filepath.Join(testDir, "index"), index.CurrentVersion+1)
+
+		_, err := Open(testDir)
+		assert.ErrorIs(t, err, ErrInvalidVersion)
+	})
+}
@@ -1,9 +1,15 @@
 package bitcask
 
 import (
+	"log/slog"
 	"os"
+	"time"
 
 	"go.mills.io/bitcask/v2/internal/config"
+	"go.mills.io/bitcask/v2/internal/index"
+	"go.mills.io/bitcask/v2/internal/keydir"
+	"go.mills.io/bitcask/v2/metrics"
+	"go.mills.io/bitcask/v2/vfs"
 )
 
 const (
@@ -30,6 +36,37 @@ const (
 
 	// DefaultAutoRecovery is the default auto-recovery action, if set will attempt to automatically recover the database if required
 	DefaultAutoRecovery = true
+
+	// DefaultIndexFormat is the default format the index is saved in
+	DefaultIndexFormat = IndexFormatStream
+
+	// DefaultKeydir is the default mode of the keydir
+	DefaultKeydir = KeydirRadix
+)
+
+const (
+	// KeydirRadix keeps the keys in an ordered radix tree
+	KeydirRadix = string(keydir.ModeRadix)
+
+	// KeydirPacked keeps the keys in an ordered radix tree with the location
+	// of their values packed into 16 bytes, which limits entries to 4GiB
+	KeydirPacked = string(keydir.ModePacked)
+
+	// KeydirHashed keeps the keys in a hash map with the location of their
+	// values packed like KeydirPacked. It uses much less memory but the keys
+	// are unordered: Scan, Range and iterators return ErrUnordered and
+	// ForEach visits keys in no particular order. Transactions see writes
+	// committed after they started.
+	KeydirHashed = string(keydir.ModeHashed)
+)
+
+const (
+	// IndexFormatStream saves the index as a stream of key and item records
+	IndexFormatStream = string(index.FormatStream)
+
+	// IndexFormatBlock saves the index sorted in blocks of prefix compressed
+	// keys which is faster to load and save for large databases
+	IndexFormatBlock = string(index.FormatBlock)
 )
 
 // Option is a function that takes a config struct and modifies it
@@ -45,6 +82,16 @@ func withConfig(src *config.Config) Option {
 		cfg.AutoRecovery = src.AutoRecovery
 		cfg.DirMode = src.DirMode
 		cfg.FileMode = src.FileMode
+		cfg.IndexFormat = src.IndexFormat
+		cfg.Keydir = src.Keydir
+		cfg.WriteBufferSize = src.WriteBufferSize
+		cfg.BloomFalsePositiveRate = src.BloomFalsePositiveRate
+		// Merged datafiles aren't appended to again so they aren't
+		// preallocated
+		cfg.Datasync = src.Datasync
+		cfg.Fadvise = src.Fadvise
+		cfg.Logger = src.Logger
+		cfg.FS = src.FS
 		return nil
 	}
 }
@@ -118,6 +165,109 @@ func WithSyncWrites(enabled bool) Option {
 	}
 }
 
+// WithIndexFormat sets the format the index is saved in, IndexFormatStream
+// or IndexFormatBlock. An index in either format is loaded regardless.
+func WithIndexFormat(format string) Option {
+	return func(cfg *config.Config) error {
+		if _, err := index.NewIndexerWithFormat(nil, index.Format(format)); err != nil {
+			return ErrInvalidIndexFormat
+		}
+		cfg.IndexFormat = format
+		return nil
+	}
+}
+
+// WithKeydir sets the mode of the in-memory keydir mapping keys to the
+// location of their values, KeydirRadix, KeydirPacked or KeydirHashed
+func WithKeydir(mode string) Option {
+	return func(cfg *config.Config) error {
+		if _, err := keydir.New(keydir.Mode(mode)); err != nil {
+			return ErrInvalidKeydir
+		}
+		cfg.Keydir = mode
+		return nil
+	}
+}
+
+// WithCacheSize enables a least recently used cache of values read by Get
+// using at most size bytes. The default is no cache.
+func WithCacheSize(size int64) Option {
+	return func(cfg *config.Config) error {
+		cfg.CacheSize = size
+		return nil
+	}
+}
+
+// WithBloomFilter stores a Bloom filter of the keys of every immutable
+// datafile with the given false positive rate, between 0 and 1, so readers of
+// the datafiles without the keydir can skip those that don't have a key. The
+// keydir is authoritative so Has and Get don't consult them. Stats reports
+// their estimated false positive rate. The default is no filters.
+func WithBloomFilter(fpRate float64) Option {
+	return func(cfg *config.Config) error {
+		if fpRate <= 0 || fpRate >= 1 {
+			return ErrInvalidFalsePositiveRate
+		}
+		cfg.BloomFalsePositiveRate = fpRate
+		return nil
+	}
+}
+
+// WithRebuildProgress sets a function called with the number of datafiles
+// done and the total number of datafiles while the index is rebuilt from
+// the datafiles when the database is opened, e.g. to log progress.
+func WithRebuildProgress(fn func(done, total int)) Option {
+	return func(cfg *config.Config) error {
+		cfg.RebuildProgress = fn
+		return nil
+	}
+}
+
+// WithWriteBuffer buffers up to size bytes of writes in memory before
+// writing them to the active datafile, instead of writing every entry.
+// Buffered writes are also written every interval, if not zero, and when the
+// database is synced, a datafile is rotated or the database is closed.
+// Buffered writes are read by Get but lost if the process crashes, use
+// WithSyncWrites or Sync for durability.
+func WithWriteBuffer(size int, interval time.Duration) Option {
+	return func(cfg *config.Config) error {
+		cfg.WriteBufferSize = size
+		cfg.WriteBufferInterval = interval
+		return nil
+	}
+}
+
+// WithPreallocate preallocates the disk space of the active datafile up to
+// the maximum datafile size so it doesn't fragment as it grows. The size of
+// the datafile stays that of the entries written. Only supported on Linux,
+// elsewhere and on filesystems without fallocate it does nothing.
+func WithPreallocate(enabled bool) Option {
+	return func(cfg *config.Config) error {
+		cfg.Preallocate = enabled
+		return nil
+	}
+}
+
+// WithDatasync syncs datafiles with fdatasync instead of fsync, skipping
+// metadata not needed to read them back. Only supported on Linux, elsewhere
+// fsync is used.
+func WithDatasync(enabled bool) Option {
+	return func(cfg *config.Config) error {
+		cfg.Datasync = enabled
+		return nil
+	}
+}
+
+// WithFadvise hints with posix_fadvise that datafiles are read sequentially
+// when the index is rebuilt from them and prefetches the datafiles merged.
+// Only supported on Linux, elsewhere it does nothing.
+func WithFadvise(enabled bool) Option {
+	return func(cfg *config.Config) error {
+		cfg.Fadvise = enabled
+		return nil
+	}
+}
+
 func newDefaultConfig() *config.Config {
 	return &config.Config{
 		MaxDatafileSize: DefaultMaxDatafileSize,
@@ -128,5 +278,48 @@ func newDefaultConfig() *config.Config {
 		AutoRecovery:    DefaultAutoRecovery,
 		DirMode:         DefaultDirMode,
 		FileMode:        DefaultFileMode,
+		IndexFormat:     DefaultIndexFormat,
+		Keydir:          DefaultKeydir,
+	}
+}
+
+// WithObserver sets an observer that is notified of every Get, Put, Delete,
+// WriteBatch, Merge, datafile rotation and recovery with its latency and the
+// number of bytes and keys involved. See the metrics package for a
+// ready-made Prometheus exporter.
+func WithObserver(observer metrics.Observer) Option {
+	return func(cfg *config.Config) error {
+		cfg.Observer = observer
+		return nil
+	}
+}
+
+// WithLogger sets the logger used for diagnostics such as datafile recovery,
+// merges and index rebuilds. The default is to discard them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config.Config) error {
+		cfg.Logger = logger
+		return nil
+	}
+}
+
+// WithFS sets the filesystem the database is stored on, see the vfs package
+// for an in-memory and a fault-injecting implementation. The default is the
+// filesystem of the operating system.
+func WithFS(fs vfs.FS) Option {
+	return func(cfg *config.Config) error {
+		cfg.FS = fs
+		return nil
+	}
+}
+
+// fileSystem returns the filesystem set by the options, which is needed
+// before the configuration of the database can be loaded. Errors of the
+// options are reported when they are applied to the loaded configuration.
+func fileSystem(options []Option) vfs.FS {
+	cfg := newDefaultConfig()
+	for _, opt := range options {
+		_ = opt(cfg)
 	}
+	return cfg.FileSystem()
 }
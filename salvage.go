@@ -0,0 +1,159 @@
+package bitcask
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/data"
+)
+
+// SalvageReport is the result of salvaging a database with Salvage
+type SalvageReport struct {
+	// Datafiles is the number of datafiles scanned
+	Datafiles int `json:"datafiles"`
+
+	// Entries is the number of valid entries read
+	Entries int64 `json:"entries"`
+
+	// Keys is the number of keys written to the new database
+	Keys int `json:"keys"`
+
+	// Deleted is the number of keys whose latest entry is a deletion
+	Deleted int `json:"deleted"`
+
+	// MaxKeySize and MaxValueSize are the sizes the new database was
+	// created with, inferred from the data unless given as options
+	MaxKeySize   uint32 `json:"max_key_size"`
+	MaxValueSize uint64 `json:"max_value_size"`
+
+	// Corrupted are the corrupted byte ranges of the datafiles that were
+	// skipped
+	Corrupted []Problem `json:"corrupted"`
+
+	// LostKeys are the keys whose latest entry was corrupted, an older value
+	// of them is salvaged if there is one
+	LostKeys []string `json:"lost_keys"`
+}
+
+// OK returns true if nothing was lost
+func (r SalvageReport) OK() bool {
+	return len(r.Corrupted) == 0 && len(r.LostKeys) == 0
+}
+
+// salvagedItem is the location of the latest entry of a key
+type salvagedItem struct {
+	fileID  int
+	offset  int64
+	deleted bool
+}
+
+// Salvage rebuilds a clean database at dst from the datafiles of the
+// (possibly damaged) database at src, without needing its index, meta.json
+// or config.json. Every datafile is scanned tolerating corruption, the
+// latest valid entry of each key by file ID and offset wins. The maximum key
+// and value sizes are inferred from the data (and are never smaller than
+// the defaults), options are applied after them. The database at src is
+// left untouched and dst must not exist or be empty. Both are on the
+// filesystem set by WithFS.
+func Salvage(src, dst string, options ...Option) (SalvageReport, error) {
+	report := SalvageReport{Corrupted: []Problem{}, LostKeys: []string{}}
+
+	fs := fileSystem(options)
+
+	if entries, err := fs.ReadDir(dst); err == nil && len(entries) > 0 {
+		return report, ErrDatabaseExists
+	}
+
+	fns, err := internal.GetDatafiles(fs, src)
+	if err != nil {
+		return report, err
+	}
+	ids, err := internal.ParseIds(fns)
+	if err != nil {
+		return report, err
+	}
+	sort.Ints(ids)
+	report.Datafiles = len(ids)
+
+	datafile := func(id int) string {
+		return filepath.Join(src, fmt.Sprintf("%09d.data", id))
+	}
+
+	// Find the latest entry of every key and the sizes of keys and values
+	latest := make(map[string]salvagedItem)
+	lost := make(map[string]bool)
+	maxKeySize, maxValueSize := DefaultMaxKeySize, DefaultMaxValueSize
+	for _, id := range ids {
+		_, err := data.ScanDatafile(fs, datafile(id), 0, 0, func(e data.ScannedEntry) error {
+			if e.Corrupted {
+				lost[string(e.Key)] = true
+				return nil
+			}
+			report.Entries++
+			delete(lost, string(e.Key))
+			latest[string(e.Key)] = salvagedItem{fileID: id, offset: e.Offset, deleted: len(e.Value) == 0}
+
+			if n := uint32(len(e.Key)); n > maxKeySize {
+				maxKeySize = n
+			}
+			if n := uint64(len(e.Value)); n > maxValueSize {
+				maxValueSize = n
+			}
+			return nil
+		}, func(r data.Region) error {
+			report.Corrupted = append(report.Corrupted, Problem{
+				Kind:    ProblemCorrupted,
+				File:    r.Datafile,
+				Offset:  r.Offset,
+				Message: fmt.Sprintf("skipped %d corrupted bytes", r.Size),
+			})
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for key := range lost {
+		report.LostKeys = append(report.LostKeys, key)
+	}
+	sort.Strings(report.LostKeys)
+
+	options = append([]Option{WithMaxKeySize(maxKeySize), WithMaxValueSize(maxValueSize)}, options...)
+	db, err := Open(dst, options...)
+	if err != nil {
+		return report, err
+	}
+	b := db.(*bitcask)
+	report.MaxKeySize, report.MaxValueSize = b.config.MaxKeySize, b.config.MaxValueSize
+
+	// Write the latest entry of every key that isn't deleted
+	for _, id := range ids {
+		_, err := data.ScanDatafile(fs, datafile(id), 0, 0, func(e data.ScannedEntry) error {
+			if e.Corrupted {
+				return nil
+			}
+			item := latest[string(e.Key)]
+			if item.fileID != id || item.offset != e.Offset {
+				return nil
+			}
+			if item.deleted {
+				report.Deleted++
+				return nil
+			}
+			if err := db.Put(e.Key, e.Value); err != nil {
+				return fmt.Errorf("error writing key %q: %w", e.Key, err)
+			}
+			report.Keys++
+			return nil
+		}, nil)
+		if err != nil {
+			db.Close()
+			return report, err
+		}
+	}
+
+	return report, db.Close()
+}
@@ -0,0 +1,133 @@
+package bitcask
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSalvage(t *testing.T) {
+	setup := func(t *testing.T) string {
+		testDir := t.TempDir()
+
+		db, err := Open(testDir, WithMaxDatafileSize(128), WithMaxKeySize(128), WithMaxValueSize(1<<17))
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, db.Put([]byte(fmt.Sprintf("foo%d", i)), []byte("bar")))
+		}
+		require.NoError(t, db.Put([]byte("foo1"), []byte("baz")))
+		require.NoError(t, db.Delete([]byte("foo2")))
+		require.NoError(t, db.Put([]byte(strings.Repeat("k", 100)), bytes.Repeat([]byte("v"), 1<<17)))
+		require.NoError(t, db.Close())
+
+		// Lose everything but the datafiles
+		for _, fn := range []string{"index", "meta.json", "config.json"} {
+			require.NoError(t, os.Remove(filepath.Join(testDir, fn)))
+		}
+
+		return testDir
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		assert := assert.New(t)
+
+		src := setup(t)
+		dst := filepath.Join(t.TempDir(), "salvaged")
+
+		report, err := Salvage(src, dst)
+		require.NoError(t, err)
+		assert.True(report.OK())
+		assert.Equal(int64(13), report.Entries)
+		assert.Equal(10, report.Keys)
+		assert.Equal(1, report.Deleted)
+		assert.Equal(uint32(100), report.MaxKeySize)
+		assert.Equal(uint64(1<<17), report.MaxValueSize)
+
+		db, err := Open(dst)
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(10, db.Len())
+		val, err := db.Get([]byte("foo1"))
+		assert.NoError(err)
+		assert.Equal(Value("baz"), val)
+		assert.False(db.Has([]byte("foo2")))
+
+		verify, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.True(verify.OK(), "%v", verify.Problems)
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		assert := assert.New(t)
+
+		src := setup(t)
+		dst := t.TempDir()
+
+		// Corrupt the latest value of foo1, its first value is salvaged
+		fns, err := filepath.Glob(filepath.Join(src, "*.data"))
+		require.NoError(t, err)
+		for _, fn := range fns {
+			data, err := os.ReadFile(fn)
+			require.NoError(t, err)
+			if i := bytes.Index(data, []byte("foo1baz")); i > 0 {
+				data[i+4] ^= 0xff
+				require.NoError(t, os.WriteFile(fn, data, 0600))
+			}
+		}
+
+		report, err := Salvage(src, dst)
+		require.NoError(t, err)
+		assert.False(report.OK())
+		assert.Equal([]string{"foo1"}, report.LostKeys)
+		assert.Len(report.Corrupted, 1)
+		assert.Equal(ProblemCorrupted, report.Corrupted[0].Kind)
+
+		db, err := Open(dst)
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(10, db.Len())
+		val, err := db.Get([]byte("foo1"))
+		assert.NoError(err)
+		assert.Equal(Value("bar"), val)
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		assert := assert.New(t)
+
+		src := t.TempDir()
+		writeLegacyDatafile(t, src, 0, "foo", "bar", "hello", "world")
+		writeLegacyDatafile(t, src, 1, "foo", "baz")
+
+		dst := filepath.Join(t.TempDir(), "salvaged")
+		report, err := Salvage(src, dst)
+		require.NoError(t, err)
+		assert.True(report.OK())
+		assert.Equal(2, report.Keys)
+
+		db, err := Open(dst)
+		require.NoError(t, err)
+		defer db.Close()
+
+		val, err := db.Get([]byte("foo"))
+		assert.NoError(err)
+		assert.Equal(Value("baz"), val)
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		src := setup(t)
+		dst := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "foo"), nil, 0600))
+
+		_, err := Salvage(src, dst)
+		assert.ErrorIs(t, err, ErrDatabaseExists)
+	})
+}
@@ -3,7 +3,6 @@ package bitcask
 import (
 	"bytes"
 	"errors"
-	"log"
 )
 
 func (b *bitcask) SortedSet(key Key) *SortedSet {
@@ -15,7 +14,7 @@ func (b *bitcask) SortedSet(key Key) *SortedSet {
 // z[key]m member = score
 // z[key]s score member = ""
 type SortedSet struct {
-	db  DB
+	db  store
 	key Key
 }
 
@@ -71,6 +70,9 @@ func (s *SortedSet) Remove(members ...[]byte) (int, error) {
 	for _, member := range members {
 		score, err := s.db.Get(s.memberKey(member))
 		if err != nil {
+			if err == ErrKeyNotFound {
+				continue
+			}
 			return removed, err
 		}
 		if score == nil {
@@ -112,11 +114,9 @@ func (s *SortedSet) Range(from, to Score, fn func(i int64, score Score, member [
 		quit := false
 		score, member, err := s.splitScoreKey(key)
 		if err != nil {
-			log.Printf("err: %v\n", err)
 			return err
 		}
 		if fn(i, score, member, &quit); quit {
-			log.Println("stop iteration")
 			return ErrStopIteration
 		}
 		i++
@@ -159,7 +159,7 @@ func (s *SortedSet) scoreKey(score, member []byte) []byte {
 // split (z[key]s score member) into (score, member)
 func (s *SortedSet) splitScoreKey(scoreKey []byte) ([]byte, []byte, error) {
 	buf := bytes.TrimPrefix(scoreKey, s.keyPrefix())
-	pairs := bytes.Split(buf[1:], []byte{' '}) // skip score mark 's'
+	pairs := bytes.SplitN(buf[1:], []byte{' '}, 2) // skip score mark 's'
 	if len(pairs) != 2 {
 		return nil, nil, errors.New("invalid score/member key: " + string(scoreKey))
 	}
@@ -57,4 +57,25 @@ func TestSortedSet(t *testing.T) {
 		require.NoError(t, err)
 		assert.EqualValues(t, expected, actual)
 	})
+
+	t.Run("Remove", func(t *testing.T) {
+		removed, err := z.Remove([]byte("b"), []byte("missing"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+
+		_, err = z.Score([]byte("b"))
+		assert.Equal(t, ErrKeyNotFound, err)
+	})
+
+	t.Run("MemberWithSpaces", func(t *testing.T) {
+		_, err := z.Add(Score("5"), []byte("hello world"))
+		require.NoError(t, err)
+
+		var actual []Key
+		err = z.Range(Score("5"), Score("5"), func(i int64, score Score, member []byte, stop *bool) {
+			actual = append(actual, member)
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []Key{Key("hello world")}, actual)
+	})
 }
@@ -1,6 +1,9 @@
 package bitcask
 
-import "go.mills.io/bitcask/v2/internal"
+import (
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/metrics"
+)
 
 // Stats is a struct returned by Stats() on an open bitcask instance
 type Stats struct {
@@ -8,18 +11,55 @@ type Stats struct {
 	Keys        int
 	Size        int64
 	Reclaimable int64
+	CacheHits   uint64
+	CacheMisses uint64
+
+	// BloomFalsePositiveRate is the mean false positive rate of the Bloom
+	// filters of the datafiles estimated from how full they are
+	BloomFalsePositiveRate float64
 }
 
 // Stats returns statistics about the database including the number of
 // data files, keys and overall size on disk of the data
 func (b *bitcask) Stats() (stats Stats, err error) {
-	if stats.Size, err = internal.DirSize(b.path); err != nil {
+	if stats.Size, err = internal.DirSize(b.fs, b.path); err != nil {
 		return
 	}
 
-	stats.Datafiles = len(b.datafiles)
-	stats.Keys = b.trie.Len()
+	s := b.state.Load()
+	stats.Datafiles = len(s.datafiles)
+	stats.Keys = s.trie.Len()
+
+	b.mu.RLock()
 	stats.Reclaimable = b.metadata.ReclaimableSpace
+	stats.BloomFalsePositiveRate = b.filterFalsePositiveRate()
+	b.mu.RUnlock()
+	stats.CacheHits, stats.CacheMisses = b.cache.Stats()
 
 	return
 }
+
+// StatsGauges returns a function sampling the statistics of the database as
+// gauges for an exporter of the metrics package, e.g:
+//
+//	exporter := metrics.NewPrometheus("bitcask")
+//	db, err := bitcask.Open(path, bitcask.WithObserver(exporter))
+//	...
+//	exporter.AddGauges(bitcask.StatsGauges(db))
+func StatsGauges(db DB) func() []metrics.Gauge {
+	return func() []metrics.Gauge {
+		stats, err := db.Stats()
+		if err != nil {
+			return nil
+		}
+		return []metrics.Gauge{
+			{Name: "keys", Help: "Number of keys in the database.", Value: float64(stats.Keys)},
+			{Name: "datafiles", Help: "Number of immutable datafiles.", Value: float64(stats.Datafiles)},
+			{Name: "disk_size_bytes", Help: "Size of the database on disk in bytes.", Value: float64(stats.Size)},
+			{Name: "reclaimable_bytes", Help: "Space in bytes that can be reclaimed by a merge.", Value: float64(stats.Reclaimable)},
+			{Name: "cache_hits", Help: "Number of values read from the value cache.", Value: float64(stats.CacheHits)},
+			{Name: "cache_misses", Help: "Number of values missing from the value cache.", Value: float64(stats.CacheMisses)},
+			{Name: "bloom_false_positive_rate", Help: "Estimated false positive rate of the Bloom filters of the datafiles.", Value: stats.BloomFalsePositiveRate},
+		}
+	}
+}
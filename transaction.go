@@ -2,14 +2,12 @@ package bitcask
 
 import (
 	"bytes"
-	"hash/crc32"
-	"log"
 
 	"github.com/abcum/lcp"
-	iradix "github.com/hashicorp/go-immutable-radix/v2"
 	"go.mills.io/bitcask/v2/internal"
 	"go.mills.io/bitcask/v2/internal/config"
 	"go.mills.io/bitcask/v2/internal/data"
+	"go.mills.io/bitcask/v2/internal/keydir"
 )
 
 type transactionOptions struct{}
@@ -22,12 +20,13 @@ func defaultTransactionOptions(cfg *config.Config) *transactionOptions {
 type TransactionOption func(t *transaction)
 
 type transaction struct {
-	db        DB
+	db        *bitcask
+	epoch     uint64
 	current   data.Datafile
 	previous  data.Datafile
 	datafiles map[int]data.Datafile
 	batch     Batch
-	trie      *iradix.Txn[internal.Item]
+	trie      keydir.Txn
 	opts      *transactionOptions
 }
 
@@ -38,7 +37,7 @@ func (t *transaction) Commit() error {
 }
 
 func (t *transaction) Has(key Key) bool {
-	_, found := t.trie.Root().Get(key)
+	_, found := t.trie.Get(key)
 	return found
 }
 
@@ -53,7 +52,7 @@ func (t *transaction) Get(key Key) (Value, error) {
 func (t *transaction) get(key []byte) (internal.Entry, error) {
 	var df data.Datafile
 
-	item, found := t.trie.Root().Get(key)
+	item, found := t.trie.Get(key)
 
 	if !found {
 		return internal.Entry{}, ErrKeyNotFound
@@ -68,17 +67,17 @@ func (t *transaction) get(key []byte) (internal.Entry, error) {
 		df = t.datafiles[item.FileID]
 	}
 
-	e, err := df.ReadAt(item.Offset, item.Size)
-	if err != nil {
-		return internal.Entry{}, err
+	// The hashed keydir isn't a snapshot, the key may have been written to
+	// a datafile created after the transaction started
+	if df == nil {
+		return t.db.read(key)
 	}
 
-	checksum := crc32.ChecksumIEEE(e.Value)
-	if checksum != e.Checksum {
-		return internal.Entry{}, ErrChecksumFailed
+	// Values written by the transaction itself aren't cached
+	if df == t.current {
+		return readEntry(df, item)
 	}
-
-	return e, nil
+	return t.db.readItem(t.epoch, df, key, item)
 }
 
 func (t *transaction) Delete(key Key) error {
@@ -92,7 +91,7 @@ func (t *transaction) Delete(key Key) error {
 		return err
 	}
 
-	_, _ = t.trie.Delete(key)
+	t.trie.Delete(key)
 
 	return nil
 }
@@ -110,13 +109,33 @@ func (t *transaction) Put(key Key, value Value) error {
 
 	item := internal.Item{FileID: t.current.FileID(), Offset: offset, Size: n}
 
-	_, _ = t.trie.Insert(key, item)
+	t.trie.Insert(key, item)
 
 	return nil
 }
 
+// Len returns the number of keys visible to the transaction
+func (t *transaction) Len() int {
+	return t.trie.Len()
+}
+
+// Hash returns a Hash whose reads and writes are part of the transaction
+func (t *transaction) Hash(key Key) *Hash {
+	return &Hash{db: t, key: key}
+}
+
+// List returns a List whose reads and writes are part of the transaction
+func (t *transaction) List(key Key) *List {
+	return &List{db: t, key: key}
+}
+
+// SortedSet returns a SortedSet whose reads and writes are part of the transaction
+func (t *transaction) SortedSet(key Key) *SortedSet {
+	return &SortedSet{db: t, key: key}
+}
+
 func (t *transaction) ForEach(f KeyFunc) (err error) {
-	t.trie.Root().Walk(func(key []byte, item internal.Item) bool {
+	t.trie.Walk(func(key []byte, item internal.Item) bool {
 		if err = f(key); err != nil {
 			return true
 		}
@@ -127,16 +146,7 @@ func (t *transaction) ForEach(f KeyFunc) (err error) {
 }
 
 func (t *transaction) Iterator(opts ...IteratorOption) Iterator {
-	it := &iterator{keys: t, opts: &iteratorOptions{}}
-	for _, opt := range opts {
-		opt(it)
-	}
-	if it.opts.reverse {
-		it.itr = t.trie.Root().ReverseIterator()
-	} else {
-		it.itf = t.trie.Root().Iterator()
-	}
-	return it
+	return newIterator(t, t.trie, opts...)
 }
 
 func (t *transaction) Range(start Key, end Key, f KeyFunc) (err error) {
@@ -149,9 +159,11 @@ func (t *transaction) Range(start Key, end Key, f KeyFunc) (err error) {
 		return ErrInvalidRange
 	}
 
-	log.Printf("commonPrefix: %q\n", commonPrefix)
-
-	t.trie.Root().WalkPrefix(commonPrefix, func(key []byte, item internal.Item) bool {
+	o, ok := t.trie.(keydir.Ordered)
+	if !ok {
+		return ErrUnordered
+	}
+	o.WalkPrefix(commonPrefix, func(key []byte, item internal.Item) bool {
 		if bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) <= 0 {
 			if err = f(key); err != nil {
 				return true
@@ -166,7 +178,11 @@ func (t *transaction) Range(start Key, end Key, f KeyFunc) (err error) {
 }
 
 func (t *transaction) Scan(prefix Key, f KeyFunc) (err error) {
-	t.trie.Root().WalkPrefix(prefix, func(key []byte, item internal.Item) bool {
+	o, ok := t.trie.(keydir.Ordered)
+	if !ok {
+		return ErrUnordered
+	}
+	o.WalkPrefix(prefix, func(key []byte, item internal.Item) bool {
 		// Skip the root node
 		if len(key) == 0 {
 			return false
@@ -181,20 +197,19 @@ func (t *transaction) Scan(prefix Key, f KeyFunc) (err error) {
 }
 
 func (b *bitcask) Transaction(opts ...TransactionOption) Transaction {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	s := b.state.Load()
 
 	current := data.NewInMemoryDatafile(-1, b.config.MaxKeySize, b.config.MaxValueSize)
-	previous := b.current.ReopenReadonly()
-	datafiles := b.datafiles
+	previous := s.current.ReopenReadonly()
 
 	txn := &transaction{
 		db:        b,
+		epoch:     s.epoch,
 		current:   current,
 		previous:  previous,
-		datafiles: datafiles,
+		datafiles: s.datafiles,
 		batch:     b.Batch(),
-		trie:      b.trie.Txn(),
+		trie:      s.trie.Txn(),
 		opts:      defaultTransactionOptions(b.config),
 	}
 
@@ -49,4 +49,44 @@ func TestTransaction(t *testing.T) {
 		}
 
 	})
+
+	t.Run("Types", func(t *testing.T) {
+		tx := db.Transaction()
+		defer tx.Discard()
+
+		assert.NoError(t, tx.Hash(Key("user")).Set([]byte("name"), []byte("James")))
+		assert.NoError(t, tx.List(Key("fruits")).Append(Value("Apples")))
+
+		val, err := tx.Hash(Key("user")).Get([]byte("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("James"), val)
+
+		// not visible outside the transaction until committed
+		_, err = db.Hash(Key("user")).Get([]byte("name"))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		assert.NoError(t, tx.Commit())
+
+		val, err = db.Hash(Key("user")).Get([]byte("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("James"), val)
+
+		n, err := db.List(Key("fruits")).Len()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("Len", func(t *testing.T) {
+		tx := db.Transaction()
+		defer tx.Discard()
+
+		n := db.Len()
+		assert.Equal(t, n, tx.Len())
+
+		assert.NoError(t, tx.Put(Key("new"), Value("key")))
+		assert.Equal(t, n+1, tx.Len())
+		assert.NoError(t, tx.Delete(Key("foo")))
+		assert.Equal(t, n, tx.Len())
+		assert.Equal(t, n, db.Len())
+	})
 }
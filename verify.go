@@ -0,0 +1,390 @@
+package bitcask
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mills.io/bitcask/v2/internal"
+	"go.mills.io/bitcask/v2/internal/codec"
+	"go.mills.io/bitcask/v2/internal/data"
+	"go.mills.io/bitcask/v2/internal/keydir"
+	"go.mills.io/bitcask/v2/vfs"
+)
+
+// ProblemKind identifies the kind of a problem found by Verify
+type ProblemKind string
+
+const (
+	// ProblemCorrupted is an entry that cannot be decoded, the rest of the
+	// datafile is not verified
+	ProblemCorrupted ProblemKind = "corrupted"
+
+	// ProblemChecksum is an entry whose value does not match its checksum
+	ProblemChecksum ProblemKind = "checksum"
+
+	// ProblemTombstone is a deleted key that is still in the index, or an
+	// index item that points to a tombstone
+	ProblemTombstone ProblemKind = "tombstone"
+
+	// ProblemMissingDatafile is an index item that points to a datafile
+	// that does not exist
+	ProblemMissingDatafile ProblemKind = "missing_datafile"
+
+	// ProblemIndexMismatch is an index item that does not point to the
+	// latest entry of its key
+	ProblemIndexMismatch ProblemKind = "index_mismatch"
+
+	// ProblemMissingKey is a key whose latest entry is not a tombstone but
+	// is missing from the index
+	ProblemMissingKey ProblemKind = "missing_key"
+
+	// ProblemOrphanedFile is a file in the database directory that is not
+	// part of the database, e.g: a leftover of an interrupted recovery
+	ProblemOrphanedFile ProblemKind = "orphaned_file"
+)
+
+// Problem is a problem found by Verify
+type Problem struct {
+	Kind    ProblemKind `json:"kind"`
+	File    string      `json:"file"`
+	Offset  int64       `json:"offset"`
+	Key     string      `json:"key,omitempty"`
+	Message string      `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Key != "" {
+		return fmt.Sprintf("%s: %s@%d (key %q): %s", p.Kind, p.File, p.Offset, p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s@%d: %s", p.Kind, p.File, p.Offset, p.Message)
+}
+
+// Report is the result of verifying a database
+type Report struct {
+	Datafiles int       `json:"datafiles"`
+	Entries   int64     `json:"entries"`
+	Bytes     int64     `json:"bytes"`
+	Keys      int       `json:"keys"`
+	Problems  []Problem `json:"problems"`
+}
+
+// OK returns true if no problems were found
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyOptions are the options of Verify
+type VerifyOptions struct {
+	// BytesPerSecond limits the rate datafiles are read at to reduce the
+	// impact of verifying a live database, zero means no limit
+	BytesPerSecond int64
+}
+
+var _ Verifier = (*bitcask)(nil)
+
+// verifyRecord is the location of the latest entry of a key in the datafiles
+type verifyRecord struct {
+	fileID    int
+	offset    int64
+	size      int64
+	tombstone bool
+}
+
+// verifyFile is a datafile as of the start of Verify
+type verifyFile struct {
+	id   int
+	name string
+	f    vfs.File
+	size int64
+}
+
+// Verify checks every entry of every datafile and every index item: entry
+// checksums, that the index points to the latest entry of every key (and
+// only to keys that are not deleted) and that there are no orphaned files.
+//
+// Verify works on a snapshot of the database taken when it is called so it
+// can run against a live database, writes made afterwards are not verified.
+// It returns the problems found in the report, an error is only returned if
+// verification could not be completed, e.g: ctx was cancelled.
+func (b *bitcask) Verify(ctx context.Context, opts VerifyOptions) (report Report, err error) {
+	files, trie, orphans, err := b.verifySnapshot()
+	defer func() {
+		for _, vf := range files {
+			vf.f.Close()
+		}
+	}()
+	if err != nil {
+		return report, err
+	}
+
+	report.Problems = []Problem{}
+	report.Datafiles = len(files)
+	report.Keys = trie.Len()
+	report.Problems = append(report.Problems, orphans...)
+
+	limiter := newRateLimiter(opts.BytesPerSecond)
+
+	// Find the latest entry of every key
+	latest := make(map[string]verifyRecord)
+	for _, vf := range files {
+		if err := b.verifyDatafile(ctx, vf, latest, limiter, &report); err != nil {
+			return report, err
+		}
+	}
+
+	byID := make(map[int]*verifyFile, len(files))
+	for _, vf := range files {
+		byID[vf.id] = vf
+	}
+
+	// Check the index points to the latest entry of every key
+	trie.Walk(func(key []byte, item internal.Item) bool {
+		if err = ctx.Err(); err != nil {
+			return true
+		}
+
+		rec, found := latest[string(key)]
+		delete(latest, string(key))
+
+		vf, ok := byID[item.FileID]
+		if !ok {
+			report.Problems = append(report.Problems, Problem{
+				Kind:    ProblemMissingDatafile,
+				File:    fmt.Sprintf("%09d.data", item.FileID),
+				Offset:  item.Offset,
+				Key:     string(key),
+				Message: "index item points to a datafile that does not exist",
+			})
+			return false
+		}
+
+		problem := Problem{File: vf.name, Offset: item.Offset, Key: string(key)}
+		switch {
+		case !found:
+			problem.Kind = ProblemIndexMismatch
+			problem.Message = "key in index has no valid entry in the datafiles"
+		case rec.tombstone && rec.fileID == item.FileID && rec.offset == item.Offset:
+			problem.Kind = ProblemTombstone
+			problem.Message = "index item points to a tombstone"
+		case rec.tombstone:
+			problem.Kind = ProblemTombstone
+			problem.Message = fmt.Sprintf("deleted key is in index (deleted in %09d.data@%d)", rec.fileID, rec.offset)
+		case rec.fileID != item.FileID || rec.offset != item.Offset || rec.size != item.Size:
+			problem.Kind = ProblemIndexMismatch
+			problem.Message = fmt.Sprintf("index item is not the latest entry (%09d.data@%d)", rec.fileID, rec.offset)
+		default:
+			return false
+		}
+		report.Problems = append(report.Problems, problem)
+
+		return false
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Keys that are not deleted must be in the index
+	var missing []string
+	for key, rec := range latest {
+		if !rec.tombstone {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		rec := latest[key]
+		report.Problems = append(report.Problems, Problem{
+			Kind:    ProblemMissingKey,
+			File:    byID[rec.fileID].name,
+			Offset:  rec.offset,
+			Key:     key,
+			Message: "key is missing from the index",
+		})
+	}
+
+	return report, nil
+}
+
+// verifySnapshot opens all datafiles and takes a snapshot of the index, the
+// size of the active datafile and the files in the database directory while
+// holding the lock so they are consistent with each other.
+func (b *bitcask) verifySnapshot() ([]*verifyFile, keydir.View, []Problem, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if err := b.current.Flush(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ids := make([]int, 0, len(b.datafiles)+1)
+	for id := range b.datafiles {
+		ids = append(ids, id)
+	}
+	// The active datafile is also in datafiles when the database is reopened
+	if _, ok := b.datafiles[b.current.FileID()]; !ok {
+		ids = append(ids, b.current.FileID())
+	}
+	sort.Ints(ids)
+
+	var files []*verifyFile
+	expected := map[string]bool{
+		lockfile:      true,
+		"config.json": true,
+		"meta.json":   true,
+		"index":       true,
+		// Corrupted regions of datafiles moved aside on recovery
+		data.QuarantineDir: true,
+	}
+	for _, id := range ids {
+		name := fmt.Sprintf("%09d.data", id)
+		expected[name] = true
+		expected[filepath.Base(bloomPath(b.path, id))] = true
+
+		f, err := b.fs.Open(filepath.Join(b.path, name))
+		if err != nil {
+			return files, nil, nil, err
+		}
+		vf := &verifyFile{id: id, name: name, f: f}
+		files = append(files, vf)
+
+		if id == b.current.FileID() {
+			vf.size = b.current.Size()
+			continue
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			return files, nil, nil, err
+		}
+		vf.size = stat.Size()
+	}
+
+	entries, err := b.fs.ReadDir(b.path)
+	if err != nil {
+		return files, nil, nil, err
+	}
+	var orphans []Problem
+	for _, entry := range entries {
+		name := entry.Name()
+		if expected[name] {
+			continue
+		}
+		// The temporary database of a merge in progress
+		if b.isMerging.Load() && entry.IsDir() && strings.HasPrefix(name, "merge") {
+			continue
+		}
+		orphans = append(orphans, Problem{
+			Kind:    ProblemOrphanedFile,
+			File:    name,
+			Message: "file is not part of the database",
+		})
+	}
+
+	return files, b.trie, orphans, nil
+}
+
+// verifyDatafile checks the checksum of every entry of a datafile and records
+// the latest entry of every key
+func (b *bitcask) verifyDatafile(ctx context.Context, vf *verifyFile, latest map[string]verifyRecord, limiter *rateLimiter, report *Report) error {
+	version, err := codec.ReadHeader(vf.f, vf.size)
+	if err != nil {
+		report.Problems = append(report.Problems, Problem{
+			Kind:    ProblemCorrupted,
+			File:    vf.name,
+			Message: fmt.Sprintf("error reading header: %s", err),
+		})
+		return nil
+	}
+
+	offset := codec.DataOffset(version)
+	report.Bytes += offset
+
+	r := bufio.NewReader(io.NewSectionReader(vf.f, offset, vf.size-offset))
+	dec := codec.NewDecoder(r, version, b.config.MaxKeySize, b.config.MaxValueSize)
+
+	for offset < vf.size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var e internal.Entry
+		n, err := dec.Decode(&e)
+		if err != nil {
+			report.Problems = append(report.Problems, Problem{
+				Kind:    ProblemCorrupted,
+				File:    vf.name,
+				Offset:  offset,
+				Message: fmt.Sprintf("error decoding entry, skipping the remaining %d bytes: %s", vf.size-offset, err),
+			})
+			report.Bytes += vf.size - offset
+			return nil
+		}
+
+		report.Entries++
+		report.Bytes += n
+
+		if err := codec.VerifyChecksum(version, e); err != nil {
+			report.Problems = append(report.Problems, Problem{
+				Kind:    ProblemChecksum,
+				File:    vf.name,
+				Offset:  offset,
+				Key:     string(e.Key),
+				Message: "entry does not match its checksum",
+			})
+		} else {
+			latest[string(e.Key)] = verifyRecord{
+				fileID:    vf.id,
+				offset:    offset,
+				size:      n,
+				tombstone: len(e.Value) == 0,
+			}
+		}
+
+		offset += n
+
+		if err := limiter.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rateLimiter limits the rate bytes are read at
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, start: time.Now()}
+}
+
+// wait waits until n more bytes can be read without exceeding the rate
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.n += n
+	d := time.Duration(float64(l.n)/float64(l.rate)*float64(time.Second)) - time.Since(l.start)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+package bitcask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.mills.io/bitcask/v2/internal/codec"
+)
+
+func problemKinds(report Report) []ProblemKind {
+	var kinds []ProblemKind
+	for _, p := range report.Problems {
+		kinds = append(kinds, p.Kind)
+	}
+	return kinds
+}
+
+func TestVerify(t *testing.T) {
+	setup := func(t *testing.T) (string, DB) {
+		testDir := t.TempDir()
+
+		db, err := Open(testDir, WithMaxDatafileSize(128))
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, db.Put([]byte(fmt.Sprintf("foo%d", i)), []byte("bar")))
+		}
+		require.NoError(t, db.Put([]byte("foo1"), []byte("baz")))
+		require.NoError(t, db.Delete([]byte("foo2")))
+
+		return testDir, db
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir, db := setup(t)
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.True(report.OK(), "%v", report.Problems)
+		assert.Equal(int64(12), report.Entries)
+		assert.Equal(9, report.Keys)
+		assert.True(report.Datafiles > 1)
+
+		require.NoError(t, db.Close())
+		db, err = Open(testDir)
+		require.NoError(t, err)
+		defer db.Close()
+
+		reopened, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.True(reopened.OK(), "%v", reopened.Problems)
+		assert.Equal(report.Entries, reopened.Entries)
+		assert.Equal(report.Bytes, reopened.Bytes)
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir, db := setup(t)
+		require.NoError(t, db.Close())
+
+		// Flip a byte of the value of the first entry (foo0)
+		fn := filepath.Join(testDir, "000000000.data")
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		data[codec.HeaderSize+codec.PrefixSize(codec.CurrentVersion)+4] ^= 0xff
+		require.NoError(t, os.WriteFile(fn, data, 0600))
+
+		db, err = Open(testDir)
+		require.NoError(t, err)
+		defer db.Close()
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.False(report.OK())
+		assert.Equal([]ProblemKind{ProblemChecksum, ProblemIndexMismatch}, problemKinds(report))
+		assert.Equal("000000000.data", report.Problems[0].File)
+		assert.Equal(int64(codec.HeaderSize), report.Problems[0].Offset)
+		assert.Equal("foo0", report.Problems[0].Key)
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir, db := setup(t)
+		require.NoError(t, db.Close())
+
+		fn := filepath.Join(testDir, "000000000.data")
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(fn, data[:len(data)-1], 0600))
+
+		db, err = Open(testDir)
+		require.NoError(t, err)
+		defer db.Close()
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.Contains(problemKinds(report), ProblemCorrupted)
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, db := setup(t)
+		defer db.Close()
+
+		b := db.(*bitcask)
+		item, _ := b.trie.Get([]byte("foo3"))
+		b.trie = b.trie.Delete([]byte("foo3"))
+		b.trie = b.trie.Insert([]byte("foo2"), item)
+		item, _ = b.trie.Get([]byte("foo4"))
+		item.FileID = 1000
+		b.trie = b.trie.Insert([]byte("foo4"), item)
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.Equal([]ProblemKind{ProblemTombstone, ProblemMissingDatafile, ProblemMissingKey}, problemKinds(report))
+		assert.Equal("foo2", report.Problems[0].Key)
+		assert.Equal("foo4", report.Problems[1].Key)
+		assert.Equal("foo3", report.Problems[2].Key)
+	})
+
+	t.Run("Orphaned", func(t *testing.T) {
+		assert := assert.New(t)
+
+		testDir, db := setup(t)
+		defer db.Close()
+
+		require.NoError(t, os.WriteFile(filepath.Join(testDir, "000000000.data.recovered"), nil, 0600))
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		assert.NoError(err)
+		assert.Equal([]ProblemKind{ProblemOrphanedFile}, problemKinds(report))
+		assert.Equal("000000000.data.recovered", report.Problems[0].File)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		_, db := setup(t)
+		defer db.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := db.(Verifier).Verify(ctx, VerifyOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, db := setup(t)
+		defer db.Close()
+
+		report, err := db.(Verifier).Verify(context.Background(), VerifyOptions{})
+		require.NoError(t, err)
+
+		// Reading everything should take about 200ms
+		start := time.Now()
+		_, err = db.(Verifier).Verify(context.Background(), VerifyOptions{BytesPerSecond: report.Bytes * 5})
+		assert.NoError(err)
+		assert.True(time.Since(start) >= 150*time.Millisecond)
+	})
+}
@@ -0,0 +1,99 @@
+package vfs
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tmpSuffix is the suffix of the temporary file of an AtomicFile
+const tmpSuffix = ".tmp"
+
+// AtomicFile is a file written to a temporary file that atomically replaces
+// the named file on Commit, so a crash while writing it never leaves a torn
+// file behind: either the old or the new contents survive.
+type AtomicFile struct {
+	fs   FS
+	name string
+	tmp  string
+	f    File
+}
+
+// CreateAtomic creates an AtomicFile replacing the named file on Commit.
+// Every AtomicFile has its own temporary file so files written concurrently
+// never write to the same temporary file, the last committed wins.
+func CreateAtomic(fs FS, name string, perm os.FileMode) (*AtomicFile, error) {
+	for try := 0; ; try++ {
+		tmp := name + "." + strconv.FormatUint(uint64(rand.Uint32()), 10) + tmpSuffix
+		f, err := fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &AtomicFile{fs: fs, name: name, tmp: tmp, f: f}, nil
+	}
+}
+
+// Write writes to the temporary file
+func (a *AtomicFile) Write(p []byte) (int, error) {
+	return a.f.Write(p)
+}
+
+// Commit syncs the temporary file, renames it to the named file and syncs
+// the directory so the rename is durable
+func (a *AtomicFile) Commit() error {
+	if err := a.f.Sync(); err != nil {
+		a.Abort()
+		return err
+	}
+	if err := a.f.Close(); err != nil {
+		a.fs.Remove(a.tmp)
+		return err
+	}
+	if err := a.fs.Rename(a.tmp, a.name); err != nil {
+		a.fs.Remove(a.tmp)
+		return err
+	}
+	return a.fs.SyncDir(filepath.Dir(a.name))
+}
+
+// Abort discards the temporary file leaving the named file untouched
+func (a *AtomicFile) Abort() error {
+	a.f.Close()
+	return a.fs.Remove(a.tmp)
+}
+
+// WriteFile atomically replaces the named file with data
+func WriteFile(fs FS, name string, data []byte, perm os.FileMode) error {
+	a, err := CreateAtomic(fs, name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Write(data); err != nil {
+		a.Abort()
+		return err
+	}
+	return a.Commit()
+}
+
+// RemoveTemp removes the temporary files of AtomicFiles left behind in dir
+// by a crash
+func RemoveTemp(fs FS, dir string) error {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), tmpSuffix) {
+			continue
+		}
+		if err := fs.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
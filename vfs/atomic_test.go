@@ -0,0 +1,99 @@
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "meta.json")
+
+		require.NoError(t, WriteFile(OS, fn, []byte("old"), 0600))
+		require.NoError(t, WriteFile(OS, fn, []byte("new"), 0600))
+
+		data, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(data))
+		assert.Empty(t, tempFiles(t, OS, filepath.Dir(fn)))
+	})
+
+	t.Run("Crash", func(t *testing.T) {
+		// Crash at every operation of a write, the file must always be
+		// either the old or the new one and never torn
+		for crashAt := 1; ; crashAt++ {
+			fn := filepath.Join(t.TempDir(), "meta.json")
+			require.NoError(t, WriteFile(OS, fn, []byte("old contents"), 0600))
+
+			fs := NewFaultFS(OS, CrashAt(crashAt))
+			err := WriteFile(fs, fn, []byte("new contents"), 0600)
+
+			data, readErr := os.ReadFile(fn)
+			require.NoError(t, readErr)
+			if err == nil {
+				assert.Equal(t, "new contents", string(data))
+				break
+			}
+			assert.ErrorIs(t, err, ErrInjected)
+			assert.Contains(t, []string{"old contents", "new contents"}, string(data), "crash at %d", crashAt)
+		}
+	})
+}
+
+func TestAtomicFileAbort(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "index")
+	require.NoError(t, WriteFile(OS, fn, []byte("old"), 0600))
+
+	a, err := CreateAtomic(OS, fn, 0600)
+	require.NoError(t, err)
+	_, err = a.Write([]byte("new"))
+	require.NoError(t, err)
+	require.NoError(t, a.Abort())
+
+	data, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	assert.Empty(t, tempFiles(t, OS, filepath.Dir(fn)))
+}
+
+func TestWriteFileConcurrent(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "meta.json")
+
+	// Concurrent writes never write to the same temporary file so the file
+	// is always one of the contents written, never a mix of them
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, WriteFile(OS, fn, []byte(strings.Repeat(fmt.Sprint(i%10), 1<<12)), 0600))
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(string(data[:1]), 1<<12), string(data))
+	assert.Empty(t, tempFiles(t, OS, filepath.Dir(fn)))
+}
+
+// tempFiles returns the temporary files of AtomicFiles in dir
+func tempFiles(t *testing.T, fs FS, dir string) []string {
+	entries, err := fs.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), tmpSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,337 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrInjected is the error returned by operations of a FaultFS failing
+// because of an injected fault
+var ErrInjected = errors.New("vfs: injected fault")
+
+// Op is an operation of a FS changing it, only these operations are
+// counted and can be faulted by a FaultFS
+type Op string
+
+const (
+	OpCreate   Op = "create"
+	OpWrite    Op = "write"
+	OpSync     Op = "sync"
+	OpTruncate Op = "truncate"
+	OpRename   Op = "rename"
+	OpRemove   Op = "remove"
+	OpMkdir    Op = "mkdir"
+)
+
+// Fault is a fault injected into an operation
+type Fault int
+
+const (
+	// NoFault lets the operation succeed
+	NoFault Fault = iota
+
+	// Fail fails the operation with ErrInjected
+	Fail
+
+	// ShortWrite writes only half of the data of a write and fails it
+	// with ErrInjected, other operations fail
+	ShortWrite
+
+	// Crash fails the operation like ShortWrite and every operation after
+	// it, as if the process crashed
+	Crash
+)
+
+// Injector returns the fault to inject into the n-th (counting from 1)
+// operation of a FaultFS, op on the named file
+type Injector func(op Op, name string, n int) Fault
+
+// CrashAt returns an Injector crashing at the n-th operation
+func CrashAt(n int) Injector {
+	return func(op Op, name string, i int) Fault {
+		if i == n {
+			return Crash
+		}
+		return NoFault
+	}
+}
+
+// FailOn returns an Injector failing every op on a file whose base name
+// matches pattern (see filepath.Match) with the given fault
+func FailOn(op Op, pattern string, fault Fault) Injector {
+	return func(o Op, name string, i int) Fault {
+		if o != op {
+			return NoFault
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(name)); ok {
+			return fault
+		}
+		return NoFault
+	}
+}
+
+// FaultFS wraps a FS injecting faults into its operations. Locks are held
+// by the FaultFS rather than the wrapped FS, so after a crash a new FaultFS
+// (or the wrapped FS) can open the same database again like a restarted
+// process would.
+type FaultFS struct {
+	fs     FS
+	inject Injector
+
+	mu      sync.Mutex
+	ops     int
+	crashed bool
+	locks   map[string]bool
+}
+
+// NewFaultFS returns a FaultFS wrapping fs, inject may be nil to inject no
+// faults and only count operations
+func NewFaultFS(fs FS, inject Injector) *FaultFS {
+	return &FaultFS{fs: fs, inject: inject, locks: make(map[string]bool)}
+}
+
+// Ops returns the number of operations changing the FS so far
+func (f *FaultFS) Ops() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.ops
+}
+
+// Crashed returns true if a Crash was injected
+func (f *FaultFS) Crashed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.crashed
+}
+
+// fault counts the operation op on the named file and returns the fault to
+// inject into it
+func (f *FaultFS) fault(op Op, name string) Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Nothing is written after a crash
+	if f.crashed {
+		return Fail
+	}
+	f.ops++
+	if f.inject == nil {
+		return NoFault
+	}
+	fault := f.inject(op, name, f.ops)
+	if fault == Crash {
+		f.crashed = true
+	}
+	return fault
+}
+
+// check returns ErrInjected if the process crashed, for operations that
+// are not counted
+func (f *FaultFS) check() error {
+	if f.Crashed() {
+		return ErrInjected
+	}
+	return nil
+}
+
+// do runs fn unless a fault is injected into op on the named file
+func (f *FaultFS) do(op Op, name string, fn func() error) error {
+	if f.fault(op, name) != NoFault {
+		return ErrInjected
+	}
+	return fn()
+}
+
+func (f *FaultFS) wrap(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+// Open opens the named file for reading
+func (f *FaultFS) Open(name string) (File, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.fs.Open(name))
+}
+
+// Create creates or truncates the named file for reading and writing
+func (f *FaultFS) Create(name string) (File, error) {
+	if f.fault(OpCreate, name) != NoFault {
+		return nil, ErrInjected
+	}
+	return f.wrap(f.fs.Create(name))
+}
+
+// OpenFile opens the named file with the given flags and permissions,
+// opening a file for writing counts as OpCreate
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		if err := f.check(); err != nil {
+			return nil, err
+		}
+	} else if f.fault(OpCreate, name) != NoFault {
+		return nil, ErrInjected
+	}
+	return f.wrap(f.fs.OpenFile(name, flag, perm))
+}
+
+// Rename renames (moves) oldpath to newpath
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	return f.do(OpRename, newpath, func() error { return f.fs.Rename(oldpath, newpath) })
+}
+
+// Remove removes the named file or empty directory
+func (f *FaultFS) Remove(name string) error {
+	return f.do(OpRemove, name, func() error { return f.fs.Remove(name) })
+}
+
+// RemoveAll removes path and any children it contains
+func (f *FaultFS) RemoveAll(path string) error {
+	return f.do(OpRemove, path, func() error { return f.fs.RemoveAll(path) })
+}
+
+// Mkdir creates the named directory
+func (f *FaultFS) Mkdir(name string, perm os.FileMode) error {
+	return f.do(OpMkdir, name, func() error { return f.fs.Mkdir(name, perm) })
+}
+
+// MkdirAll creates the directory path along with any necessary parents
+func (f *FaultFS) MkdirAll(path string, perm os.FileMode) error {
+	return f.do(OpMkdir, path, func() error { return f.fs.MkdirAll(path, perm) })
+}
+
+// MkdirTemp creates a new uniquely named directory in dir
+func (f *FaultFS) MkdirTemp(dir, pattern string) (string, error) {
+	if f.fault(OpMkdir, filepath.Join(dir, pattern)) != NoFault {
+		return "", ErrInjected
+	}
+	return f.fs.MkdirTemp(dir, pattern)
+}
+
+// ReadDir returns the entries of the named directory
+func (f *FaultFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.fs.ReadDir(name)
+}
+
+// Stat returns the FileInfo of the named file
+func (f *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.fs.Stat(name)
+}
+
+// SyncDir syncs the named directory
+func (f *FaultFS) SyncDir(name string) error {
+	return f.do(OpSync, name, func() error { return f.fs.SyncDir(name) })
+}
+
+// Mmap maps the named file into memory for reading
+func (f *FaultFS) Mmap(name string) (ReaderAt, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.fs.Mmap(name)
+}
+
+// Advise gives the advice for a file of the FaultFS to the wrapped FS
+func (f *FaultFS) Advise(file File, advice Advice) error {
+	if ff, ok := file.(*faultFile); ok {
+		file = ff.File
+	}
+	return Advise(f.fs, file, advice)
+}
+
+// Lock returns the lock of the named lock file held by the FaultFS
+func (f *FaultFS) Lock(name string) (Locker, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return &faultLock{fs: f, name: filepath.Clean(name)}, nil
+}
+
+type faultFile struct {
+	File
+	fs *FaultFS
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fs.check(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fs.check(); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	switch f.fs.fault(OpWrite, f.Name()) {
+	case NoFault:
+		return f.File.Write(p)
+	case Fail:
+		return 0, ErrInjected
+	default:
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, ErrInjected
+	}
+}
+
+func (f *faultFile) Sync() error {
+	return f.fs.do(OpSync, f.Name(), f.File.Sync)
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	return f.fs.do(OpTruncate, f.Name(), func() error { return f.File.Truncate(size) })
+}
+
+// Close always closes the wrapped file so it isn't leaked
+func (f *faultFile) Close() error {
+	return f.File.Close()
+}
+
+type faultLock struct {
+	fs     *FaultFS
+	name   string
+	locked bool
+}
+
+func (l *faultLock) TryLock() (bool, error) {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+
+	if l.locked {
+		return true, nil
+	}
+	if l.fs.locks[l.name] {
+		return false, nil
+	}
+	l.fs.locks[l.name] = true
+	l.locked = true
+	return true, nil
+}
+
+func (l *faultLock) Unlock() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+
+	if l.locked {
+		delete(l.fs.locks, l.name)
+		l.locked = false
+	}
+	return nil
+}
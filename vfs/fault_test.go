@@ -0,0 +1,67 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultFS(t *testing.T) {
+	t.Run("Crash", func(t *testing.T) {
+		assert := assert.New(t)
+		mem := NewMemFS()
+		fs := NewFaultFS(mem, CrashAt(3))
+
+		f, err := fs.Create("foo")
+		require.NoError(t, err)
+		_, err = f.Write([]byte("hello"))
+		require.NoError(t, err)
+
+		// The crashing write is torn, nothing is written after it
+		n, err := f.Write([]byte("world!"))
+		assert.ErrorIs(err, ErrInjected)
+		assert.Equal(3, n)
+		_, err = f.Write([]byte("again"))
+		assert.ErrorIs(err, ErrInjected)
+		assert.ErrorIs(f.Sync(), ErrInjected)
+		_, err = fs.Stat("foo")
+		assert.ErrorIs(err, ErrInjected)
+		assert.True(fs.Crashed())
+		assert.Equal(3, fs.Ops())
+
+		data, err := ReadFile(mem, "foo")
+		require.NoError(t, err)
+		assert.Equal("hellowor", string(data))
+	})
+
+	t.Run("FailOn", func(t *testing.T) {
+		assert := assert.New(t)
+		fs := NewFaultFS(NewMemFS(), FailOn(OpRename, "index", Fail))
+
+		require.NoError(t, WriteFile(fs, "meta.json", []byte("{}"), 0600))
+		assert.ErrorIs(WriteFile(fs, "index", []byte("index"), 0600), ErrInjected)
+		assert.False(Exists(fs, "index"))
+		assert.Empty(tempFiles(t, fs, "."))
+		assert.False(fs.Crashed())
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		mem := NewMemFS()
+		fs := NewFaultFS(mem, nil)
+
+		l, err := fs.Lock("lock")
+		require.NoError(t, err)
+		ok, err := l.TryLock()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// A restarted process isn't locked out by a crashed one
+		l, err = NewFaultFS(mem, nil).Lock("lock")
+		require.NoError(t, err)
+		ok, err = l.TryLock()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+}
@@ -0,0 +1,25 @@
+package vfs
+
+// Advice is a hint of how a file is going to be read
+type Advice int
+
+const (
+	// AdviceSequential hints that the file is read from start to end
+	AdviceSequential Advice = iota
+	// AdviceWillNeed hints that the whole file is read soon in any order
+	AdviceWillNeed
+)
+
+// Adviser is implemented by filesystems taking hints of how their files are
+// going to be read
+type Adviser interface {
+	Advise(f File, advice Advice) error
+}
+
+// Advise gives the advice for f, a file of fs, if fs takes hints
+func Advise(fs FS, f File, advice Advice) error {
+	if a, ok := fs.(Adviser); ok {
+		return a.Advise(f, advice)
+	}
+	return nil
+}
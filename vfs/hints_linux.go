@@ -0,0 +1,77 @@
+//go:build linux
+
+package vfs
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Preallocate allocates disk space for the first size bytes of f without
+// changing its size, so reads still stop at its logical end. It does nothing
+// where preallocation isn't supported.
+func Preallocate(f File, size int64) error {
+	err := control(f, func(fd int) error {
+		return unix.Fallocate(fd, unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	})
+	if unsupported(err) {
+		return nil
+	}
+	return err
+}
+
+// Datasync commits the data of f to stable storage skipping the metadata not
+// needed to read it back, such as its modification time. It falls back to
+// Sync where fdatasync isn't supported.
+func Datasync(f File) error {
+	err := control(f, unix.Fdatasync)
+	if unsupported(err) {
+		return f.Sync()
+	}
+	return err
+}
+
+// Advise gives the kernel the advice for f with posix_fadvise, it does
+// nothing where the advice isn't supported
+func (osFS) Advise(f File, advice Advice) error {
+	flag := unix.FADV_SEQUENTIAL
+	if advice == AdviceWillNeed {
+		flag = unix.FADV_WILLNEED
+	}
+
+	err := control(f, func(fd int) error {
+		return unix.Fadvise(fd, 0, 0, flag)
+	})
+	if unsupported(err) {
+		return nil
+	}
+	return err
+}
+
+// control calls fn with the file descriptor of f, files without one such as
+// the files of MemFS aren't supported
+func control(f File, fn func(fd int) error) error {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func unsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) ||
+		errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.EINVAL)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package vfs
+
+// Preallocate does nothing where fallocate isn't available
+func Preallocate(f File, size int64) error { return nil }
+
+// Datasync commits f to stable storage with Sync where fdatasync isn't
+// available
+func Datasync(f File) error { return f.Sync() }
+
+// Advise does nothing where posix_fadvise isn't available
+func (osFS) Advise(f File, advice Advice) error { return nil }
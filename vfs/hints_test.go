@@ -0,0 +1,42 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHints(t *testing.T) {
+	t.Run("OS", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "foo")
+		f, err := OS.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		require.NoError(t, err)
+		defer f.Close()
+
+		require.NoError(t, Preallocate(f, 1<<20))
+		_, err = f.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, Datasync(f))
+		require.NoError(t, Advise(OS, f, AdviceSequential))
+		require.NoError(t, Advise(OS, f, AdviceWillNeed))
+
+		// Preallocating keeps the size of the file
+		stat, err := f.Stat()
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), stat.Size())
+	})
+
+	t.Run("MemFS", func(t *testing.T) {
+		fs := NewMemFS()
+		f, err := fs.Create("foo")
+		require.NoError(t, err)
+		defer f.Close()
+
+		assert.NoError(t, Preallocate(f, 1<<20))
+		assert.NoError(t, Datasync(f))
+		assert.NoError(t, Advise(fs, f, AdviceWillNeed))
+	})
+}
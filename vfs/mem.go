@@ -0,0 +1,521 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a FS keeping all files in memory. Everything written to it is
+// immediately durable, it is lost when the MemFS is garbage collected.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	locks map[string]bool
+	temp  int
+}
+
+type memNode struct {
+	dir     bool
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// NewMemFS returns an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{
+		nodes: make(map[string]*memNode),
+		locks: make(map[string]bool),
+	}
+}
+
+func isRoot(name string) bool {
+	return name == "." || name == string(filepath.Separator)
+}
+
+// lookup returns the node of the cleaned name, the root is always a
+// directory. Must be called with the lock held.
+func (m *MemFS) lookup(name string) (*memNode, bool) {
+	if isRoot(name) {
+		return &memNode{dir: true, mode: os.ModeDir | 0755}, true
+	}
+	n, ok := m.nodes[name]
+	return n, ok
+}
+
+// checkParent returns an error if the parent of the cleaned name isn't an
+// existing directory. Must be called with the lock held.
+func (m *MemFS) checkParent(op, name string) error {
+	if n, ok := m.lookup(filepath.Dir(name)); !ok || !n.dir {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// Open opens the named file for reading
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the named file for reading and writing
+func (m *MemFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens the named file with the given flags and permissions
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(name)
+	n, ok := m.lookup(clean)
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		if err := m.checkParent("open", clean); err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm, modTime: time.Now()}
+		m.nodes[clean] = n
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case n.dir && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+
+	if flag&os.O_TRUNC != 0 && !n.dir {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+
+	return &memFile{fs: m, name: name, node: n, flag: flag}, nil
+}
+
+// Rename renames (moves) oldpath to newpath, replacing newpath
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	n, ok := m.nodes[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if err := m.checkParent("rename", newpath); err != nil {
+		return err
+	}
+
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+
+	if n.dir {
+		prefix := oldpath + string(filepath.Separator)
+		for name, child := range m.nodes {
+			if strings.HasPrefix(name, prefix) {
+				delete(m.nodes, name)
+				m.nodes[filepath.Join(newpath, strings.TrimPrefix(name, prefix))] = child
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove removes the named file or empty directory
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(name)
+	n, ok := m.nodes[clean]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.dir && len(m.children(clean)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+	}
+	delete(m.nodes, clean)
+	return nil
+}
+
+// RemoveAll removes path and any children it contains
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(path)
+	prefix := clean + string(filepath.Separator)
+	for name := range m.nodes {
+		if name == clean || strings.HasPrefix(name, prefix) {
+			delete(m.nodes, name)
+		}
+	}
+	return nil
+}
+
+// Mkdir creates the named directory
+func (m *MemFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdir(filepath.Clean(name), perm)
+}
+
+// mkdir creates the cleaned named directory. Must be called with the lock
+// held.
+func (m *MemFS) mkdir(name string, perm os.FileMode) error {
+	if _, ok := m.lookup(name); ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err := m.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	m.nodes[name] = &memNode{dir: true, mode: os.ModeDir | perm, modTime: time.Now()}
+	return nil
+}
+
+// MkdirAll creates the directory path along with any necessary parents
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(path)
+	if n, ok := m.lookup(clean); ok {
+		if !n.dir {
+			return &os.PathError{Op: "mkdir", Path: path, Err: fmt.Errorf("not a directory")}
+		}
+		return nil
+	}
+
+	var missing []string
+	for dir := clean; ; dir = filepath.Dir(dir) {
+		if n, ok := m.lookup(dir); ok {
+			if !n.dir {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: fmt.Errorf("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := m.mkdir(missing[i], perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirTemp creates a new uniquely named directory in dir
+func (m *MemFS) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		m.temp++
+		name := filepath.Join(dir, fmt.Sprintf("%s%d", pattern, m.temp))
+		if _, ok := m.lookup(name); ok {
+			continue
+		}
+		if err := m.mkdir(name, 0700); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// children returns the names of the children of the cleaned directory name
+// sorted by name. Must be called with the lock held.
+func (m *MemFS) children(name string) []string {
+	var children []string
+	for child := range m.nodes {
+		if filepath.Dir(child) == name && child != name {
+			children = append(children, child)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// ReadDir returns the entries of the named directory sorted by name
+func (m *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(name)
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+	}
+	if !n.dir {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	var entries []os.DirEntry
+	for _, child := range m.children(clean) {
+		entries = append(entries, fs.FileInfoToDirEntry(m.nodes[child].info(child)))
+	}
+	return entries, nil
+}
+
+// Stat returns the FileInfo of the named file
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(name)
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return n.info(clean), nil
+}
+
+// SyncDir is a noop as everything written to a MemFS is durable
+func (m *MemFS) SyncDir(name string) error {
+	_, err := m.Stat(name)
+	return err
+}
+
+// Mmap returns a reader of the current contents of the named file
+func (m *MemFS) Mmap(name string) (ReaderAt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clean := filepath.Clean(name)
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "mmap", Path: name, Err: os.ErrNotExist}
+	}
+	return &memReaderAt{data: n.data[:len(n.data):len(n.data)]}, nil
+}
+
+// Lock returns the lock of the named lock file, creating it if needed
+func (m *MemFS) Lock(name string) (Locker, error) {
+	f, err := m.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return &memLock{fs: m, name: filepath.Clean(name)}, nil
+}
+
+func (n *memNode) info(name string) os.FileInfo {
+	return &memFileInfo{
+		name:    filepath.Base(name),
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	fs     *MemFS
+	name   string
+	node   *memNode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &os.PathError{Op: op, Path: f.name, Err: fmt.Errorf("file not opened for writing")}
+	}
+	if !write && f.flag&os.O_WRONLY != 0 {
+		return &os.PathError{Op: op, Path: f.name, Err: fmt.Errorf("file not opened for reading")}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += int64(n)
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: fmt.Errorf("negative offset")}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	copy(data, f.node.data)
+	f.node.data = data
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+type memReaderAt struct {
+	data []byte
+}
+
+func (r *memReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *memReaderAt) Len() int { return len(r.data) }
+
+func (r *memReaderAt) Close() error { return nil }
+
+type memLock struct {
+	fs     *MemFS
+	name   string
+	locked bool
+}
+
+func (l *memLock) TryLock() (bool, error) {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+
+	if l.locked {
+		return true, nil
+	}
+	if l.fs.locks[l.name] {
+		return false, nil
+	}
+	l.fs.locks[l.name] = true
+	l.locked = true
+	return true, nil
+}
+
+func (l *memLock) Unlock() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+
+	if l.locked {
+		delete(l.fs.locks, l.name)
+		l.locked = false
+	}
+	return nil
+}
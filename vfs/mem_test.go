@@ -0,0 +1,115 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	t.Run("Files", func(t *testing.T) {
+		assert := assert.New(t)
+		fs := NewMemFS()
+
+		_, err := fs.Create("db/foo")
+		assert.True(os.IsNotExist(err))
+
+		require.NoError(t, fs.MkdirAll("db", 0700))
+		f, err := fs.OpenFile("db/foo", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("hello "))
+		require.NoError(t, err)
+		_, err = f.Write([]byte("world"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		data, err := ReadFile(fs, "db/foo")
+		require.NoError(t, err)
+		assert.Equal("hello world", string(data))
+
+		f, err = fs.Open("db/foo")
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = f.Write([]byte("!"))
+		assert.Error(err)
+
+		b := make([]byte, 5)
+		_, err = f.ReadAt(b, 6)
+		assert.NoError(err)
+		assert.Equal("world", string(b))
+		_, err = f.ReadAt(b, 8)
+		assert.Equal(io.EOF, err)
+
+		_, err = f.Seek(6, io.SeekStart)
+		require.NoError(t, err)
+		rest, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal("world", string(rest))
+
+		fi, err := fs.Stat("db/foo")
+		require.NoError(t, err)
+		assert.Equal(int64(11), fi.Size())
+		assert.Equal(os.FileMode(0600), fi.Mode())
+
+		r, err := fs.Mmap("db/foo")
+		require.NoError(t, err)
+		assert.Equal(11, r.Len())
+	})
+
+	t.Run("Dirs", func(t *testing.T) {
+		assert := assert.New(t)
+		fs := NewMemFS()
+
+		require.NoError(t, fs.MkdirAll(filepath.Join("db", "quarantine"), 0700))
+		require.NoError(t, WriteFile(fs, filepath.Join("db", "b"), []byte("b"), 0600))
+		require.NoError(t, WriteFile(fs, filepath.Join("db", "a"), []byte("a"), 0600))
+
+		tmp, err := fs.MkdirTemp("db", "merge")
+		require.NoError(t, err)
+		require.NoError(t, WriteFile(fs, filepath.Join(tmp, "c"), []byte("c"), 0600))
+
+		entries, err := fs.ReadDir("db")
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal([]string{"a", "b", filepath.Base(tmp), "quarantine"}, names)
+		assert.True(entries[3].IsDir())
+
+		assert.Error(fs.Remove(tmp))
+		require.NoError(t, fs.Rename(tmp, filepath.Join("db", "merged")))
+		assert.True(Exists(fs, filepath.Join("db", "merged", "c")))
+		assert.False(Exists(fs, filepath.Join(tmp, "c")))
+
+		require.NoError(t, fs.RemoveAll("db"))
+		assert.False(Exists(fs, filepath.Join("db", "a")))
+		assert.False(Exists(fs, "db"))
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		assert := assert.New(t)
+		fs := NewMemFS()
+
+		l1, err := fs.Lock("lock")
+		require.NoError(t, err)
+		l2, err := fs.Lock("lock")
+		require.NoError(t, err)
+
+		ok, err := l1.TryLock()
+		assert.NoError(err)
+		assert.True(ok)
+		ok, err = l2.TryLock()
+		assert.NoError(err)
+		assert.False(ok)
+
+		require.NoError(t, l1.Unlock())
+		ok, err = l2.TryLock()
+		assert.NoError(err)
+		assert.True(ok)
+	})
+}
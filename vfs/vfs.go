@@ -0,0 +1,163 @@
+// Package vfs abstracts the filesystem operations of the database so they
+// can be replaced, for example to run a database in memory (MemFS) or to
+// simulate crashes in tests (FaultFS)
+package vfs
+
+import (
+	"io"
+	"os"
+
+	"github.com/gofrs/flock"
+	"golang.org/x/exp/mmap"
+)
+
+// File is an open file of a FS
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+
+	// Name returns the name of the file as given to Open
+	Name() string
+
+	// Stat returns the FileInfo of the file
+	Stat() (os.FileInfo, error)
+
+	// Sync commits the contents of the file to stable storage
+	Sync() error
+
+	// Truncate changes the size of the file
+	Truncate(size int64) error
+}
+
+// ReaderAt is a read-only memory mapped file
+type ReaderAt interface {
+	io.ReaderAt
+	io.Closer
+
+	// Len returns the length of the mapped file
+	Len() int
+}
+
+// Locker is an exclusive lock of a database held by a process
+type Locker interface {
+	// TryLock tries to acquire the lock without blocking and returns
+	// whether it was acquired
+	TryLock() (bool, error)
+
+	// Unlock releases the lock
+	Unlock() error
+}
+
+// FS is a filesystem, its methods behave like their counterparts of the os
+// package
+type FS interface {
+	// Open opens the named file for reading
+	Open(name string) (File, error)
+
+	// Create creates or truncates the named file for reading and writing
+	Create(name string) (File, error)
+
+	// OpenFile opens the named file with the given flags (os.O_RDONLY etc.)
+	// and permissions
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Rename renames (moves) oldpath to newpath, replacing newpath
+	Rename(oldpath, newpath string) error
+
+	// Remove removes the named file or empty directory
+	Remove(name string) error
+
+	// RemoveAll removes path and any children it contains
+	RemoveAll(path string) error
+
+	// Mkdir creates the named directory
+	Mkdir(name string, perm os.FileMode) error
+
+	// MkdirAll creates the directory path along with any necessary parents
+	MkdirAll(path string, perm os.FileMode) error
+
+	// MkdirTemp creates a new uniquely named directory in dir whose name
+	// starts with pattern and returns its path
+	MkdirTemp(dir, pattern string) (string, error)
+
+	// ReadDir returns the entries of the named directory sorted by name
+	ReadDir(name string) ([]os.DirEntry, error)
+
+	// Stat returns the FileInfo of the named file
+	Stat(name string) (os.FileInfo, error)
+
+	// SyncDir syncs the named directory so the creation, renaming or
+	// removal of files in it is durable
+	SyncDir(name string) error
+
+	// Mmap maps the named file into memory for reading
+	Mmap(name string) (ReaderAt, error)
+
+	// Lock returns the lock of the named lock file
+	Lock(name string) (Locker, error)
+}
+
+// OS is the FS of the operating system
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) { return os.Open(name) }
+
+func (osFS) Create(name string) (File, error) { return os.Create(name) }
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+func (osFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) MkdirTemp(dir, pattern string) (string, error) { return os.MkdirTemp(dir, pattern) }
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) SyncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+func (osFS) Mmap(name string) (ReaderAt, error) { return mmap.Open(name) }
+
+func (osFS) Lock(name string) (Locker, error) { return flock.New(name), nil }
+
+// ReadFile reads the whole named file
+func ReadFile(fs FS, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Exists returns true if the named file exists
+func Exists(fs FS, name string) bool {
+	_, err := fs.Stat(name)
+	return err == nil
+}